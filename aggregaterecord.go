@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// aggregateGroupVersion is the API group of the controller's own CRDs, see config/crd.
+var aggregateGroupVersion = schema.GroupVersion{Group: "dns.azure.com", Version: "v1alpha1"}
+
+// publishedNameAnnotation remembers the record names an AggregateRecord or service published so a renamed one is cleaned up.
+const publishedNameAnnotation = annotationPrefix + "published-name"
+
+// AggregateRecord publishes one record name with the IPs of every service its selectors match,
+// e.g. a regional alias in front of several services.
+type AggregateRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AggregateRecordSpec `json:"spec"`
+}
+
+type AggregateRecordSpec struct {
+	// Name is the record name, relative to the zone like service records.
+	Name string `json:"name"`
+	// Services selects the services whose IPs are published, a service matching several selectors counts once.
+	Services []AggregateServiceSelector `json:"services"`
+}
+
+type AggregateServiceSelector struct {
+	// Namespace to select services in, the AggregateRecord's own namespace when empty.
+	Namespace string               `json:"namespace,omitempty"`
+	Selector  metav1.LabelSelector `json:"selector"`
+}
+
+type AggregateRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []AggregateRecord `json:"items"`
+}
+
+func (in *AggregateRecord) DeepCopyInto(out *AggregateRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Services != nil {
+		out.Spec.Services = make([]AggregateServiceSelector, len(in.Spec.Services))
+		for i := range in.Spec.Services {
+			out.Spec.Services[i].Namespace = in.Spec.Services[i].Namespace
+			in.Spec.Services[i].Selector.DeepCopyInto(&out.Spec.Services[i].Selector)
+		}
+	}
+}
+
+func (in *AggregateRecord) DeepCopyObject() runtime.Object {
+	out := &AggregateRecord{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *AggregateRecordList) DeepCopyObject() runtime.Object {
+	out := &AggregateRecordList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]AggregateRecord, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// addAggregateRecordToScheme registers AggregateRecord and its list.
+func addAggregateRecordToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(aggregateGroupVersion, &AggregateRecord{}, &AggregateRecordList{})
+	metav1.AddToGroupVersion(scheme, aggregateGroupVersion)
+	return nil
+}
+
+// AggregateRecordReconciler publishes AggregateRecords and keeps them up to date as the services
+// they select come, go or change IPs. They get the same finalizer as services.
+type AggregateRecordReconciler struct {
+	client.Client
+	dns      dnsClient
+	recorder record.EventRecorder
+	// SkipDeletes is ServiceReconciler's, records are left in azure and only the finalizer is dropped.
+	SkipDeletes bool
+}
+
+func (r *AggregateRecordReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	// aggregate records always go to the -zoneName zones.
+	ctx = withZone(withRecordSource(ctx, "aggregaterecord", req.NamespacedName), "")
+	var agg AggregateRecord
+	if err := r.Get(ctx, req.NamespacedName, &agg); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	published := publishedNames(&agg)
+
+	if agg.DeletionTimestamp != nil {
+		if !controllerutil.ContainsFinalizer(&agg, finalizer) {
+			return reconcile.Result{}, nil
+		}
+		log.Printf("Deleting AggregateRecord %s ...", req.NamespacedName)
+		return reconcile.Result{}, r.release(ctx, &agg)
+	}
+
+	if agg.Spec.Name == "" {
+		log.Printf("Skipping AggregateRecord %s, it has no spec.name", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+	ips, err := r.aggregateIPs(ctx, &agg)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// like HTTPRoutes the finalizer and the name about to be published are recorded before writing.
+	if err := updateFinalizer(ctx, r.Client, &agg, controllerutil.AddFinalizer); err != nil {
+		return reconcile.Result{}, err
+	}
+	if !slices.Contains(published, agg.Spec.Name) {
+		if err := r.patchPublishedNames(ctx, &agg, append(published, agg.Spec.Name)); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if _, err := r.dns.UpsertDNSRecords(ctx, agg.Spec.Name, ips, 0); err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(published) > 0 && !slices.Equal(published, []string{agg.Spec.Name}) {
+		stale := slices.DeleteFunc(slices.Clone(published), func(name string) bool { return name == agg.Spec.Name })
+		if err := r.deleteNames(ctx, &agg, stale); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.patchPublishedNames(ctx, &agg, []string{agg.Spec.Name}); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	log.Printf("Successfully updated DNS for AggregateRecord %s: %s -> %v", req.NamespacedName, agg.Spec.Name, ips)
+	return reconcile.Result{}, nil
+}
+
+// release deletes the records agg published and then drops our finalizer from it.
+func (r *AggregateRecordReconciler) release(ctx context.Context, agg *AggregateRecord) error {
+	ctx = withZone(withRecordSource(ctx, "aggregaterecord", client.ObjectKeyFromObject(agg)), "")
+	if err := r.deleteNames(ctx, agg, publishedNames(agg)); err != nil {
+		return err
+	}
+	return updateFinalizer(ctx, r.Client, agg, controllerutil.RemoveFinalizer)
+}
+
+// patchPublishedNames records the names agg's records are published under.
+func (r *AggregateRecordReconciler) patchPublishedNames(ctx context.Context, agg *AggregateRecord, names []string) error {
+	base := agg.DeepCopyObject().(client.Object)
+	setPublishedNames(agg, names)
+	return r.Patch(ctx, agg, client.MergeFrom(base))
+}
+
+// deleteNames deletes the records agg published at names. With SkipDeletes they are left in azure.
+func (r *AggregateRecordReconciler) deleteNames(ctx context.Context, agg *AggregateRecord, names []string) error {
+	if r.SkipDeletes {
+		if len(names) > 0 {
+			log.Printf("Not deleting records %v of AggregateRecord %s/%s, -allow-delete is off", names, agg.Namespace, agg.Name)
+			r.recorder.Event(agg, corev1.EventTypeNormal, recordsNotDeletedReason, recordsNotDeletedMessage)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := r.dns.DeleteDNSRecords(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishedNames reads back the record names obj may have published, more than one while renaming.
+func publishedNames(obj client.Object) []string {
+	v := obj.GetAnnotations()[publishedNameAnnotation]
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func setPublishedNames(obj client.Object, names []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[publishedNameAnnotation] = strings.Join(names, ",")
+	obj.SetAnnotations(annotations)
+}
+
+// aggregateIPs collects the IPs of every service agg selects, sorted and without duplicates.
+// Headless services have no IPs of their own and are skipped.
+func (r *AggregateRecordReconciler) aggregateIPs(ctx context.Context, agg *AggregateRecord) ([]string, error) {
+	var ips []string
+	for _, s := range agg.Spec.Services {
+		sel, err := metav1.LabelSelectorAsSelector(&s.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("AggregateRecord %s/%s: %w", agg.Namespace, agg.Name, err)
+		}
+		var services corev1.ServiceList
+		if err := r.List(ctx, &services, client.InNamespace(selectorNamespace(agg, s)), client.MatchingLabelsSelector{Selector: sel}); err != nil {
+			return nil, err
+		}
+		for i := range services.Items {
+			svc := &services.Items[i]
+			if svc.Spec.ClusterIP == corev1.ClusterIPNone || svc.DeletionTimestamp != nil {
+				continue
+			}
+			ips = append(ips, serviceIPs(svc)...)
+		}
+	}
+	slices.Sort(ips)
+	return slices.Compact(ips), nil
+}
+
+func selectorNamespace(agg *AggregateRecord, s AggregateServiceSelector) string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+	return agg.Namespace
+}
+
+// aggregatesForService maps a service to the AggregateRecords selecting it, so membership and IP changes
+// are republished. Updates are mapped for the old and new service so one that stops matching is removed too.
+func (r *AggregateRecordReconciler) aggregatesForService(ctx context.Context, svc client.Object) []reconcile.Request {
+	var aggs AggregateRecordList
+	if err := r.List(ctx, &aggs); err != nil {
+		log.Printf("Failed to list AggregateRecords for service %s/%s: %v", svc.GetNamespace(), svc.GetName(), err)
+		return nil
+	}
+	var reqs []reconcile.Request
+	for i := range aggs.Items {
+		agg := &aggs.Items[i]
+		for _, s := range agg.Spec.Services {
+			sel, err := metav1.LabelSelectorAsSelector(&s.Selector)
+			if err != nil || selectorNamespace(agg, s) != svc.GetNamespace() {
+				continue
+			}
+			if sel.Matches(labels.Set(svc.GetLabels())) {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(agg)})
+				break
+			}
+		}
+	}
+	return reqs
+}
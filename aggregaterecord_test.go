@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestAggregateRecordFromTwoServices(t *testing.T) {
+	east := testService("api-east", "10.0.1.1")
+	east.Labels = map[string]string{"app": "api"}
+	west := testService("api-west", "10.0.2.1", "fd00::2")
+	west.Namespace = "west"
+	west.Labels = map[string]string{"app": "api"}
+	other := testService("web", "10.0.3.1")
+	other.Labels = map[string]string{"app": "web"}
+	agg := &AggregateRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec: AggregateRecordSpec{
+			Name: "api.global",
+			Services: []AggregateServiceSelector{
+				{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}},
+				{Namespace: "west", Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(east, west, other, agg).Build()
+	dns := newFakeDNSClient()
+	r := &AggregateRecordReconciler{Client: c, dns: dns}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "api"}
+	reconcileAggregate := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+	}
+
+	reconcileAggregate()
+	want := map[string][]string{"api.global": {"10.0.1.1", "10.0.2.1", "fd00::2"}}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	// both services map back to the aggregate, the unselected one doesn't.
+	for _, svc := range []client.Object{east, west} {
+		if got := r.aggregatesForService(ctx, svc); !slices.Equal(got, []reconcile.Request{{NamespacedName: key}}) {
+			t.Errorf("%s maps to %v", svc.GetName(), got)
+		}
+	}
+	if got := r.aggregatesForService(ctx, other); len(got) > 0 {
+		t.Errorf("unselected service maps to %v", got)
+	}
+
+	// a service going away drops its IPs from the aggregate.
+	if err := c.Delete(ctx, west); err != nil {
+		t.Fatal(err)
+	}
+	reconcileAggregate()
+	want = map[string][]string{"api.global": {"10.0.1.1"}}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records after removing api-west = %v, want %v", got, want)
+	}
+
+	// deleting the aggregate removes its record and lets it go.
+	if err := c.Delete(ctx, agg); err != nil {
+		t.Fatal(err)
+	}
+	reconcileAggregate()
+	if got := dns.snapshot(); len(got) > 0 {
+		t.Errorf("deleted aggregate left records %v", got)
+	}
+	if err := c.Get(ctx, key, &AggregateRecord{}); err == nil {
+		t.Error("aggregate still exists after its records were deleted")
+	}
+}
+
+func TestAggregateRecordFinalizerConflictRetried(t *testing.T) {
+	agg := &AggregateRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec:       AggregateRecordSpec{Name: "api.global"},
+	}
+	var patches, updates int
+	c := interceptor.NewClient(fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(agg).Build(), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patches++; patches == 1 {
+				return apierrors.NewConflict(aggregateGroupVersion.WithResource("aggregaterecords").GroupResource(), obj.GetName(), errors.New("the object has been modified"))
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			updates++
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+	r := &AggregateRecordReconciler{Client: c, dns: newFakeDNSClient()}
+	conflicts := testutil.ToFloat64(finalizerConflicts)
+	key := client.ObjectKeyFromObject(agg)
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if got := testutil.ToFloat64(finalizerConflicts) - conflicts; got != 1 {
+		t.Errorf("%v finalizer conflicts counted, want 1", got)
+	}
+	if updates > 0 {
+		t.Errorf("%d full updates, want only patches", updates)
+	}
+	var got AggregateRecord
+	if err := c.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(&got, finalizer) || !slices.Equal(publishedNames(&got), []string{"api.global"}) {
+		t.Errorf("finalizers %v, published %v", got.Finalizers, publishedNames(&got))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+var errNameNotAllowed = errors.New("record name is outside -allowed-names")
+
+// AllowlistDNS refuses to touch service records whose name doesn't match the allowlist,
+// a hard boundary for zones shared with records the controller must never manage.
+// The controller's own TXT records (dns-version, services-index, ...) aren't subject to it.
+type AllowlistDNS struct {
+	dnsClient
+	allowed *regexp.Regexp
+}
+
+// NewAllowlistDNS wraps dns so only names fully matching expr are written or deleted.
+func NewAllowlistDNS(dns dnsClient, expr string) (*AllowlistDNS, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &AllowlistDNS{dnsClient: dns, allowed: re}, nil
+}
+
+// withAllowlist is NewAllowlistDNS, or dns as it is for an empty expr.
+func withAllowlist(dns dnsClient, expr string) (dnsClient, error) {
+	if expr == "" {
+		return dns, nil
+	}
+	return NewAllowlistDNS(dns, expr)
+}
+
+func (a *AllowlistDNS) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	if !a.allowed.MatchString(dnsName) {
+		return 0, fmt.Errorf("%w: %s", errNameNotAllowed, dnsName)
+	}
+	return a.dnsClient.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+}
+
+// DeleteDNSRecords skips names outside the allowlist, the controller never wrote them.
+func (a *AllowlistDNS) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	if !a.allowed.MatchString(dnsName) {
+		log.Printf("Not deleting %s, it is outside -allowed-names", dnsName)
+		return nil
+	}
+	return a.dnsClient.DeleteDNSRecords(ctx, dnsName)
+}
+
+func (a *AllowlistDNS) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	if !a.allowed.MatchString(dnsName) {
+		log.Printf("Not retaining %s, it is outside -allowed-names", dnsName)
+		return nil
+	}
+	return a.dnsClient.RetainDNSRecords(ctx, dnsName)
+}
+
+func (a *AllowlistDNS) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	if !a.allowed.MatchString(dnsName) {
+		if len(records) == 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", errNameNotAllowed, dnsName)
+	}
+	return a.dnsClient.UpsertExtraRecords(ctx, dnsName, records)
+}
+
+func (a *AllowlistDNS) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	if !a.allowed.MatchString(dnsName) {
+		if target == "" {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", errNameNotAllowed, dnsName)
+	}
+	return a.dnsClient.UpsertCNAMERecord(ctx, dnsName, target, ttl)
+}
+
+func (a *AllowlistDNS) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	var allowed []string
+	for _, n := range dnsNames {
+		if a.allowed.MatchString(n) {
+			allowed = append(allowed, n)
+		} else {
+			log.Printf("Not deleting %s, it is outside -allowed-names", n)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return a.dnsClient.BatchDeleteDNSRecords(ctx, allowed)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAllowlistRefusesNamesOutsideIt(t *testing.T) {
+	inside, outside := testService("web", "10.0.0.1"), testService("db", "10.0.0.2")
+	outside.Namespace = "other"
+	r, zone := newTestReconciler(t, inside, outside)
+	r.RecordSuffix = "svc"
+	allowlist, err := NewAllowlistDNS(zone, `.*\.default\.svc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.dns = allowlist
+
+	reconcileService(t, r, inside)
+	reconcileService(t, r, outside)
+	if _, ok := zone.snapshot()["web.default.svc"]; !ok {
+		t.Errorf("web.default.svc inside the allowlist not published: %v", zone.snapshot())
+	}
+	if _, ok := zone.snapshot()["db.other.svc"]; ok {
+		t.Error("db.other.svc outside the allowlist was published")
+	}
+	var refused bool
+	for events := r.recorder.(*record.FakeRecorder).Events; len(events) > 0; {
+		refused = refused || strings.Contains(<-events, "NameNotAllowed")
+	}
+	if !refused {
+		t.Error("no NameNotAllowed event for the name outside the allowlist")
+	}
+}
+
+func TestOrphanCollectorHonorsAllowlist(t *testing.T) {
+	zone, sets := newTestAzureDNSConfig(t, WithOwnerID("me", true))
+	ctx := context.Background()
+	// both services are gone, only the name inside the allowlist may be deleted.
+	for _, svc := range []types.NamespacedName{{Namespace: "default", Name: "web"}, {Namespace: "other", Name: "db"}} {
+		name := svc.Name + "." + svc.Namespace + ".svc"
+		if _, err := zone.UpsertDNSRecords(withRecordSource(ctx, "service", svc), name, []string{"10.0.0.1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allowlist, err := NewAllowlistDNS(zone, `.*\.default\.svc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc := &OrphanCollector{Reader: fake.NewClientBuilder().WithScheme(schemeSetup()).Build(), zones: []*AzureDNSConfig{zone}, dns: allowlist}
+	if err := gc.Collect(ctx, zone); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; ok {
+		t.Error("orphaned web.default.svc inside the allowlist wasn't deleted")
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "db.other.svc")]; !ok {
+		t.Error("db.other.svc outside the allowlist was deleted")
+	}
+}
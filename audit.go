@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// Audited operations.
+const (
+	auditUpsert = "upsert"
+	auditDelete = "delete"
+)
+
+// AuditLogger writes one JSON line per azure mutation, separate from the normal log.
+// Only record data is logged, never credentials.
+type AuditLogger struct {
+	logger *slog.Logger
+	actor  string // which identity the controller acts as, e.g. a client id
+}
+
+func NewAuditLogger(w io.Writer, actor string) *AuditLogger {
+	return &AuditLogger{
+		logger: slog.New(slog.NewJSONHandler(w, nil)),
+		actor:  actor,
+	}
+}
+
+// Record logs a single mutation. old and new are the record values, nil when unknown or not applicable.
+// Safe to call on a nil logger.
+func (a *AuditLogger) Record(op, zone string, rt dns.RecordType, name string, old, new []string, err error) {
+	if a == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = err.Error()
+	}
+	a.logger.Info("azure dns mutation",
+		slog.Time("timestamp", time.Now().UTC()),
+		slog.String("actor", a.actor),
+		slog.String("operation", op),
+		slog.String("zone", zone),
+		slog.String("name", name),
+		slog.String("type", string(rt)),
+		slog.Any("old", old),
+		slog.Any("new", new),
+		slog.String("result", result),
+	)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// retryHint classifies an azure error. retryable is true for throttling, server errors and timeouts, after is
+// the delay azure asked for in Retry-After, 0 when it didn't. ok is false for errors that aren't from azure.
+func retryHint(err error) (after time.Duration, retryable, ok bool) {
+	if errors.Is(err, errAzureTimeout) {
+		return 0, true, true
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return 0, false, false
+	}
+	retryable = respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= http.StatusInternalServerError
+	if respErr.RawResponse == nil {
+		return 0, retryable, true
+	}
+	v := respErr.RawResponse.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, retryable, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), retryable, true
+	}
+	return 0, retryable, true
+}
+
+// AzureBackoff tracks consecutive azure failures per service so each is retried with its own
+// exponential delay instead of the controller's shared rate limiter hammering a throttled API.
+type AzureBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+func NewAzureBackoff(base, maxDelay time.Duration) *AzureBackoff {
+	return &AzureBackoff{Base: base, Max: maxDelay, failures: map[types.NamespacedName]int{}}
+}
+
+// next records a failure for key and returns how long to wait, at least hint.
+func (b *AzureBackoff) next(key types.NamespacedName, hint time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.failures[key]
+	b.failures[key] = n + 1
+	return max(b.delay(n), hint)
+}
+
+// delay is the wait after n earlier failures.
+func (b *AzureBackoff) delay(n int) time.Duration {
+	if n >= 32 {
+		return b.Max
+	}
+	return min(b.Base<<n, b.Max)
+}
+
+// backoffState is one service's backoff in the debug dump.
+type backoffState struct {
+	Failures  int    `json:"failures"`
+	NextDelay string `json:"nextDelay"` // before any Retry-After azure asks for
+}
+
+// snapshot is every service backing off, by namespace/name. Safe to call on a nil backoff.
+func (b *AzureBackoff) snapshot() map[string]backoffState {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string]backoffState, len(b.failures))
+	for key, n := range b.failures {
+		out[key.String()] = backoffState{Failures: n, NextDelay: b.delay(n).String()}
+	}
+	return out
+}
+
+// reset forgets key's failures after it reconciled cleanly.
+func (b *AzureBackoff) reset(key types.NamespacedName) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
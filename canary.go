@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Canary picks the services that get behavior still being rolled out, so it can be tried on a
+// few services before it becomes the default. Everything else keeps the current behavior.
+type Canary struct {
+	Selector labels.Selector
+	// TTL replaces the zone's default TTL for canary services, 0 leaves it alone.
+	TTL int64
+}
+
+// NewCanary parses -canary-selector, a label selector, and -canary-behavior, like "ttl=60".
+func NewCanary(selector, behavior string) (*Canary, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("selector: %w", err)
+	}
+	if sel.Empty() {
+		return nil, fmt.Errorf("an empty selector would make every service a canary")
+	}
+	c := &Canary{Selector: sel}
+	for _, kv := range strings.Split(behavior, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("behavior %q is not key=value", kv)
+		}
+		switch key {
+		case "ttl":
+			c.TTL, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || c.TTL <= 0 {
+				return nil, fmt.Errorf("invalid canary ttl %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unknown canary behavior %q", key)
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether svc is a canary. A nil Canary matches nothing.
+func (c *Canary) matches(svc *corev1.Service) bool {
+	return c != nil && c.Selector.Matches(labels.Set(svc.Labels))
+}
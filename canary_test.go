@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestCanaryServiceGetsCanaryTTL(t *testing.T) {
+	canary, err := NewCanary("dns-canary=true", "ttl=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][2]string{{"", "ttl=60"}, {"dns-canary=true", "ttl"}, {"dns-canary=true", "ttl=0"}, {"dns-canary=true", "naming=new"}} {
+		if _, err := NewCanary(bad[0], bad[1]); err == nil {
+			t.Errorf("-canary-selector %q -canary-behavior %q was accepted", bad[0], bad[1])
+		}
+	}
+
+	labeled := testService("web", "10.0.0.1")
+	labeled.Labels = map[string]string{"dns-canary": "true"}
+	plain := testService("api", "10.0.0.2")
+	r, dns := newTestReconciler(t, labeled, plain)
+	r.RecordSuffix = "svc"
+	r.canary = canary
+	reconcileService(t, r, labeled)
+	reconcileService(t, r, plain)
+	// 0 is the zone's TTL, which the rest keep.
+	if got := dns.ttls["web.default.svc"]; got != 60 {
+		t.Errorf("canary ttl = %d, want 60", got)
+	}
+	if got := dns.ttls["api.default.svc"]; got != 0 {
+		t.Errorf("unlabeled ttl = %d, want the zone's", got)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Cleanup is the -cleanup run for uninstalling: it deletes the records of every service carrying the
+// finalizer, removes the finalizer and stops the manager. AggregateRecords and HTTPRoutes get the same
+// when their reconcilers are enabled, otherwise they are skipped. Objects without the finalizer are
+// already clean, so running it again only picks up what a previous run didn't finish.
+type Cleanup struct {
+	Reader     client.Reader // uncached, the service controllers aren't running to fill a cache
+	services   *ServiceReconciler
+	dnsZones   *DNSZoneReconciler         // optional, nil without -enable-dnszones
+	aggregates *AggregateRecordReconciler // optional, nil without -enable-aggregate-records
+	routes     *HTTPRouteReconciler       // optional, nil without -enable-gateway-api
+	guard      *LeaderGuard
+	done       func() // stops the manager once everything is clean
+}
+
+// Start implements manager.Runnable. It runs on the leader, like every other writer.
+func (c *Cleanup) Start(ctx context.Context) error {
+	for !c.guard.leading() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if c.dnsZones != nil {
+		if err := c.dnsZones.load(ctx); err != nil {
+			return err
+		}
+	}
+	var list corev1.ServiceList
+	if err := c.Reader.List(ctx, &list); err != nil {
+		return err
+	}
+	cleaned := 0
+	for i := range list.Items {
+		svc := &list.Items[i]
+		if !controllerutil.ContainsFinalizer(svc, finalizer) || !c.services.shard.owns(client.ObjectKeyFromObject(svc)) {
+			continue
+		}
+		log.Printf("Cleaning up Service %s/%s ...", svc.Namespace, svc.Name)
+		if err := c.services.cleanup(ctx, svc); err != nil {
+			return err
+		}
+		cleaned++
+	}
+	log.Printf("Cleaned up %d services", cleaned)
+
+	if c.aggregates != nil {
+		var aggs AggregateRecordList
+		if err := c.Reader.List(ctx, &aggs); err != nil {
+			return err
+		}
+		cleaned = 0
+		for i := range aggs.Items {
+			agg := &aggs.Items[i]
+			if !controllerutil.ContainsFinalizer(agg, finalizer) {
+				continue
+			}
+			log.Printf("Cleaning up AggregateRecord %s/%s ...", agg.Namespace, agg.Name)
+			if err := c.aggregates.release(ctx, agg); err != nil {
+				return err
+			}
+			cleaned++
+		}
+		log.Printf("Cleaned up %d AggregateRecords", cleaned)
+	} else {
+		log.Printf("Skipping AggregateRecords, -enable-aggregate-records is off. Any still carrying %s keep it", finalizer)
+	}
+
+	if c.routes != nil {
+		routes := &unstructured.UnstructuredList{}
+		routes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind("HTTPRouteList"))
+		if err := c.Reader.List(ctx, routes); err != nil {
+			return err
+		}
+		cleaned = 0
+		for i := range routes.Items {
+			route := &routes.Items[i]
+			if !controllerutil.ContainsFinalizer(route, finalizer) {
+				continue
+			}
+			log.Printf("Cleaning up HTTPRoute %s/%s ...", route.GetNamespace(), route.GetName())
+			if err := c.routes.release(ctx, route); err != nil {
+				return err
+			}
+			cleaned++
+		}
+		log.Printf("Cleaned up %d HTTPRoutes", cleaned)
+	} else {
+		log.Printf("Skipping HTTPRoutes, -enable-gateway-api is off. Any still carrying %s keep it", finalizer)
+	}
+
+	log.Printf("Cleanup finished")
+	c.done()
+	return nil
+}
+
+// cleanup deletes the records svc published and removes its finalizer, like deleting it would.
+func (r *ServiceReconciler) cleanup(ctx context.Context, svc *corev1.Service) error {
+	ctx = withRecordSource(ctx, "service", client.ObjectKeyFromObject(svc))
+	zone := svc.Annotations[publishedZoneAnnotation]
+	known, err := r.zones.Known(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if !known {
+		log.Printf("Zone %s of %s/%s is no longer configured, leaving its records there", zone, svc.Namespace, svc.Name)
+		return r.forget(ctx, svc, "")
+	}
+	ctx = withZone(ctx, zone)
+
+	if svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		// published by HeadlessReconciler, which keeps its names in another annotation.
+		names := publishedHostnames(svc)
+		if r.SkipDeletes && len(names) > 0 {
+			log.Printf("Not deleting records %v of headless Service %s/%s, -allow-delete is off", names, svc.Namespace, svc.Name)
+			r.recorder.Event(svc, corev1.EventTypeNormal, recordsNotDeletedReason, recordsNotDeletedMessage)
+		}
+		for _, name := range names {
+			if !r.SkipDeletes {
+				if err := r.removeRecords(ctx, svc, name); err != nil {
+					return err
+				}
+			}
+			r.state.removed(name)
+		}
+		return r.updateFinalizer(ctx, svc, controllerutil.RemoveFinalizer)
+	}
+	dnsName, err := r.recordName(svc)
+	if err != nil && !errors.Is(err, errNameCollision) && !errors.Is(err, errInvalidHostname) {
+		return err
+	}
+	return r.release(ctx, svc, dnsName)
+}
+
+// load adds the zones of every DNSZone, for when the DNSZone controller isn't running.
+func (r *DNSZoneReconciler) load(ctx context.Context) error {
+	zones, err := dnsZones(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		if slices.Contains(r.static, zone.Spec.ZoneName) {
+			continue
+		}
+		target, err := r.newZone(ctx, zone.Spec)
+		if err != nil {
+			return err
+		}
+		r.setZone(zone.Name, &zone.Spec, target)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestCleanupReleasesAggregateRecordsAndRoutes(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	svc.Finalizers = []string{finalizer}
+	setPublishedNames(svc, []string{"web.default.svc"})
+	agg := &AggregateRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", Finalizers: []string{finalizer}},
+		Spec:       AggregateRecordSpec{Name: "api.global"},
+	}
+	setPublishedNames(agg, []string{"api.global"})
+	route := newHTTPRoute()
+	route.SetNamespace("default")
+	route.SetName("www")
+	route.SetFinalizers([]string{finalizer})
+	setPublishedHostnames(route, []string{"www.a.example"})
+
+	r, dns := newTestReconciler(t, svc, agg, route)
+	r.RecordSuffix = "svc"
+	for _, name := range []string{"web.default.svc", "api.global", "www"} {
+		dns.records[name] = []string{"10.0.0.1"}
+	}
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+	c := &Cleanup{
+		Reader:     r.Client,
+		services:   r,
+		aggregates: &AggregateRecordReconciler{Client: r.Client, dns: dns},
+		routes:     &HTTPRouteReconciler{Client: r.Client, dns: dns, Zones: []string{"a.example"}},
+		guard:      &LeaderGuard{leaderCtx: ctx},
+		done:       done,
+	}
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("manager not stopped once everything was clean")
+	}
+	if got := dns.snapshot(); len(got) > 0 {
+		t.Errorf("records left behind %v", slices.Sorted(maps.Keys(got)))
+	}
+	for _, obj := range []client.Object{svc, agg, route} {
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatal(err)
+		}
+		if controllerutil.ContainsFinalizer(obj, finalizer) {
+			t.Errorf("%s %s still has the finalizer", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Keys read from the credential secret.
+const (
+	secretTenantIDKey     = "tenantId"
+	secretClientIDKey     = "clientId"
+	secretClientSecretKey = "clientSecret"
+)
+
+// RotatingCredential is a TokenCredential whose underlying credential can be swapped at runtime.
+// The azure clients hold on to it so a rotated secret takes effect without rebuilding them.
+type RotatingCredential struct {
+	mu   sync.RWMutex
+	cred azcore.TokenCredential
+}
+
+func (c *RotatingCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.RLock()
+	cred := c.cred
+	c.mu.RUnlock()
+	if cred == nil {
+		return azcore.AccessToken{}, fmt.Errorf("no azure credential loaded yet")
+	}
+	return cred.GetToken(ctx, opts)
+}
+
+func (c *RotatingCredential) set(cred azcore.TokenCredential) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cred = cred
+}
+
+// parseObjectRef parses namespace/name.
+func parseObjectRef(ref string) (types.NamespacedName, error) {
+	ns, name, ok := strings.Cut(ref, "/")
+	if !ok || ns == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("expected namespace/name, got %q", ref)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+// credentialFromSecret builds a client secret credential from the secret's data.
+func credentialFromSecret(secret *corev1.Secret) (azcore.TokenCredential, error) {
+	var missing []string
+	for _, k := range []string{secretTenantIDKey, secretClientIDKey, secretClientSecretKey} {
+		if len(secret.Data[k]) == 0 {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, strings.Join(missing, ", "))
+	}
+	return azidentity.NewClientSecretCredential(
+		string(secret.Data[secretTenantIDKey]),
+		string(secret.Data[secretClientIDKey]),
+		string(secret.Data[secretClientSecretKey]),
+		nil,
+	)
+}
+
+// CredentialSecretReconciler reloads the RotatingCredential whenever the watched secret changes.
+type CredentialSecretReconciler struct {
+	client.Reader
+	Secret types.NamespacedName
+	cred   *RotatingCredential
+
+	loadedVersion string
+}
+
+// Load reads the secret once and installs the credential. Used at startup before the cache is running.
+func (r *CredentialSecretReconciler) Load(ctx context.Context) error {
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: r.Secret})
+	return err
+}
+
+func (r *CredentialSecretReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	if req.NamespacedName != r.Secret {
+		return reconcile.Result{}, nil
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, req.NamespacedName, &secret); err != nil {
+		return reconcile.Result{}, err
+	}
+	if secret.ResourceVersion == r.loadedVersion {
+		return reconcile.Result{}, nil
+	}
+
+	cred, err := credentialFromSecret(&secret)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	r.cred.set(cred)
+	r.loadedVersion = secret.ResourceVersion
+	log.Printf("Loaded azure credential from secret %s (resourceVersion %s)", r.Secret, secret.ResourceVersion)
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCredentialSecretUpdateReloadsCredential(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "azure", Namespace: "kube-system"},
+		Data: map[string][]byte{
+			secretTenantIDKey:     []byte("tenant"),
+			secretClientIDKey:     []byte("client"),
+			secretClientSecretKey: []byte("first"),
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(secret).Build()
+	ref := types.NamespacedName{Namespace: "kube-system", Name: "azure"}
+	rotating := &RotatingCredential{}
+	r := &CredentialSecretReconciler{Reader: c, Secret: ref, cred: rotating}
+	ctx := context.Background()
+	if err := r.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := rotating.cred
+	if first == nil {
+		t.Fatal("no credential loaded")
+	}
+
+	// an unchanged secret keeps the credential.
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: ref}); err != nil {
+		t.Fatal(err)
+	}
+	if rotating.cred != first {
+		t.Error("credential rebuilt for an unchanged secret")
+	}
+
+	secret.Data[secretClientSecretKey] = []byte("rotated")
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: ref}); err != nil {
+		t.Fatal(err)
+	}
+	if rotating.cred == first {
+		t.Error("credential not rebuilt after the secret changed")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ttlAnnotation sets a service's TTL in seconds outright, it wins over criticalityAnnotation.
+const ttlAnnotation = annotationPrefix + "ttl"
+
+// criticalityAnnotation picks a service's TTL tier, e.g. high, normal or low, from -criticality-ttls.
+const criticalityAnnotation = annotationPrefix + "criticality"
+
+// parseCriticalityTTLs parses tiers like "high=30,normal=300,low=3600".
+func parseCriticalityTTLs(v string) (map[string]int64, error) {
+	tiers := map[string]int64{}
+	for _, kv := range strings.Split(v, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		tier, ttlStr, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not tier=ttl", kv)
+		}
+		ttl, err := strconv.ParseInt(ttlStr, 10, 64)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid ttl %q for tier %s", ttlStr, tier)
+		}
+		tiers[strings.ToLower(strings.TrimSpace(tier))] = ttl
+	}
+	return tiers, nil
+}
+
+// recordTTL is the TTL svc asks for through its annotations, then the canary TTL if svc is a canary,
+// 0 to use the zone's. The zone still clamps it to -min-ttl and -max-ttl.
+func (r *ServiceReconciler) recordTTL(svc *corev1.Service) int64 {
+	if v, ok := svc.Annotations[ttlAnnotation]; ok {
+		ttl, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && ttl > 0 {
+			return ttl
+		}
+		log.Printf("Warning: ignoring %s=%q on %s/%s, it must be a positive number of seconds", ttlAnnotation, v, svc.Namespace, svc.Name)
+	}
+	tier, ok := svc.Annotations[criticalityAnnotation]
+	if !ok {
+		if r.canary.matches(svc) {
+			return r.canary.TTL
+		}
+		return 0
+	}
+	ttl, ok := r.CriticalityTTLs[strings.ToLower(tier)]
+	if !ok {
+		log.Printf("Warning: ignoring unknown %s=%q on %s/%s", criticalityAnnotation, tier, svc.Namespace, svc.Name)
+		return 0
+	}
+	return ttl
+}
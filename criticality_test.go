@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCriticalityTiersMapToTTLs(t *testing.T) {
+	tiers, err := parseCriticalityTTLs("high=30, Normal=300,low=3600,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"high", "high=0", "high=-5", "high=soon"} {
+		if _, err := parseCriticalityTTLs(bad); err == nil {
+			t.Errorf("-criticality-ttls %q was accepted", bad)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        int64 // 0 is the zone's TTL
+	}{
+		{"pay", map[string]string{criticalityAnnotation: "high"}, 30},
+		{"web", map[string]string{criticalityAnnotation: "normal"}, 300},
+		{"batch", map[string]string{criticalityAnnotation: "LOW"}, 3600},
+		{"odd", map[string]string{criticalityAnnotation: "urgent"}, 0},
+		{"plain", nil, 0},
+		// an explicit TTL wins over the tier, an invalid one falls back to it.
+		{"pinned", map[string]string{criticalityAnnotation: "low", ttlAnnotation: "42"}, 42},
+		{"bad", map[string]string{criticalityAnnotation: "high", ttlAnnotation: "-1"}, 30},
+	}
+	var objs []client.Object
+	for _, tc := range cases {
+		svc := testService(tc.name, "10.0.0.1")
+		svc.Annotations = tc.annotations
+		objs = append(objs, svc)
+	}
+	r, dns := newTestReconciler(t, objs...)
+	r.RecordSuffix = "svc"
+	r.CriticalityTTLs = tiers
+	for i, tc := range cases {
+		reconcileService(t, r, objs[i].(*corev1.Service))
+		if got := dns.ttls[tc.name+".default.svc"]; got != tc.want {
+			t.Errorf("%s ttl = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// the zone still clamps a tier's TTL to -min-ttl and -max-ttl.
+	zone, _ := newTestAzureDNSConfig(t, WithTTLBounds(60, 1800))
+	for tier, want := range map[string]int64{"high": 60, "normal": 300, "low": 1800} {
+		if got := zone.ttl(tiers[tier]); got != want {
+			t.Errorf("%s tier written with ttl %d, want %d", tier, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReconcilerState is what the service reconciler last published and the errors it last hit,
+// kept in memory for the /debug endpoint.
+type ReconcilerState struct {
+	mu         sync.Mutex
+	records    map[string][]string // record name -> published values
+	lastErrors map[string]stateError
+
+	// counts since the last summary, see takeCounts.
+	reconciles int
+	errors     map[string]int // by errorCategory
+}
+
+type stateError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+func NewReconcilerState() *ReconcilerState {
+	return &ReconcilerState{
+		records:    map[string][]string{},
+		lastErrors: map[string]stateError{},
+		errors:     map[string]int{},
+	}
+}
+
+func (s *ReconcilerState) published(name string, values []string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name] = values
+	managedRecordSets.Set(float64(len(s.records)))
+}
+
+func (s *ReconcilerState) removed(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, name)
+	managedRecordSets.Set(float64(len(s.records)))
+}
+
+// reconciled records the outcome for service, clearing its last error on success.
+func (s *ReconcilerState) reconciled(service string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reconciles++
+	if err == nil {
+		delete(s.lastErrors, service)
+		return
+	}
+	s.errors[errorCategory(err)]++
+	s.lastErrors[service] = stateError{Error: err.Error(), Time: time.Now().UTC()}
+}
+
+// takeCounts returns the reconcile and error counts since it was last called and resets them.
+func (s *ReconcilerState) takeCounts() (published, reconciles int, errors map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	published, reconciles, errors = len(s.records), s.reconciles, s.errors
+	s.reconciles, s.errors = 0, map[string]int{}
+	return published, reconciles, errors
+}
+
+// DebugServer serves a JSON dump of the controller's in memory state on /debug.
+type DebugServer struct {
+	Addr    string
+	state   *ReconcilerState
+	pause   *PausableDNS
+	backoff *AzureBackoff     // optional
+	zones   []*AzureDNSConfig // their record caches are dumped
+}
+
+type debugDump struct {
+	Config      map[string]string                `json:"config"`
+	Paused      bool                             `json:"paused"`
+	Pending     int                              `json:"pendingChanges"`
+	Records     map[string][]string              `json:"records"`
+	LastErrors  map[string]stateError            `json:"lastErrors"`
+	Backoff     map[string]backoffState          `json:"backoff"`     // by service
+	RecordCache map[string]map[string]cacheEntry `json:"recordCache"` // by zone, then type/name
+}
+
+// redactedFlags are never shown even though they should only ever hold references, not secrets.
+var redactedFlags = map[string]bool{
+	"credential-secret": true,
+	"notify-webhook":    true, // urls can carry tokens
+}
+
+func (d *DebugServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	dump := debugDump{Config: map[string]string{}}
+	flag.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if redactedFlags[f.Name] && v != "" {
+			v = "REDACTED"
+		}
+		dump.Config[f.Name] = v
+	})
+
+	d.pause.mu.Lock()
+	dump.Paused = d.pause.paused
+	dump.Pending = len(d.pause.order)
+	d.pause.mu.Unlock()
+
+	d.state.mu.Lock()
+	dump.Records = make(map[string][]string, len(d.state.records))
+	for k, v := range d.state.records {
+		dump.Records[k] = v
+	}
+	dump.LastErrors = make(map[string]stateError, len(d.state.lastErrors))
+	for k, v := range d.state.lastErrors {
+		dump.LastErrors[k] = v
+	}
+	d.state.mu.Unlock()
+
+	dump.Backoff = d.backoff.snapshot()
+	dump.RecordCache = map[string]map[string]cacheEntry{}
+	for _, zone := range d.zones {
+		if zone.cache != nil {
+			dump.RecordCache[zone.ZoneName] = zone.cache.snapshot()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		log.Printf("Failed to write debug dump: %v", err)
+	}
+}
+
+// Start implements manager.Runnable.
+func (d *DebugServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug", d)
+	srv := &http.Server{Addr: d.Addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("Serving debug state on %s/debug", d.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, followers are worth inspecting too.
+func (d *DebugServer) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDebugDumpShowsBackoffAndRecordCache(t *testing.T) {
+	zone, _ := newTestAzureDNSConfig(t, WithRecordCache(time.Minute))
+	zone.cache.set(dns.RecordTypeA, "Web.default.svc", &dns.RecordSetProperties{ARecords: []*dns.ARecord{{IPv4Address: to.StringPtr("10.0.0.1")}}}, to.StringPtr("1"))
+	zone.cache.set(dns.RecordTypeAAAA, "web.default.svc", nil, nil)
+	zone.cache.forget(dns.RecordTypeCNAME, "web.default.svc")
+	backoff := NewAzureBackoff(time.Second, time.Minute)
+	backoff.next(types.NamespacedName{Namespace: "default", Name: "web"}, 0)
+	backoff.next(types.NamespacedName{Namespace: "default", Name: "web"}, 0)
+
+	d := &DebugServer{state: NewReconcilerState(), pause: NewPausableDNS(nil, false), backoff: backoff, zones: []*AzureDNSConfig{zone}}
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest("GET", "/debug", nil))
+
+	var dump debugDump
+	if err := json.Unmarshal(rec.Body.Bytes(), &dump); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if got := dump.Backoff["default/web"]; got.Failures != 2 || got.NextDelay != "4s" {
+		t.Errorf("backoff of default/web = %+v, want 2 failures and 4s", got)
+	}
+	cache := dump.RecordCache["example.internal"]
+	if a := cache["A/web.default.svc"]; !a.Exists || !slices.Equal(a.Values, []string{"10.0.0.1"}) || a.Expired {
+		t.Errorf("cached A = %+v", a)
+	}
+	if aaaa, ok := cache["AAAA/web.default.svc"]; !ok || aaaa.Exists {
+		t.Errorf("cached AAAA = %+v, want known not to exist", aaaa)
+	}
+	if _, ok := cache["CNAME/web.default.svc"]; ok || len(cache) != 2 {
+		t.Errorf("cache dump = %+v, want forgotten entries left out", cache)
+	}
+}
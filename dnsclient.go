@@ -2,12 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
 
 	"github.com/Azure/go-autorest/autorest/to"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // AzureDNSConfig holds Azure-specific configuration for DNS updates.
@@ -15,59 +29,972 @@ type AzureDNSConfig struct {
 	SubscriptionID string
 	ResourceGroup  string
 	ZoneName       string
-	DNSClient      *dns.RecordSetsClient
-	//TTL?
+	DNSClient      recordSetsAPI
+	TTL            int64         // 0 means defaultTTL
+	TTLOverride    *atomic.Int64 // shared by every zone, wins over TTL when above 0
+	MinTTL         int64         // floor for every TTL written, 0 for none
+	MaxTTL         int64         // ceiling for every TTL written, 0 for none
+	LogWrites      bool          // log the record set azure returns after every write
+	ConfirmWrites  bool          // read every write back and fail it if azure doesn't show it yet
+	Audit          *AuditLogger  // optional audit trail of every mutation
+	ZonesClient    zonesAPI
+	OwnerID        string // stamped on every record set written but the sharedRecords, others' record sets are left alone. Empty disables
+	ApexPolicy     string // what A and AAAA records at the zone apex do, see parseApexPolicy
+	Public         bool   // a public zone, which can also hold the publicExtraRecordTypes
+	// AdoptUnowned takes over record sets without an owner when OwnerID is set, otherwise they are left
+	// alone like another owner's, e.g. records created by hand. TXT records are always adopted.
+	AdoptUnowned bool
+	// ConflictRetries is how many times a write is re-read and retried after losing a race with
+	// another writer, writes are conditional on the etag read so the last writer can't silently win.
+	ConflictRetries int
+	DryRun          bool // log the writes and deletes instead of calling azure, reads still happen
+	// CallTimeout bounds every record set call, a hung azure endpoint fails it with errAzureTimeout. 0 for none.
+	CallTimeout time.Duration
 	//Zone Id?
+
+	policy atomic.Pointer[ZonePolicy] // from the zone's tags, nil until LoadZonePolicy
+	cache  *recordCache               // optional, see WithRecordCache
+	drain  *Drain                     // optional, see WithDrain
 }
 
-// upsertDNSRecords handles both A (IPv4) and AAAA (IPv6) upserts for a given DNS name
-func (r *AzureDNSConfig) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string) error {
-	// We separate IPv4 vs. IPv6 addresses for the upsert calls.
-	var ipv4Addrs []string
-	var ipv6Addrs []string
+// Option configures an AzureDNSConfig in NewAzureDNSConfig.
+type Option func(*AzureDNSConfig)
+
+// WithTTL sets the zone's default TTL, 0 for defaultTTL.
+func WithTTL(ttl int64) Option { return func(r *AzureDNSConfig) { r.TTL = ttl } }
+
+// WithTTLOverride shares a runtime TTL override between zones, see TTLOverride.
+func WithTTLOverride(override *atomic.Int64) Option {
+	return func(r *AzureDNSConfig) { r.TTLOverride = override }
+}
+
+// WithTTLBounds clamps every TTL written, 0 for no floor or ceiling.
+func WithTTLBounds(minTTL, maxTTL int64) Option {
+	return func(r *AzureDNSConfig) { r.MinTTL, r.MaxTTL = minTTL, maxTTL }
+}
+
+func WithDryRun(dryRun bool) Option { return func(r *AzureDNSConfig) { r.DryRun = dryRun } }
+
+// WithOwnerID turns on record set ownership, see OwnerID and AdoptUnowned.
+func WithOwnerID(id string, adoptUnowned bool) Option {
+	return func(r *AzureDNSConfig) { r.OwnerID, r.AdoptUnowned = id, adoptUnowned }
+}
+
+func WithZonesClient(zones zonesAPI) Option { return func(r *AzureDNSConfig) { r.ZonesClient = zones } }
+
+func WithAudit(audit *AuditLogger) Option { return func(r *AzureDNSConfig) { r.Audit = audit } }
+
+// WithWriteChecks sets LogWrites and ConfirmWrites.
+func WithWriteChecks(logWrites, confirmWrites bool) Option {
+	return func(r *AzureDNSConfig) { r.LogWrites, r.ConfirmWrites = logWrites, confirmWrites }
+}
+
+func WithConflictRetries(n int) Option { return func(r *AzureDNSConfig) { r.ConflictRetries = n } }
+
+func WithApexPolicy(policy string) Option { return func(r *AzureDNSConfig) { r.ApexPolicy = policy } }
+
+// WithPublic marks the zone as a public one.
+func WithPublic(public bool) Option { return func(r *AzureDNSConfig) { r.Public = public } }
+
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(r *AzureDNSConfig) { r.CallTimeout = timeout }
+}
+
+// NewAzureDNSConfig validates the zone and options and returns the config for writing to it.
+func NewAzureDNSConfig(subscriptionID, resourceGroup, zoneName string, client recordSetsAPI, opts ...Option) (*AzureDNSConfig, error) {
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("a subscription is required")
+	}
+	if resourceGroup == "" {
+		return nil, fmt.Errorf("a resource group is required")
+	}
+	zoneName = strings.TrimSuffix(strings.TrimSpace(zoneName), ".")
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(zoneName)); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid zone name %q: %s", zoneName, strings.Join(errs, ", "))
+	}
+	r := &AzureDNSConfig{SubscriptionID: subscriptionID, ResourceGroup: resourceGroup, ZoneName: zoneName, DNSClient: client}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.TTL < 0 || r.MinTTL < 0 || r.MaxTTL < 0 {
+		return nil, fmt.Errorf("TTLs can't be negative")
+	}
+	if r.MinTTL > 0 && r.MaxTTL > 0 && r.MinTTL > r.MaxTTL {
+		return nil, fmt.Errorf("min TTL %d is above max TTL %d", r.MinTTL, r.MaxTTL)
+	}
+	if r.ConflictRetries < 0 {
+		return nil, fmt.Errorf("conflict retries can't be negative")
+	}
+	if r.CallTimeout < 0 {
+		return nil, fmt.Errorf("call timeout can't be negative")
+	}
+	if r.CallTimeout > 0 {
+		r.DNSClient = timeoutRecordSets{recordSetsAPI: r.DNSClient, timeout: r.CallTimeout}
+	}
+	if r.drain != nil {
+		// outside the timeout so a drained write still gets CallTimeout.
+		r.DNSClient = drainingRecordSets{recordSetsAPI: r.DNSClient, drain: r.drain}
+	}
+	if r.ApexPolicy != "" {
+		if err := parseApexPolicy(r.ApexPolicy); err != nil {
+			return nil, fmt.Errorf("invalid apex policy: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// errAzureTimeout means an azure call ran past CallTimeout. It is retried like throttling, see retryHint.
+var errAzureTimeout = errors.New("azure call timed out")
+
+// timeoutRecordSets gives every call its own deadline derived from the caller's context.
+type timeoutRecordSets struct {
+	recordSetsAPI
+	timeout time.Duration
+}
+
+// call runs fn with the timeout and tells a timeout apart from the caller giving up.
+func (c timeoutRecordSets) call(ctx context.Context, fn func(context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := fn(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %w", errAzureTimeout, c.timeout, err)
+	}
+	return err
+}
+
+func (c timeoutRecordSets) Get(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientGetOptions) (resp dns.RecordSetsClientGetResponse, err error) {
+	err = c.call(ctx, func(ctx context.Context) error {
+		resp, err = c.recordSetsAPI.Get(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, options)
+		return err
+	})
+	return resp, err
+}
+
+func (c timeoutRecordSets) CreateOrUpdate(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, parameters dns.RecordSet, options *dns.RecordSetsClientCreateOrUpdateOptions) (resp dns.RecordSetsClientCreateOrUpdateResponse, err error) {
+	err = c.call(ctx, func(ctx context.Context) error {
+		resp, err = c.recordSetsAPI.CreateOrUpdate(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, parameters, options)
+		return err
+	})
+	return resp, err
+}
+
+func (c timeoutRecordSets) Delete(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientDeleteOptions) (resp dns.RecordSetsClientDeleteResponse, err error) {
+	err = c.call(ctx, func(ctx context.Context) error {
+		resp, err = c.recordSetsAPI.Delete(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, options)
+		return err
+	})
+	return resp, err
+}
+
+// NewListPager bounds each page fetch by the timeout.
+func (c timeoutRecordSets) NewListPager(resourceGroupName, privateZoneName string, options *dns.RecordSetsClientListOptions) *runtime.Pager[dns.RecordSetsClientListResponse] {
+	pager := c.recordSetsAPI.NewListPager(resourceGroupName, privateZoneName, options)
+	return runtime.NewPager(runtime.PagingHandler[dns.RecordSetsClientListResponse]{
+		More: func(dns.RecordSetsClientListResponse) bool { return pager.More() },
+		Fetcher: func(ctx context.Context, _ *dns.RecordSetsClientListResponse) (page dns.RecordSetsClientListResponse, err error) {
+			err = c.call(ctx, func(ctx context.Context) error {
+				page, err = pager.NextPage(ctx)
+				return err
+			})
+			return page, err
+		},
+	})
+}
+
+// defaultTTL is the default for -ttl.
+const defaultTTL = 300
+
+// ttl picks the TTL to write, recordTTL wins when above 0, and clamps it to MinTTL and MaxTTL.
+func (r *AzureDNSConfig) ttl(recordTTL int64) int64 {
+	ttl := r.zoneTTL()
+	if recordTTL > 0 {
+		ttl = recordTTL
+	}
+	if r.MinTTL > 0 {
+		ttl = max(ttl, r.MinTTL)
+	}
+	if r.MaxTTL > 0 {
+		ttl = min(ttl, r.MaxTTL)
+	}
+	return ttl
+}
+
+func (r *AzureDNSConfig) zoneTTL() int64 {
+	if r.TTLOverride != nil && r.TTLOverride.Load() > 0 {
+		return r.TTLOverride.Load()
+	}
+	if p := r.policy.Load(); p != nil && p.TTL > 0 {
+		return p.TTL
+	}
+	if r.TTL > 0 {
+		return r.TTL
+	}
+	return defaultTTL
+}
+
+// SOAMinimumTTL reads the minimum TTL from the zone's SOA record.
+func (r *AzureDNSConfig) SOAMinimumTTL(ctx context.Context) (int64, error) {
+	resp, err := r.DNSClient.Get(ctx, r.ResourceGroup, r.ZoneName, dns.RecordTypeSOA, "@", &dns.RecordSetsClientGetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Properties == nil || resp.Properties.SoaRecord == nil || resp.Properties.SoaRecord.MinimumTTL == nil {
+		return 0, fmt.Errorf("zone %s has no SOA minimum TTL", r.ZoneName)
+	}
+	return *resp.Properties.SoaRecord.MinimumTTL, nil
+}
+
+// UseSOAMinimumTTL makes the zone's SOA minimum TTL its default TTL, keeping TTL if the SOA can't be read.
+func (r *AzureDNSConfig) UseSOAMinimumTTL(ctx context.Context) {
+	ttl, err := r.SOAMinimumTTL(ctx)
+	if err != nil {
+		log.Printf("Unable to read SOA minimum TTL for zone %s, using %d: %v", r.ZoneName, r.zoneTTL(), err)
+		return
+	}
+	log.Printf("Using SOA minimum TTL %d for zone %s", ttl, r.ZoneName)
+	r.TTL = ttl
+}
+
+// WaitForZone polls until the zone exists, for up to timeout. A zone created alongside the controller,
+// e.g. by the same IaC apply, can 404 for a while. Other errors are returned straight away.
+func (r *AzureDNSConfig) WaitForZone(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		_, err := r.ZonesClient.Get(ctx, r.ResourceGroup, r.ZoneName, &dns.PrivateZonesClientGetOptions{})
+		if !isNotFound(err) {
+			return err
+		}
+		log.Printf("Zone %s not found yet, retrying", r.ZoneName)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("zone %s still not found after %s: %w", r.ZoneName, timeout, err)
+		case <-time.After(zoneWaitInterval):
+		}
+	}
+}
+
+// zoneWaitInterval is how often WaitForZone looks for the zone.
+var zoneWaitInterval = 10 * time.Second
+
+// versionRecordName is the TXT record holding the spec version of the records the controller writes.
+const versionRecordName = "dns-version"
+
+// versionAttempts is how many times SetTXTVersion tries before giving up.
+const versionAttempts = 5
+
+// SetTXTVersion writes specVersion to the dns-version TXT record, leaving it alone if it already
+// holds it. Failures are retried with backoff so a blip at startup doesn't take the controller down.
+func (r *AzureDNSConfig) SetTXTVersion(ctx context.Context, version string) error {
+	delay := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := r.setTXTVersion(ctx, version)
+		if err == nil || attempt == versionAttempts {
+			return err
+		}
+		after, _, _ := retryHint(err)
+		wait := max(delay, after)
+		log.Printf("Failed to write the %s TXT record to zone %s, retrying in %s: %v", versionRecordName, r.ZoneName, wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func (r *AzureDNSConfig) setTXTVersion(ctx context.Context, version string) error {
+	current, err := r.DNSClient.Get(ctx, r.ResourceGroup, r.ZoneName, dns.RecordTypeTXT, versionRecordName, &dns.RecordSetsClientGetOptions{})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if err == nil && current.Properties != nil && slices.Equal(recordSetValues(current.Properties), []string{fmt.Sprintf("%q", version)}) {
+		debugf("%s TXT record in zone %s is already %s", versionRecordName, r.ZoneName, version)
+		return nil
+	}
+	if r.DryRun {
+		log.Printf("Dry run: not writing the %s TXT record to zone %s", versionRecordName, r.ZoneName)
+		return nil
+	}
+	// goes through UpsertTXTRecord so it is audited like every other write.
+	return r.UpsertTXTRecord(ctx, versionRecordName, []string{version})
+}
+
+// ReadyCheck is a healthz.Checker that reads the dns-version TXT record, so a pod whose credentials
+// or zone are inaccessible reports not ready. The record may not be written yet, e.g. in a dry run,
+// then the zone itself is read instead.
+func (r *AzureDNSConfig) ReadyCheck(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	defer cancel()
+	_, err := r.DNSClient.Get(ctx, r.ResourceGroup, r.ZoneName, dns.RecordTypeTXT, versionRecordName, &dns.RecordSetsClientGetOptions{})
+	if isNotFound(err) {
+		_, err = r.ZonesClient.Get(ctx, r.ResourceGroup, r.ZoneName, &dns.PrivateZonesClientGetOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("zone %s is not accessible: %w", r.ZoneName, err)
+	}
+	return nil
+}
+
+// supportedAPIVersions are the private DNS API versions the record set calls are known to work against.
+var supportedAPIVersions = []string{"2018-09-01", "2020-01-01", "2020-06-01", "2024-06-01"}
+
+// recordSetsClientOptions pins the client to apiVersion and rate limits it with limiter.
+// Empty apiVersion means use the SDK default and a nil limiter means no rate limit.
+// adaptive lowers the limit when azure throttles and recovers it as requests succeed.
+func recordSetsClientOptions(apiVersion string, limiter *rate.Limiter, adaptive bool) (*arm.ClientOptions, error) {
+	opts := &arm.ClientOptions{}
+	if limiter != nil {
+		p := rateLimitPolicy{limiter: limiter}
+		if adaptive {
+			p.adaptive = newAIMDLimiter(limiter)
+		}
+		opts.PerRetryPolicies = append(opts.PerRetryPolicies, p)
+	}
+	if apiVersion == "" {
+		return opts, nil
+	}
+	for _, v := range supportedAPIVersions {
+		if v == apiVersion {
+			opts.APIVersion = apiVersion
+			return opts, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported azure api version %q, must be one of %s", apiVersion, strings.Join(supportedAPIVersions, ", "))
+}
+
+// Trailing dot policy: record names are sent to azure relative to the zone with no trailing dot,
+// whether they were given relative or as an FQDN with or without one. Record targets (CNAME, PTR, SRV)
+// are always FQDNs and are written and compared without a trailing dot so both spellings are the same record.
+
+// relativeName normalizes dnsName to the relative form azure expects, "@" for the zone apex.
+func (r *AzureDNSConfig) relativeName(dnsName string) (string, error) {
+	name := strings.TrimSuffix(dnsName, ".")
+	if strings.EqualFold(name, r.ZoneName) {
+		return "@", nil
+	}
+	if len(name) > len(r.ZoneName)+1 && strings.EqualFold(name[len(name)-len(r.ZoneName)-1:], "."+r.ZoneName) {
+		name = name[:len(name)-len(r.ZoneName)-1]
+	}
+	if name == "" || slices.Contains(strings.Split(name, "."), "") {
+		return "", fmt.Errorf("invalid record name %q", dnsName)
+	}
+	return name, nil
+}
+
+// Zone apex policies for -apex-policy. redirect is followed by =<name>.
+const (
+	apexReject   = "reject"
+	apexAllow    = "allow"
+	apexRedirect = "redirect"
+)
+
+// errApexName is returned for an A or AAAA write at the zone apex when ApexPolicy rejects it.
+var errApexName = errors.New("record name is the zone apex")
+
+// parseApexPolicy validates an -apex-policy: reject, allow or redirect=<name> where name is relative to the zone.
+func parseApexPolicy(v string) error {
+	policy, target, _ := strings.Cut(v, "=")
+	switch policy {
+	case apexReject, apexAllow:
+		if target != "" {
+			return fmt.Errorf("%s takes no name", policy)
+		}
+	case apexRedirect:
+		if target == "" || target == "@" || slices.Contains(strings.Split(target, "."), "") {
+			return fmt.Errorf("invalid redirect name %q", target)
+		}
+	default:
+		return fmt.Errorf("unknown policy %q, must be %s, %s or %s=<name>", policy, apexReject, apexAllow, apexRedirect)
+	}
+	return nil
+}
+
+// errNameTooLong is returned by addressName for a name that isn't a legal FQDN once the zone is appended.
+var errNameTooLong = errors.New("record name is too long for the zone")
+
+// neverWritten reports whether addressName rejected a name, so there are no records to remove at it.
+func neverWritten(err error) bool {
+	return errors.Is(err, errApexName) || errors.Is(err, errNameTooLong)
+}
+
+// addressName is relativeName for A and AAAA records. A name that would land on the zone apex, say
+// from a template that renders to nothing but the zone, is rejected or redirected by ApexPolicy.
+// One whose FQDN in the zone is over 253 characters or has a label over 63 is rejected.
+func (r *AzureDNSConfig) addressName(dnsName string) (string, error) {
+	name, err := r.relativeName(dnsName)
+	if err != nil {
+		return "", err
+	}
+	if name != "@" {
+		fqdn := name + "." + r.ZoneName
+		if len(fqdn) > validation.DNS1123SubdomainMaxLength {
+			return "", fmt.Errorf("%w: %s is %d characters, at most %d are allowed", errNameTooLong, fqdn, len(fqdn), validation.DNS1123SubdomainMaxLength)
+		}
+		for _, label := range strings.Split(fqdn, ".") {
+			if len(label) > validation.DNS1123LabelMaxLength {
+				return "", fmt.Errorf("%w: label %s of %s is over %d characters", errNameTooLong, label, fqdn, validation.DNS1123LabelMaxLength)
+			}
+		}
+		return name, nil
+	}
+	switch policy, target, _ := strings.Cut(r.ApexPolicy, "="); policy {
+	case apexAllow:
+		return name, nil
+	case apexRedirect:
+		return target, nil
+	default:
+		return "", fmt.Errorf("%w %s, see -apex-policy", errApexName, r.ZoneName)
+	}
+}
+
+// normalizeTarget puts a record target in its canonical form, an FQDN without the trailing dot.
+func normalizeTarget(target string) string {
+	return strings.TrimSuffix(target, ".")
+}
+
+// upsertDNSRecords handles both A (IPv4) and AAAA (IPv6) upserts for a given DNS name.
+// A ttl above 0 overrides the zone's TTL for these records. changed counts the record sets written or
+// deleted, 0 when azure already held ipList.
+func (r *AzureDNSConfig) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (changed int, err error) {
+	dnsName, err = r.addressName(dnsName)
+	if err != nil {
+		return 0, err
+	}
 	for _, ip := range ipList {
-		if strings.Count(ip, ":") >= 2 {
-			ipv6Addrs = append(ipv6Addrs, ip)
-		} else {
-			ipv4Addrs = append(ipv4Addrs, ip)
+		if net.ParseIP(ip) == nil {
+			log.Printf("Skipping %q for %s in zone %s, it isn't an IP address", ip, dnsName, r.ZoneName)
+		}
+	}
+	// We separate IPv4 vs. IPv6 addresses for the upsert calls.
+	ipv4Addrs, ipv6Addrs := splitIPFamilies(ipList)
+
+	// A CNAME can't coexist with address records, e.g. left over from an ExternalName service.
+	if len(ipv4Addrs)+len(ipv6Addrs) > 0 {
+		removed, err := r.removeConflictingRecordSet(ctx, dns.RecordTypeCNAME, dnsName)
+		if err != nil {
+			return 0, fmt.Errorf("error removing conflicting CNAME record: %w", err)
+		}
+		if removed {
+			changed++
 		}
 	}
 
-	// Upsert A records (if any)
+	// ipList is authoritative so a family with no addresses has its record set removed.
+	// Both families are attempted even if one fails, so the error says exactly which are stale.
+	results := map[dns.RecordType]error{}
+	var wrote bool
 	if len(ipv4Addrs) > 0 {
-		if err := r.createOrUpdateARecordSet(ctx, dnsName, ipv4Addrs); err != nil {
-			return fmt.Errorf("error upserting A records: %w", err)
-		}
+		wrote, results[dns.RecordTypeA] = r.createOrUpdateARecordSet(ctx, dnsName, ipv4Addrs, ttl)
+	} else {
+		wrote, results[dns.RecordTypeA] = r.deleteRecordSet(ctx, dns.RecordTypeA, dnsName)
+	}
+	if wrote {
+		changed++
 	}
-	// Upsert AAAA records (if any)
 	if len(ipv6Addrs) > 0 {
-		if err := r.createOrUpdateAAAARecordSet(ctx, dnsName, ipv6Addrs); err != nil {
-			return fmt.Errorf("error upserting AAAA records: %w", err)
+		wrote, results[dns.RecordTypeAAAA] = r.createOrUpdateAAAARecordSet(ctx, dnsName, ipv6Addrs, ttl)
+	} else {
+		wrote, results[dns.RecordTypeAAAA] = r.deleteRecordSet(ctx, dns.RecordTypeAAAA, dnsName)
+	}
+	if wrote {
+		changed++
+	}
+	for _, err := range results {
+		if err != nil {
+			return changed, &PartialUpsertError{Name: dnsName, Results: results}
 		}
 	}
+	return changed, nil
+}
 
-	// If there are no addresses, you might want to delete the DNS record or set TTL=0.
-	// That is left as an exercise for your environment's preference.
+// PartialUpsertError is returned by UpsertDNSRecords when any record type at a name failed to be written.
+// Nothing is rolled back, the record types that succeeded already hold the desired addresses and the
+// reconcile is retried until the rest do too. It unwraps to the failures so retryHint still sees them.
+type PartialUpsertError struct {
+	Name string
+	// Results has every record type attempted, nil for the ones written.
+	Results map[dns.RecordType]error
+}
 
-	return nil
+func (e *PartialUpsertError) Error() string {
+	var ok, failed []string
+	for _, rt := range slices.Sorted(maps.Keys(e.Results)) {
+		if err := e.Results[rt]; err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", rt, err))
+		} else {
+			ok = append(ok, string(rt))
+		}
+	}
+	msg := fmt.Sprintf("error upserting records for %s: %s", e.Name, strings.Join(failed, "; "))
+	if len(ok) > 0 {
+		msg += fmt.Sprintf(" (%s written)", strings.Join(ok, ","))
+	}
+	return msg
+}
+
+func (e *PartialUpsertError) Unwrap() []error {
+	var errs []error
+	for _, rt := range slices.Sorted(maps.Keys(e.Results)) {
+		if err := e.Results[rt]; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Failed lists the record types that weren't written.
+func (e *PartialUpsertError) Failed() []dns.RecordType {
+	var failed []dns.RecordType
+	for _, rt := range slices.Sorted(maps.Keys(e.Results)) {
+		if e.Results[rt] != nil {
+			failed = append(failed, rt)
+		}
+	}
+	return failed
+}
+
+// errConflictingRecord means a record set of another type has to be removed from a name before writing to it,
+// but it belongs to another owner. It wraps the errOwnedByOther saying whose it is.
+var errConflictingRecord = errors.New("conflicting record set can't be removed")
+
+// removeConflictingRecordSet deletes the rt record set at dnsName if there is one, reporting whether it did.
+// One owned by someone else is left alone and errConflictingRecord returned, writing next to it would leave
+// the name inconsistent.
+func (r *AzureDNSConfig) removeConflictingRecordSet(ctx context.Context, rt dns.RecordType, dnsName string) (bool, error) {
+	current, _, err := r.readRecordSet(ctx, rt, dnsName)
+	if err != nil {
+		return false, err
+	}
+	if current.Properties == nil {
+		return false, nil
+	}
+	if err := r.ownerConflict(rt, dnsName, current.Properties); err != nil {
+		return false, fmt.Errorf("%w: %w", errConflictingRecord, err)
+	}
+	log.Printf("Replacing conflicting %s record for %s", rt, dnsName)
+	return r.deleteRecordSet(ctx, rt, dnsName)
+}
+
+// deleteRecordSet removes a single record set, treating one that doesn't exist as already deleted.
+// It reports whether azure held a record set that was deleted.
+func (r *AzureDNSConfig) deleteRecordSet(ctx context.Context, rt dns.RecordType, dnsName string) (bool, error) {
+	if props, _, ok := r.cache.get(rt, dnsName); ok && props == nil {
+		return false, nil
+	}
+	deleted, err := r.delete(ctx, rt, dnsName)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return deleted, err
+}
+
+// delete removes a single record set. Every azure delete goes through here so it is audited, with the
+// values it held. The record set is only read first for the owner check or the audit trail.
+func (r *AzureDNSConfig) delete(ctx context.Context, rt dns.RecordType, dnsName string) (bool, error) {
+	var old []string
+	if r.OwnerID != "" || r.Audit != nil {
+		current, _, err := r.readRecordSet(ctx, rt, dnsName)
+		if err != nil {
+			return false, err
+		}
+		if err := r.ownerConflict(rt, dnsName, current.Properties); errors.Is(err, errOwnedByOther) {
+			log.Printf("Not deleting %s %s: %v", rt, dnsName, err)
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if current.Properties == nil {
+			return false, nil
+		}
+		old = recordSetValues(current.Properties)
+	}
+	if r.DryRun {
+		log.Printf("Dry run: would delete %s %s in zone %s", rt, dnsName, r.ZoneName)
+		return false, nil
+	}
+	// azure answers 204 rather than 200 when there was no record set to delete.
+	var raw *http.Response
+	_, err := r.DNSClient.Delete(runtime.WithCaptureResponse(ctx, &raw), r.ResourceGroup, r.ZoneName, rt, dnsName, &dns.RecordSetsClientDeleteOptions{})
+	r.Audit.Record(auditDelete, r.ZoneName, rt, dnsName, old, nil, err)
+	if err == nil || isNotFound(err) {
+		r.cache.set(rt, dnsName, nil, nil)
+	} else {
+		r.cache.forget(rt, dnsName)
+	}
+	return err == nil && (raw == nil || raw.StatusCode != http.StatusNoContent), err
 }
 
 func (r *AzureDNSConfig) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	dnsName, err := r.addressName(dnsName)
+	if neverWritten(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	// Delete A records
-	if _, err := r.DNSClient.Delete(ctx, r.ResourceGroup, r.ZoneName, dns.RecordTypeA, dnsName, &dns.RecordSetsClientDeleteOptions{}); err != nil {
+	if _, err := r.deleteRecordSet(ctx, dns.RecordTypeA, dnsName); err != nil {
 		return fmt.Errorf("error deleting A records: %w", err)
 	}
 
 	// Delete AAAA records
-	if _, err := r.DNSClient.Delete(ctx, r.ResourceGroup, r.ZoneName, dns.RecordTypeAAAA, dnsName, &dns.RecordSetsClientDeleteOptions{}); err != nil {
+	if _, err := r.deleteRecordSet(ctx, dns.RecordTypeAAAA, dnsName); err != nil {
 		return fmt.Errorf("error deleting AAAA records: %w", err)
 	}
 
 	return nil
 }
 
+// UpsertTXTRecord writes a TXT record set with one string per value. No values removes it instead.
+func (r *AzureDNSConfig) UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error {
+	dnsName, err := r.relativeName(dnsName)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		_, err := r.deleteRecordSet(ctx, dns.RecordTypeTXT, dnsName)
+		return err
+	}
+	var txt []*string
+	for _, v := range values {
+		txt = append(txt, to.StringPtr(v))
+	}
+
+	rs := dns.RecordSet{
+		Properties: &dns.RecordSetProperties{
+			TTL:        to.Int64Ptr(r.ttl(0)),
+			TxtRecords: []*dns.TxtRecord{{Value: txt}},
+		},
+	}
+
+	_, err = r.writeRecordSet(ctx, dns.RecordTypeTXT, dnsName, rs)
+	return err
+}
+
+// UpsertCNAMERecord points dnsName at target, an FQDN. A CNAME can't coexist with other records so the
+// A and AAAA record sets at dnsName are removed first. An empty target removes the CNAME instead.
+func (r *AzureDNSConfig) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	dnsName, err := r.addressName(dnsName)
+	if neverWritten(err) && target == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		if _, err := r.deleteRecordSet(ctx, dns.RecordTypeCNAME, dnsName); err != nil {
+			return fmt.Errorf("error deleting CNAME record: %w", err)
+		}
+		return nil
+	}
+	for _, rt := range []dns.RecordType{dns.RecordTypeA, dns.RecordTypeAAAA} {
+		if _, err := r.deleteRecordSet(ctx, rt, dnsName); err != nil {
+			return fmt.Errorf("error removing conflicting %s records: %w", rt, err)
+		}
+	}
+	rs := dns.RecordSet{
+		Properties: &dns.RecordSetProperties{
+			TTL:         to.Int64Ptr(r.ttl(ttl)),
+			CnameRecord: &dns.CnameRecord{Cname: to.StringPtr(normalizeTarget(target))},
+		},
+	}
+	if _, err := r.writeRecordSet(ctx, dns.RecordTypeCNAME, dnsName, rs); err != nil {
+		return fmt.Errorf("error upserting CNAME record: %w", err)
+	}
+	return nil
+}
+
+// writeRecordSet creates or replaces a record set. Every azure write goes through here so it is audited.
+// The record set is read first, from the cache when there is one, and the write skipped when azure already holds
+// the same values, TTL and metadata. Otherwise the write is conditional on the record set being unchanged since
+// it was read, see ConflictRetries. It reports whether azure was written.
+func (r *AzureDNSConfig) writeRecordSet(ctx context.Context, rt dns.RecordType, dnsName string, rs dns.RecordSet) (bool, error) {
+	if !r.policy.Load().allows(rt) {
+		log.Printf("Not writing %s record %s, zone %s policy doesn't allow %s records", rt, dnsName, r.ZoneName, rt)
+		return false, nil
+	}
+	if r.OwnerID != "" && !sharedRecord(rt, dnsName) {
+		if rs.Properties.Metadata == nil {
+			rs.Properties.Metadata = map[string]*string{}
+		}
+		rs.Properties.Metadata[ownerMetadataKey] = to.StringPtr(r.OwnerID)
+		if source := recordSource(ctx); source != "" {
+			rs.Properties.Metadata[sourceMetadataKey] = to.StringPtr(source)
+		}
+	}
+	var resp dns.RecordSetsClientCreateOrUpdateResponse
+	var err error
+	var old []string // what the write replaced, for the audit trail
+	for attempt := 0; ; attempt++ {
+		var current dns.RecordSet
+		var cached bool
+		current, cached, err = r.readRecordSet(ctx, rt, dnsName)
+		if err != nil {
+			return false, err
+		}
+		old = recordSetValues(current.Properties)
+		if r.OwnerID != "" {
+			if err := r.ownerConflict(rt, dnsName, current.Properties); err != nil {
+				return false, err
+			}
+		}
+		if sameRecordSet(current.Properties, rs.Properties) {
+			unchangedWrites.WithLabelValues(r.ZoneName).Inc()
+			debugf("%s %s in zone %s is unchanged, not writing it", rt, dnsName, r.ZoneName)
+			return false, nil
+		}
+		if r.DryRun {
+			log.Printf("Dry run: would write %s %s in zone %s ttl=%d %v", rt, dnsName, r.ZoneName, to.Int64(rs.Properties.TTL), recordSetValues(rs.Properties))
+			return false, nil
+		}
+
+		// the write only lands if nobody changed the record set since it was read, or created it if it was missing.
+		opts := &dns.RecordSetsClientCreateOrUpdateOptions{IfNoneMatch: to.StringPtr("*")}
+		if current.Etag != nil {
+			opts = &dns.RecordSetsClientCreateOrUpdateOptions{IfMatch: current.Etag}
+		}
+		resp, err = r.DNSClient.CreateOrUpdate(ctx, r.ResourceGroup, r.ZoneName, rt, dnsName, rs, opts)
+		if isPreconditionFailed(err) && cached {
+			// the cache was stale rather than another writer racing, that doesn't use up a retry.
+			debugf("Cached %s %s in zone %s was stale, reading it", rt, dnsName, r.ZoneName)
+			r.cache.forget(rt, dnsName)
+			attempt--
+			continue
+		}
+		if isPreconditionFailed(err) && attempt < r.ConflictRetries {
+			r.cache.forget(rt, dnsName)
+			log.Printf("%s %s in zone %s changed while writing it, retrying", rt, dnsName, r.ZoneName)
+			continue
+		}
+		if err == nil && resp.Properties == nil {
+			// a success always echoes the record set back, don't assume the write landed without it.
+			err = fmt.Errorf("%w: writing %s %s", errEmptyResponse, rt, dnsName)
+		}
+		break
+	}
+	values := recordSetValues(rs.Properties)
+	r.Audit.Record(auditUpsert, r.ZoneName, rt, dnsName, old, values, err)
+	if err != nil {
+		r.cache.forget(rt, dnsName)
+		return false, err
+	}
+	r.cache.set(rt, dnsName, resp.Properties, resp.Etag)
+	recordSetSize.WithLabelValues(string(rt)).Observe(float64(len(values)))
+	if r.LogWrites {
+		log.Printf("Wrote %s", formatRecordSet(r.ZoneName, rt, dnsName, resp.RecordSet))
+	}
+	if r.ConfirmWrites {
+		if err := r.confirmWrite(ctx, rt, dnsName, rs); err != nil {
+			r.cache.forget(rt, dnsName)
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// sameRecordSet reports whether the record set azure has, nil when there is none, already matches want.
+// Values are compared in sorted order, azure doesn't keep the order they were written in.
+func sameRecordSet(current, want *dns.RecordSetProperties) bool {
+	if current == nil || to.Int64(current.TTL) != to.Int64(want.TTL) {
+		return false
+	}
+	if len(current.Metadata) != len(want.Metadata) {
+		return false
+	}
+	for k, v := range want.Metadata {
+		if got, ok := current.Metadata[k]; !ok || to.String(got) != to.String(v) {
+			return false
+		}
+	}
+	return slices.Equal(slices.Sorted(slices.Values(recordSetValues(current))), slices.Sorted(slices.Values(recordSetValues(want))))
+}
+
+// formatRecordSet renders a record set as stored in azure, e.g. "A foo.default.svc.cluster.local ttl=300 [10.0.0.1]".
+func formatRecordSet(zone string, rt dns.RecordType, dnsName string, rs dns.RecordSet) string {
+	name := dnsName + "." + zone
+	if rs.Properties == nil {
+		return fmt.Sprintf("%s %s (no properties returned)", rt, name)
+	}
+	p := rs.Properties
+	if p.Fqdn != nil {
+		name = *p.Fqdn
+	}
+	return fmt.Sprintf("%s %s ttl=%d %v", rt, name, to.Int64(p.TTL), recordSetValues(p))
+}
+
+// recordSetValues flattens every record in p to a string, none for nil properties.
+func recordSetValues(p *dns.RecordSetProperties) []string {
+	if p == nil {
+		return nil
+	}
+	var values []string
+	for _, a := range p.ARecords {
+		values = append(values, to.String(a.IPv4Address))
+	}
+	for _, a := range p.AaaaRecords {
+		values = append(values, to.String(a.IPv6Address))
+	}
+	if p.CnameRecord != nil {
+		values = append(values, normalizeTarget(to.String(p.CnameRecord.Cname)))
+	}
+	for _, ptr := range p.PtrRecords {
+		values = append(values, normalizeTarget(to.String(ptr.Ptrdname)))
+	}
+	for _, mx := range p.MxRecords {
+		values = append(values, fmt.Sprintf("%d %s", to.Int32(mx.Preference), normalizeTarget(to.String(mx.Exchange))))
+	}
+	for _, srv := range p.SrvRecords {
+		values = append(values, fmt.Sprintf("%d %d %d %s", to.Int32(srv.Priority), to.Int32(srv.Weight), to.Int32(srv.Port), normalizeTarget(to.String(srv.Target))))
+	}
+	for _, txt := range p.TxtRecords {
+		for _, v := range txt.Value {
+			values = append(values, fmt.Sprintf("%q", to.String(v)))
+		}
+	}
+	return values
+}
+
+// ownerMetadataKey holds the -controller-id of the instance that wrote a record set.
+const ownerMetadataKey = "owner"
+
+// sourceMetadataKey holds the object a record set was published for, e.g. service/default/web, next to the owner.
+const sourceMetadataKey = "source"
+
+type recordSourceKey struct{}
+
+// withRecordSource tells the writes made with ctx which object they are for, see sourceMetadataKey.
+func withRecordSource(ctx context.Context, kind string, obj types.NamespacedName) context.Context {
+	return context.WithValue(ctx, recordSourceKey{}, kind+"/"+obj.Namespace+"/"+obj.Name)
+}
+
+func recordSource(ctx context.Context) string {
+	source, _ := ctx.Value(recordSourceKey{}).(string)
+	return source
+}
+
+// errOwnedByOther means a record set was written by another controller instance and must not be touched.
+var errOwnedByOther = errors.New("record set is owned by another controller")
+
+// ownerConflict returns errOwnedByOther if current, the rt record set at dnsName, carries another instance's
+// owner. Nil properties are a record set that doesn't exist. Record sets without an owner, e.g. written before
+// ownership was turned on, are adopted unless AdoptUnowned is off. Nothing conflicts without an OwnerID, nor
+// at a sharedRecord.
+func (r *AzureDNSConfig) ownerConflict(rt dns.RecordType, dnsName string, current *dns.RecordSetProperties) error {
+	if current == nil || r.OwnerID == "" || sharedRecord(rt, dnsName) {
+		return nil
+	}
+	owner := to.String(current.Metadata[ownerMetadataKey])
+	if owner != "" && owner != r.OwnerID {
+		ownershipConflicts.WithLabelValues(r.ZoneName).Inc()
+		return fmt.Errorf("%w: %s %s belongs to %q", errOwnedByOther, rt, dnsName, owner)
+	}
+	// the controller's own TXT records (dns-version, ...) predate any owner.
+	if owner == "" && !r.AdoptUnowned && rt != dns.RecordTypeTXT {
+		ownershipConflicts.WithLabelValues(r.ZoneName).Inc()
+		return fmt.Errorf("%w: %s %s has no owner, -adopt-unowned is off", errOwnedByOther, rt, dnsName)
+	}
+	return nil
+}
+
+// sharedRecord reports whether the rt record set at dnsName is one of the controller's own TXT records,
+// see reservedRecordName. Every instance writing to the zone uses them so they are never stamped with an owner.
+func sharedRecord(rt dns.RecordType, dnsName string) bool {
+	return rt == dns.RecordTypeTXT && reservedRecordName(dnsName)
+}
+
+// errEmptyResponse means azure reported success but returned nothing, treated as a failure so it is retried.
+var errEmptyResponse = errors.New("empty response from azure")
+
+// errWriteNotConfirmed means azure accepted a write but reading the record set back didn't show it yet.
+var errWriteNotConfirmed = errors.New("record set write not confirmed")
+
+// confirmWrite reads the record set back and checks it holds what was written. Public record sets also
+// report a provisioningState, which has to be Succeeded. Private ones have none so their contents are the
+// only confirmation.
+func (r *AzureDNSConfig) confirmWrite(ctx context.Context, rt dns.RecordType, dnsName string, want dns.RecordSet) error {
+	var state string
+	resp, err := r.DNSClient.Get(withProvisioningState(ctx, &state), r.ResourceGroup, r.ZoneName, rt, dnsName, &dns.RecordSetsClientGetOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: %w", errWriteNotConfirmed, err)
+	}
+	got := resp.Properties
+	if got == nil {
+		return fmt.Errorf("%w: %s %s has no properties", errWriteNotConfirmed, rt, dnsName)
+	}
+	if state != "" && state != string(dns.ProvisioningStateSucceeded) {
+		return fmt.Errorf("%w: %s %s is %s", errWriteNotConfirmed, rt, dnsName, state)
+	}
+	wantValues, gotValues := recordSetValues(want.Properties), recordSetValues(got)
+	slices.Sort(wantValues)
+	slices.Sort(gotValues)
+	if to.Int64(got.TTL) != to.Int64(want.Properties.TTL) || !slices.Equal(wantValues, gotValues) {
+		return fmt.Errorf("%w: %s %s is ttl=%d %v, want ttl=%d %v", errWriteNotConfirmed, rt, dnsName,
+			to.Int64(got.TTL), gotValues, to.Int64(want.Properties.TTL), wantValues)
+	}
+	return nil
+}
+
+// isNotFound reports whether err is an azure 404.
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// isPreconditionFailed reports whether a conditional write lost a race, its etag no longer matched.
+func isPreconditionFailed(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// BatchDeleteDNSRecords lists the zone once and deletes the A and AAAA record sets of every name in dnsNames.
+// Names without records cost nothing, unlike DeleteDNSRecords which always issues both deletes.
+func (r *AzureDNSConfig) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	wanted := map[string]bool{}
+	for _, n := range dnsNames {
+		n, err := r.relativeName(n)
+		if err != nil {
+			return err
+		}
+		wanted[n] = true
+	}
+
+	type target struct {
+		rt   dns.RecordType
+		name string
+	}
+	var targets []target
+	pager := r.DNSClient.NewListPager(r.ResourceGroup, r.ZoneName, &dns.RecordSetsClientListOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing records: %w", err)
+		}
+		for _, rs := range page.Value {
+			if rs.Name == nil || rs.Type == nil || !wanted[*rs.Name] {
+				continue
+			}
+			rt := recordTypeFromResourceType(*rs.Type)
+			if rt == dns.RecordTypeA || rt == dns.RecordTypeAAAA {
+				targets = append(targets, target{rt: rt, name: *rs.Name})
+			}
+		}
+	}
+
+	// deletes go through the shared azure rate limiter so a big batch is paced rather than throttled.
+	var errs []error
+	for _, t := range targets {
+		if _, err := r.deleteRecordSet(ctx, t.rt, t.name); err != nil {
+			errs = append(errs, fmt.Errorf("error deleting %s records for %s: %w", t.rt, t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // createOrUpdateARecordSet wraps the Azure DNS client for an A record.
-func (r *AzureDNSConfig) createOrUpdateARecordSet(ctx context.Context, dnsName string, ips []string) error {
+func (r *AzureDNSConfig) createOrUpdateARecordSet(ctx context.Context, dnsName string, ips []string, ttl int64) (bool, error) {
 	// Build ARecords from the IP list
 	var aRecords []*dns.ARecord
 	for _, ip := range ips {
@@ -77,28 +1004,17 @@ func (r *AzureDNSConfig) createOrUpdateARecordSet(ctx context.Context, dnsName s
 
 	rs := dns.RecordSet{
 		Properties: &dns.RecordSetProperties{
-			TTL:      to.Int64Ptr(300),
+			TTL:      to.Int64Ptr(r.ttl(ttl)),
 			ARecords: aRecords,
 		},
 	}
 
-	_, err := r.DNSClient.CreateOrUpdate(
-		ctx,
-		r.ResourceGroup,
-		r.ZoneName,
-		dns.RecordTypeA,
-		dnsName, // relative record name or FQDN minus the zone?
-		rs,
-		&dns.RecordSetsClientCreateOrUpdateOptions{},
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+	// relative record name or FQDN minus the zone?
+	return r.writeRecordSet(ctx, dns.RecordTypeA, dnsName, rs)
 }
 
 // createOrUpdateAAAARecordSet wraps the Azure DNS client for an AAAA record.
-func (r *AzureDNSConfig) createOrUpdateAAAARecordSet(ctx context.Context, dnsName string, ips []string) error {
+func (r *AzureDNSConfig) createOrUpdateAAAARecordSet(ctx context.Context, dnsName string, ips []string, ttl int64) (bool, error) {
 	var aaaaRecords []*dns.AaaaRecord
 	for _, ip := range ips {
 		ipCopy := ip
@@ -107,19 +1023,10 @@ func (r *AzureDNSConfig) createOrUpdateAAAARecordSet(ctx context.Context, dnsNam
 
 	rs := dns.RecordSet{
 		Properties: &dns.RecordSetProperties{
-			TTL:         to.Int64Ptr(300),
+			TTL:         to.Int64Ptr(r.ttl(ttl)),
 			AaaaRecords: aaaaRecords,
 		},
 	}
 
-	_, err := r.DNSClient.CreateOrUpdate(
-		ctx,
-		r.ResourceGroup,
-		r.ZoneName,
-		dns.RecordTypeAAAA,
-		dnsName,
-		rs,
-		&dns.RecordSetsClientCreateOrUpdateOptions{},
-	)
-	return err
+	return r.writeRecordSet(ctx, dns.RecordTypeAAAA, dnsName, rs)
 }
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeRecordSets is an in memory azure zone behind the record sets API. Conditional writes aren't checked.
+type fakeRecordSets struct {
+	mu    sync.Mutex
+	sets  map[string]dns.RecordSet // by type/name
+	etags int
+	calls []string
+}
+
+func newFakeRecordSets() *fakeRecordSets {
+	return &fakeRecordSets{sets: map[string]dns.RecordSet{}}
+}
+
+func fakeKey(rt dns.RecordType, name string) string { return string(rt) + "/" + strings.ToLower(name) }
+
+func (f *fakeRecordSets) Get(_ context.Context, _, _ string, rt dns.RecordType, name string, _ *dns.RecordSetsClientGetOptions) (dns.RecordSetsClientGetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "get "+fakeKey(rt, name))
+	rs, ok := f.sets[fakeKey(rt, name)]
+	if !ok {
+		return dns.RecordSetsClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "NotFound"}
+	}
+	return dns.RecordSetsClientGetResponse{RecordSet: rs}, nil
+}
+
+func (f *fakeRecordSets) CreateOrUpdate(_ context.Context, _, zone string, rt dns.RecordType, name string, rs dns.RecordSet, _ *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "put "+fakeKey(rt, name))
+	f.etags++
+	rs.Name = to.StringPtr(name)
+	rs.Type = to.StringPtr("Microsoft.Network/privateDnsZones/" + string(rt))
+	rs.Etag = to.StringPtr(strconv.Itoa(f.etags))
+	rs.Properties.Fqdn = to.StringPtr(name + "." + zone + ".")
+	f.sets[fakeKey(rt, name)] = rs
+	return dns.RecordSetsClientCreateOrUpdateResponse{RecordSet: rs}, nil
+}
+
+func (f *fakeRecordSets) Delete(_ context.Context, _, _ string, rt dns.RecordType, name string, _ *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "delete "+fakeKey(rt, name))
+	delete(f.sets, fakeKey(rt, name))
+	return dns.RecordSetsClientDeleteResponse{}, nil
+}
+
+// NewListPager returns every record set in one page.
+func (f *fakeRecordSets) NewListPager(_, _ string, _ *dns.RecordSetsClientListOptions) *runtime.Pager[dns.RecordSetsClientListResponse] {
+	return runtime.NewPager(runtime.PagingHandler[dns.RecordSetsClientListResponse]{
+		More: func(dns.RecordSetsClientListResponse) bool { return false },
+		Fetcher: func(context.Context, *dns.RecordSetsClientListResponse) (dns.RecordSetsClientListResponse, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			var page dns.RecordSetsClientListResponse
+			for _, key := range slices.Sorted(maps.Keys(f.sets)) {
+				rs := f.sets[key]
+				page.Value = append(page.Value, &rs)
+			}
+			return page, nil
+		},
+	})
+}
+
+func newTestAzureDNSConfig(t *testing.T, opts ...Option) (*AzureDNSConfig, *fakeRecordSets) {
+	t.Helper()
+	rs := newFakeRecordSets()
+	r, err := NewAzureDNSConfig("sub", "rg", "example.internal", rs, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, rs
+}
+
+func TestAuditRecordsOldAndNewValues(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := newTestAzureDNSConfig(t, WithAudit(NewAuditLogger(&buf, "test")))
+	ctx := context.Background()
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.2"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteDNSRecords(ctx, "web.default.svc"); err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		Operation string   `json:"operation"`
+		Type      string   `json:"type"`
+		Old       []string `json:"old"`
+		New       []string `json:"new"`
+	}
+	var got []entry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		got = append(got, e)
+	}
+	// the missing AAAA record set is never deleted so never audited.
+	want := []entry{
+		{Operation: auditUpsert, Type: "A", New: []string{"10.0.0.1"}},
+		{Operation: auditUpsert, Type: "A", Old: []string{"10.0.0.1"}, New: []string{"10.0.0.2"}},
+		{Operation: auditDelete, Type: "A", Old: []string{"10.0.0.2"}},
+	}
+	if !slices.EqualFunc(got, want, func(a, b entry) bool {
+		return a.Operation == b.Operation && a.Type == b.Type && slices.Equal(a.Old, b.Old) && slices.Equal(a.New, b.New)
+	}) {
+		t.Errorf("audit entries = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecordSetsClientOptionsPinAPIVersion(t *testing.T) {
+	opts, err := recordSetsClientOptions("2020-06-01", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.APIVersion != "2020-06-01" {
+		t.Errorf("APIVersion = %q, want 2020-06-01", opts.APIVersion)
+	}
+	opts, err = recordSetsClientOptions("", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.APIVersion != "" {
+		t.Errorf("APIVersion = %q, want the SDK default", opts.APIVersion)
+	}
+	if _, err := recordSetsClientOptions("2017-01-01", nil, false); err == nil {
+		t.Error("unsupported api version was accepted")
+	}
+}
+
+func TestStaleCNAMEReplacedByARecord(t *testing.T) {
+	r, sets := newTestAzureDNSConfig(t)
+	ctx := context.Background()
+	// left over from when the service was an ExternalName.
+	if err := r.UpsertCNAMERecord(ctx, "web.default.svc", "example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeCNAME, "web.default.svc")]; ok {
+		t.Error("stale CNAME left next to the A record")
+	}
+	rs, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]
+	if !ok || len(rs.Properties.ARecords) != 1 || to.String(rs.Properties.ARecords[0].IPv4Address) != "10.0.0.1" {
+		t.Errorf("A record set = %+v, want 10.0.0.1", rs.Properties)
+	}
+}
+
+func TestTrailingDotNormalization(t *testing.T) {
+	r, _ := newTestAzureDNSConfig(t, WithApexPolicy(apexAllow))
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"web.default.svc", "web.default.svc"},
+		{"web.default.svc.", "web.default.svc"},
+		{"web.default.svc.example.internal", "web.default.svc"},
+		{"web.default.svc.example.internal.", "web.default.svc"},
+		{"WEB.default.svc.Example.Internal.", "WEB.default.svc"},
+		{"example.internal.", "@"},
+		{"@", "@"},
+	} {
+		for _, resolve := range []func(string) (string, error){r.relativeName, r.addressName} {
+			if got, err := resolve(tc.name); err != nil || got != tc.want {
+				t.Errorf("name %q = %q, %v, want %q", tc.name, got, err, tc.want)
+			}
+		}
+	}
+	for _, bad := range []string{"", ".", "web..svc", "web.default.svc.."} {
+		if got, err := r.relativeName(bad); err == nil {
+			t.Errorf("name %q = %q, want an error", bad, got)
+		}
+	}
+	for _, target := range []string{"db.example.com", "db.example.com."} {
+		if got := normalizeTarget(target); got != "db.example.com" {
+			t.Errorf("target %q = %q, want db.example.com", target, got)
+		}
+	}
+
+	// the same target with or without the dot is the same CNAME, it isn't rewritten.
+	zone, sets := newTestAzureDNSConfig(t)
+	ctx := context.Background()
+	if err := zone.UpsertCNAMERecord(ctx, "web.default.svc.", "db.example.com.", 0); err != nil {
+		t.Fatal(err)
+	}
+	puts := func() (n int) {
+		for _, c := range sets.calls {
+			if strings.HasPrefix(c, "put ") {
+				n++
+			}
+		}
+		return n
+	}
+	before := puts()
+	if err := zone.UpsertCNAMERecord(ctx, "web.default.svc.example.internal", "db.example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := puts() - before; got != 0 {
+		t.Errorf("CNAME rewritten %d times for the same target without its trailing dot", got)
+	}
+}
+
+func TestOthersConflictingCNAMERequeues(t *testing.T) {
+	zone, sets := newTestAzureDNSConfig(t, WithOwnerID("me", true))
+	sets.sets[fakeKey(dns.RecordTypeCNAME, "web.default.svc")] = dns.RecordSet{Properties: &dns.RecordSetProperties{
+		TTL:         to.Int64Ptr(300),
+		CnameRecord: &dns.CnameRecord{Cname: to.StringPtr("example.com")},
+		Metadata:    map[string]*string{ownerMetadataKey: to.StringPtr("other-controller")},
+	}}
+	r, _ := newTestReconciler(t, testService("web", "10.0.0.1"))
+	r.RecordSuffix = "svc"
+	r.dns = zone
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(context.Background(), req); !errors.Is(err, errConflictingRecord) {
+		t.Fatalf("Reconcile = %v, want errConflictingRecord so it is requeued", err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeCNAME, "web.default.svc")]; !ok {
+		t.Error("other owner's CNAME was deleted")
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; ok {
+		t.Error("A record written next to the conflicting CNAME")
+	}
+	var reported bool
+	for events := r.recorder.(*record.FakeRecorder).Events; len(events) > 0; {
+		if strings.Contains(<-events, "ConflictingRecord") {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Error("no ConflictingRecord event")
+	}
+}
+
+func TestOtherControllersRecordsLeftUntouched(t *testing.T) {
+	zone, sets := newTestAzureDNSConfig(t, WithOwnerID("me", true))
+	other := map[string]*string{ownerMetadataKey: to.StringPtr("other-controller")}
+	sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")] = dns.RecordSet{Properties: &dns.RecordSetProperties{
+		TTL:      to.Int64Ptr(300),
+		ARecords: []*dns.ARecord{{IPv4Address: to.StringPtr("10.0.0.9")}},
+		Metadata: other,
+	}}
+	sets.sets[fakeKey(dns.RecordTypeTXT, versionRecordName)] = dns.RecordSet{Properties: &dns.RecordSetProperties{
+		TTL:        to.Int64Ptr(300),
+		TxtRecords: []*dns.TxtRecord{{Value: []*string{to.StringPtr("v0")}}},
+		Metadata:   other,
+	}}
+	conflicts := testutil.ToFloat64(ownershipConflicts.WithLabelValues("example.internal"))
+	ctx := context.Background()
+
+	if _, err := zone.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); !errors.Is(err, errOwnedByOther) {
+		t.Errorf("upsert = %v, want errOwnedByOther", err)
+	}
+	if err := zone.DeleteDNSRecords(ctx, "web.default.svc"); err != nil {
+		t.Errorf("delete: %v", err)
+	}
+	rs := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]
+	if rs.Properties == nil || to.String(rs.Properties.ARecords[0].IPv4Address) != "10.0.0.9" {
+		t.Errorf("other controller's A record = %+v, want it untouched", rs.Properties)
+	}
+	if got := testutil.ToFloat64(ownershipConflicts.WithLabelValues("example.internal")) - conflicts; got != 2 {
+		t.Errorf("%v ownership conflicts counted, want 2", got)
+	}
+
+	// the controller's own TXT records are shared by every instance.
+	if err := zone.UpsertTXTRecord(ctx, versionRecordName, []string{"v1"}); err != nil {
+		t.Fatalf("writing %s: %v", versionRecordName, err)
+	}
+	txt := sets.sets[fakeKey(dns.RecordTypeTXT, versionRecordName)].Properties
+	if got := to.String(txt.TxtRecords[0].Value[0]); got != "v1" {
+		t.Errorf("%s = %q, want v1", versionRecordName, got)
+	}
+	if owner, ok := txt.Metadata[ownerMetadataKey]; ok {
+		t.Errorf("%s stamped with owner %q", versionRecordName, to.String(owner))
+	}
+}
+
+func TestUpsertCountsChangedRecordSets(t *testing.T) {
+	// auditing reads every record set before deleting it, the fake can't answer a missing one with a 204.
+	r, _ := newTestAzureDNSConfig(t, WithAudit(NewAuditLogger(io.Discard, "test")))
+	ctx := context.Background()
+	if err := r.UpsertCNAMERecord(ctx, "web.default.svc", "example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		ips  []string
+		want int
+	}{
+		{[]string{"10.0.0.1"}, 2}, // the A record is written and the CNAME deleted
+		{[]string{"10.0.0.1"}, 0},
+		{[]string{"10.0.0.1", "fd00::1"}, 1},
+		{nil, 2},
+		{nil, 0},
+	} {
+		changed, err := r.UpsertDNSRecords(ctx, "web.default.svc", tc.ips, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tc.want {
+			t.Errorf("upserting %v changed %d record sets, want %d", tc.ips, changed, tc.want)
+		}
+	}
+}
+
+func TestDefaultTTLFromSOAMinimum(t *testing.T) {
+	r, sets := newTestAzureDNSConfig(t)
+	ctx := context.Background()
+	// no SOA to read keeps the hardcoded default.
+	r.UseSOAMinimumTTL(ctx)
+	if got := r.ttl(0); got != defaultTTL {
+		t.Errorf("ttl without an SOA = %d, want %d", got, defaultTTL)
+	}
+
+	sets.sets[fakeKey(dns.RecordTypeSOA, "@")] = dns.RecordSet{Properties: &dns.RecordSetProperties{SoaRecord: &dns.SoaRecord{MinimumTTL: to.Int64Ptr(60)}}}
+	r.UseSOAMinimumTTL(ctx)
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := to.Int64(sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")].Properties.TTL); got != 60 {
+		t.Errorf("record TTL = %d, want the SOA minimum 60", got)
+	}
+}
+
+func TestLogWritesShowsStoredRecordSet(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	r, _ := newTestAzureDNSConfig(t, WithTTL(60), WithWriteChecks(true, false))
+	if _, err := r.UpsertDNSRecords(context.Background(), "web.default.svc", []string{"10.0.0.1", "10.0.0.2"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Wrote A web.default.svc.example.internal. ttl=60 [10.0.0.1 10.0.0.2]"; !strings.Contains(out.String(), want) {
+		t.Errorf("log = %q, want it to contain %q", out.String(), want)
+	}
+}
+
+// droppedWrites accepts writes without storing them, like a write that failed after azure answered.
+type droppedWrites struct {
+	*fakeRecordSets
+	drop  bool
+	empty bool // answer a dropped write with an empty response rather than echoing it
+}
+
+func (d *droppedWrites) CreateOrUpdate(ctx context.Context, rg, zone string, rt dns.RecordType, name string, rs dns.RecordSet, opts *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error) {
+	if d.drop && d.empty {
+		return dns.RecordSetsClientCreateOrUpdateResponse{}, nil
+	}
+	if d.drop {
+		return dns.RecordSetsClientCreateOrUpdateResponse{RecordSet: rs}, nil
+	}
+	return d.fakeRecordSets.CreateOrUpdate(ctx, rg, zone, rt, name, rs, opts)
+}
+
+func TestUnconfirmedWriteRequeues(t *testing.T) {
+	sets := &droppedWrites{fakeRecordSets: newFakeRecordSets(), drop: true}
+	zone, err := NewAzureDNSConfig("sub", "rg", "example.internal", sets, WithWriteChecks(false, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := testService("web", "10.0.0.1")
+	r, _ := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.dns = zone
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(context.Background(), req); !errors.Is(err, errWriteNotConfirmed) {
+		t.Fatalf("Reconcile = %v, want errWriteNotConfirmed so it is requeued", err)
+	}
+	sets.drop = false
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("requeued Reconcile: %v", err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; !ok {
+		t.Error("A record not written by the requeued reconcile")
+	}
+}
+
+func TestEmptyResponseRequeues(t *testing.T) {
+	sets := &droppedWrites{fakeRecordSets: newFakeRecordSets(), drop: true, empty: true}
+	zone, err := NewAzureDNSConfig("sub", "rg", "example.internal", sets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := newTestReconciler(t, testService("web", "10.0.0.1"))
+	r.RecordSuffix = "svc"
+	r.dns = zone
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(context.Background(), req); !errors.Is(err, errEmptyResponse) {
+		t.Fatalf("Reconcile = %v, want errEmptyResponse so it is requeued", err)
+	}
+	sets.drop = false
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("requeued Reconcile: %v", err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; !ok {
+		t.Error("A record not written by the requeued reconcile")
+	}
+}
+
+func TestFinalizerConflictRetried(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	r, _ := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	var patches int
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			if patches == 1 {
+				// another writer updated the service since it was read.
+				return apierrors.NewConflict(corev1.Resource("services"), obj.GetName(), errors.New("the object has been modified"))
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+	conflicts := testutil.ToFloat64(finalizerConflicts)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if got := testutil.ToFloat64(finalizerConflicts) - conflicts; got != 1 {
+		t.Errorf("%v finalizer conflicts counted over %d patches, want 1", got, patches)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(&got, finalizer) {
+		t.Errorf("finalizers = %v, want %s added by the retry", got.Finalizers, finalizer)
+	}
+}
+
+// provisioningRecordSets reports state as the provisioningState of every record set, like a public zone.
+type provisioningRecordSets struct {
+	*fakeRecordSets
+	state string
+}
+
+func (p *provisioningRecordSets) Get(ctx context.Context, rg, zone string, rt dns.RecordType, name string, opts *dns.RecordSetsClientGetOptions) (dns.RecordSetsClientGetResponse, error) {
+	resp, err := p.fakeRecordSets.Get(ctx, rg, zone, rt, name, opts)
+	if state, ok := ctx.Value(provisioningStateKey{}).(*string); ok && err == nil {
+		*state = p.state
+	}
+	return resp, err
+}
+
+func TestUnsucceededProvisioningStateNotConfirmed(t *testing.T) {
+	sets := &provisioningRecordSets{fakeRecordSets: newFakeRecordSets(), state: "Updating"}
+	r, err := NewAzureDNSConfig("sub", "rg", "example.com", sets, WithPublic(true), WithWriteChecks(false, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := r.UpsertDNSRecords(ctx, "web", []string{"10.0.0.1"}, 0); !errors.Is(err, errWriteNotConfirmed) {
+		t.Fatalf("upsert while Updating = %v, want errWriteNotConfirmed", err)
+	}
+	sets.state = string(dns.ProvisioningStateSucceeded)
+	if _, err := r.UpsertDNSRecords(ctx, "web", []string{"10.0.0.2"}, 0); err != nil {
+		t.Fatalf("upsert once Succeeded: %v", err)
+	}
+}
+
+// appearingZone 404s until it has been asked for missing times.
+type appearingZone struct {
+	missing int
+	gets    int
+}
+
+func (z *appearingZone) Get(_ context.Context, _, zone string, _ *dns.PrivateZonesClientGetOptions) (dns.PrivateZonesClientGetResponse, error) {
+	if z.gets++; z.gets <= z.missing {
+		return dns.PrivateZonesClientGetResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "ResourceNotFound"}
+	}
+	return dns.PrivateZonesClientGetResponse{PrivateZone: dns.PrivateZone{ID: to.StringPtr("/zones/" + zone)}}, nil
+}
+
+func TestWaitForZoneCreatedAfterStartup(t *testing.T) {
+	defer func(d time.Duration) { zoneWaitInterval = d }(zoneWaitInterval)
+	zoneWaitInterval = time.Millisecond
+	zones := &appearingZone{missing: 3}
+	r, sets := newTestAzureDNSConfig(t, WithZonesClient(zones))
+	ctx := context.Background()
+	if err := r.WaitForZone(ctx, time.Minute); err != nil {
+		t.Fatalf("zone that appeared: %v", err)
+	}
+	if zones.gets != 4 {
+		t.Errorf("zone looked up %d times, want 4", zones.gets)
+	}
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; !ok {
+		t.Error("record not published once the zone appeared")
+	}
+
+	never := &appearingZone{missing: math.MaxInt}
+	r, _ = newTestAzureDNSConfig(t, WithZonesClient(never))
+	if err := r.WaitForZone(ctx, 20*time.Millisecond); !isNotFound(err) {
+		t.Errorf("zone that never appeared: %v, want the 404 after -zone-wait", err)
+	}
+}
+
+func TestApexNameFromHostnameAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   string // the A record written, "" for none
+	}{
+		{"", ""},
+		{apexReject, ""},
+		{apexAllow, "@"},
+		{apexRedirect + "=apex", "apex"},
+	} {
+		sets := newFakeRecordSets()
+		zone, err := NewAzureDNSConfig("sub", "rg", "cluster.local", sets, WithApexPolicy(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a hostname that names the zone itself rather than a name in it.
+		svc := testService("web", "10.0.0.1")
+		svc.Annotations = map[string]string{hostnameAnnotation: "cluster.local."}
+		r, _ := newTestReconciler(t, svc)
+		r.dns = zone
+		reconcileService(t, r, svc)
+
+		var written []string
+		for _, c := range sets.calls {
+			if name, ok := strings.CutPrefix(c, "put A/"); ok {
+				written = append(written, name)
+			}
+		}
+		if tc.want == "" {
+			if len(written) > 0 {
+				t.Errorf("policy %q wrote A records %v", tc.policy, written)
+			}
+			var events []string
+			for ev := r.recorder.(*record.FakeRecorder).Events; len(ev) > 0; {
+				events = append(events, <-ev)
+			}
+			if !slices.ContainsFunc(events, func(e string) bool { return strings.Contains(e, "ApexName") }) {
+				t.Errorf("policy %q events = %v, want ApexName", tc.policy, events)
+			}
+		} else if !slices.Equal(written, []string{tc.want}) {
+			t.Errorf("policy %q wrote A records %v, want %s", tc.policy, written, tc.want)
+		}
+	}
+}
+
+// notFoundDeletes answers a delete of a record set that isn't there with a 404, or with err when set.
+type notFoundDeletes struct {
+	*fakeRecordSets
+	err error
+}
+
+func (n *notFoundDeletes) Delete(ctx context.Context, rg, zone string, rt dns.RecordType, name string, opts *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error) {
+	n.mu.Lock()
+	_, ok := n.sets[fakeKey(rt, name)]
+	n.mu.Unlock()
+	if n.err != nil {
+		return dns.RecordSetsClientDeleteResponse{}, n.err
+	}
+	if !ok {
+		return dns.RecordSetsClientDeleteResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "NotFound"}
+	}
+	return n.fakeRecordSets.Delete(ctx, rg, zone, rt, name, opts)
+}
+
+func TestDeleteNotFoundIsSuccess(t *testing.T) {
+	sets := &notFoundDeletes{fakeRecordSets: newFakeRecordSets()}
+	r, err := NewAzureDNSConfig("sub", "rg", "example.internal", sets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// only the A record set exists, the AAAA delete 404s.
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteDNSRecords(ctx, "web.default.svc"); err != nil {
+		t.Errorf("delete with the AAAA record set missing: %v", err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; ok {
+		t.Error("A record set left behind")
+	}
+	// records cleaned up already, a finalizer retry must still go through.
+	svc := testService("web", "10.0.0.1")
+	svc.Finalizers = []string{finalizer}
+	svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	setPublishedNames(svc, []string{"web.default.svc"})
+	rec, _ := newTestReconciler(t, svc)
+	rec.RecordSuffix = "svc"
+	rec.dns = r
+	reconcileService(t, rec, svc)
+	if err := rec.Get(ctx, client.ObjectKeyFromObject(svc), &corev1.Service{}); err == nil {
+		t.Error("service still exists, its finalizer wasn't removed")
+	}
+
+	// any other failure is still one.
+	sets.err = &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthorizationFailed"}
+	if err := r.DeleteDNSRecords(ctx, "web.default.svc"); err == nil {
+		t.Error("a 403 on delete was treated as success")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DNSZone is a zone services are written to, configured in the cluster instead of with -zone flags.
+// Services in namespaces its selector matches, or annotated dns.azure.com/zone with its zone name, go to it.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+type DNSZone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DNSZoneSpec `json:"spec"`
+}
+
+type DNSZoneSpec struct {
+	// SubscriptionID holding the zone, -subscription when empty.
+	// +optional
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	// ResourceGroup holding the zone, -resourcegroup when empty.
+	// +optional
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	// ZoneName is the Azure DNS zone, e.g. prod.internal. The zone must already exist.
+	ZoneName string `json:"zoneName"`
+	// TTL of the records written, -ttl when 0.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTL int64 `json:"ttl,omitempty"`
+	// NamespaceSelector picks the namespaces whose services go to the zone. When unset only services
+	// annotated dns.azure.com/zone with the zone name do.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type DNSZoneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DNSZone `json:"items"`
+}
+
+func (in *DNSZone) DeepCopyInto(out *DNSZone) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.NamespaceSelector != nil {
+		out.Spec.NamespaceSelector = in.Spec.NamespaceSelector.DeepCopy()
+	}
+}
+
+func (in *DNSZone) DeepCopyObject() runtime.Object {
+	out := &DNSZone{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DNSZoneList) DeepCopyObject() runtime.Object {
+	out := &DNSZoneList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]DNSZone, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// addDNSZoneToScheme registers DNSZone and its list.
+func addDNSZoneToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(aggregateGroupVersion, &DNSZone{}, &DNSZoneList{})
+	metav1.AddToGroupVersion(scheme, aggregateGroupVersion)
+	return nil
+}
+
+// dnsZones lists the DNSZones in name order, which breaks ties between zones selecting the same namespace.
+// Only the first DNSZone naming a zone counts.
+func dnsZones(ctx context.Context, c client.Reader) ([]DNSZone, error) {
+	var list DNSZoneList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(list.Items, func(a, b DNSZone) int { return strings.Compare(a.Name, b.Name) })
+	seen := map[string]bool{}
+	return slices.DeleteFunc(list.Items, func(z DNSZone) bool {
+		dup := seen[z.Spec.ZoneName] || z.DeletionTimestamp != nil
+		seen[z.Spec.ZoneName] = true
+		return dup
+	}), nil
+}
+
+// DNSZoneReconciler keeps a ZoneFanout target for every DNSZone and requeues every service when one
+// changes, so they move to the zone they now resolve to. Services are routed to them by ZoneRouter.
+// Records are left in place when a DNSZone is deleted, the zone is usually going away with it.
+type DNSZoneReconciler struct {
+	client.Client
+	fanout *ZoneFanout
+	// newZone creates the write target for a zone, with the same options as the -zoneName zones.
+	newZone func(ctx context.Context, spec DNSZoneSpec) (pausableTarget, error)
+	resync  chan<- event.GenericEvent
+	static  []string // zones configured with flags, a DNSZone can't replace them
+
+	mu      sync.Mutex
+	applied map[string]DNSZoneSpec // by DNSZone name
+}
+
+func (r *DNSZoneReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var zone DNSZone
+	err := r.Get(ctx, req.NamespacedName, &zone)
+	if apierrors.IsNotFound(err) || (err == nil && zone.DeletionTimestamp != nil) {
+		if r.setZone(req.Name, nil, nil) {
+			log.Printf("DNSZone %s is gone, its records are left in place", req.Name)
+			return reconcile.Result{}, r.resyncServices(ctx)
+		}
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	zones, err := dnsZones(ctx, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if slices.Contains(r.static, zone.Spec.ZoneName) || !slices.ContainsFunc(zones, func(z DNSZone) bool { return z.Name == zone.Name }) {
+		log.Printf("Ignoring DNSZone %s, zone %s is already configured", zone.Name, zone.Spec.ZoneName)
+		if r.setZone(zone.Name, nil, nil) {
+			return reconcile.Result{}, r.resyncServices(ctx)
+		}
+		return reconcile.Result{}, nil
+	}
+	target, err := r.newZone(ctx, zone.Spec)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("DNSZone %s: %w", zone.Name, err)
+	}
+	if r.setZone(zone.Name, &zone.Spec, target) {
+		log.Printf("Configured zone %s from DNSZone %s", zone.Spec.ZoneName, zone.Name)
+		return reconcile.Result{}, r.resyncServices(ctx)
+	}
+	return reconcile.Result{}, nil
+}
+
+// setZone points the DNSZone called name at spec's zone in the fanout, removing the zone it had before.
+// A nil spec only removes it. changed is false when spec was already applied.
+func (r *DNSZoneReconciler) setZone(name string, spec *DNSZoneSpec, target pausableTarget) (changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.applied == nil {
+		r.applied = map[string]DNSZoneSpec{}
+	}
+	prev, ok := r.applied[name]
+	if ok && spec != nil && reflect.DeepEqual(prev, *spec) {
+		return false
+	}
+	if ok && (spec == nil || prev.ZoneName != spec.ZoneName) {
+		r.fanout.removeZone(prev.ZoneName)
+	}
+	if spec == nil {
+		delete(r.applied, name)
+		return ok
+	}
+	r.applied[name] = *spec
+	r.fanout.setZone(spec.ZoneName, target)
+	return true
+}
+
+// dnsZoneRequests queues every DNSZone along with obj, the first DNSZone for a zone configures it so
+// creating or deleting one can change which another does.
+func (r *DNSZoneReconciler) dnsZoneRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	requests := []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(obj)}}
+	var list DNSZoneList
+	if err := r.List(ctx, &list); err != nil {
+		log.Printf("Unable to list DNSZones: %v", err)
+		return requests
+	}
+	for _, z := range list.Items {
+		if z.Name != obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&z)})
+		}
+	}
+	return requests
+}
+
+// resyncServices queues every service for reconciliation.
+func (r *DNSZoneReconciler) resyncServices(ctx context.Context) error {
+	var list corev1.ServiceList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		select {
+		case r.resync <- event.GenericEvent{Object: &list.Items[i]}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// dnsZoneFor is the zone of the first DNSZone whose namespace selector matches namespaceLabels, empty if none does.
+func dnsZoneFor(zones []DNSZone, namespaceLabels map[string]string) (string, error) {
+	for _, z := range zones {
+		if z.Spec.NamespaceSelector == nil {
+			continue
+		}
+		sel, err := metav1.LabelSelectorAsSelector(z.Spec.NamespaceSelector)
+		if err != nil {
+			return "", fmt.Errorf("DNSZone %s: %w", z.Name, err)
+		}
+		if sel.Matches(labels.Set(namespaceLabels)) {
+			return z.Spec.ZoneName, nil
+		}
+	}
+	return "", nil
+}
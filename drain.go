@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// Drain lets the azure writes in flight at shutdown finish instead of being cancelled along with their
+// reconcile, which can leave a record set half way through a change. Writes started after shutdown began
+// fail with the caller's error as before. Writes still running Timeout after shutdown began are cancelled.
+// Only shutting down is waited out: a write cancelled while shutdown hasn't started, e.g. by LeaderGuard
+// after leadership was lost, is cancelled straight away so a deposed leader never races the new one.
+type Drain struct {
+	Timeout time.Duration
+
+	shutdown context.Context // cancelled on SIGTERM, before the manager cancels anything derived from it
+
+	mu       sync.Mutex
+	inflight int
+	closing  bool
+	idle     chan struct{} // closed once closing with nothing in flight
+	hard     context.Context
+	cancel   context.CancelFunc
+}
+
+// NewDrain drains the writes in flight once shutdown, the context the manager is started with, is cancelled.
+func NewDrain(shutdown context.Context, timeout time.Duration) *Drain {
+	hard, cancel := context.WithCancel(context.Background())
+	return &Drain{Timeout: timeout, shutdown: shutdown, idle: make(chan struct{}), hard: hard, cancel: cancel}
+}
+
+// begin starts a write made with ctx. The returned context outlives ctx being cancelled by shutdown, but
+// not any other cancel, its deadline or the drain timing out. done must be called when the write returns.
+func (d *Drain) begin(ctx context.Context) (context.Context, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	d.mu.Lock()
+	if d.closing {
+		d.mu.Unlock()
+		return nil, nil, context.Canceled
+	}
+	d.inflight++
+	d.mu.Unlock()
+
+	detached := context.WithoutCancel(ctx)
+	var cancelDeadline context.CancelFunc = func() {}
+	if deadline, ok := ctx.Deadline(); ok {
+		detached, cancelDeadline = context.WithDeadline(detached, deadline)
+	}
+	detached, cancel := context.WithCancel(detached)
+	stop := context.AfterFunc(d.hard, cancel)
+	// ctx is derived from shutdown, so when shutdown is why ctx was cancelled shutdown is already done.
+	stopParent := context.AfterFunc(ctx, func() {
+		if d.shutdown.Err() == nil {
+			cancel()
+		}
+	})
+	return detached, func() {
+		stopParent()
+		stop()
+		cancel()
+		cancelDeadline()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.inflight--
+		if d.closing && d.inflight == 0 {
+			close(d.idle)
+		}
+	}, nil
+}
+
+// Start implements manager.Runnable. It waits for shutdown, then for the writes in flight.
+func (d *Drain) Start(ctx context.Context) error {
+	<-ctx.Done()
+	d.mu.Lock()
+	d.closing = true
+	n := d.inflight
+	if n == 0 {
+		close(d.idle)
+	}
+	d.mu.Unlock()
+	defer d.cancel()
+	if n == 0 {
+		return nil
+	}
+	log.Printf("Shutting down, waiting up to %s for %d Azure writes in flight", d.Timeout, n)
+	select {
+	case <-d.idle:
+		log.Printf("Azure writes drained")
+	case <-time.After(d.Timeout):
+		log.Printf("Azure writes still in flight after %s, cancelling them", d.Timeout)
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Drain runs on every replica, the manager starts it
+// before the elected controllers so it is waiting for shutdown by the time the first write is made, and a
+// replica that never made any writes returns from it right away.
+func (d *Drain) NeedLeaderElection() bool {
+	return false
+}
+
+// drainingRecordSets runs the mutating calls of a record sets client through a Drain, reads are still
+// cancelled with their caller.
+type drainingRecordSets struct {
+	recordSetsAPI
+	drain *Drain
+}
+
+func (c drainingRecordSets) CreateOrUpdate(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, parameters dns.RecordSet, options *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error) {
+	ctx, done, err := c.drain.begin(ctx)
+	if err != nil {
+		return dns.RecordSetsClientCreateOrUpdateResponse{}, err
+	}
+	defer done()
+	return c.recordSetsAPI.CreateOrUpdate(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, parameters, options)
+}
+
+func (c drainingRecordSets) Delete(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error) {
+	ctx, done, err := c.drain.begin(ctx)
+	if err != nil {
+		return dns.RecordSetsClientDeleteResponse{}, err
+	}
+	defer done()
+	return c.recordSetsAPI.Delete(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, options)
+}
+
+// WithDrain lets writes in flight at shutdown finish, see Drain. nil leaves them cancelled with the reconcile.
+func WithDrain(drain *Drain) Option { return func(r *AzureDNSConfig) { r.drain = drain } }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrainOutlivesShutdown(t *testing.T) {
+	shutdown, sigterm := context.WithCancel(context.Background())
+	d := NewDrain(shutdown, time.Second)
+	reconcileCtx, cancelReconcile := context.WithCancel(shutdown)
+	defer cancelReconcile()
+
+	write, done, err := d.begin(reconcileCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		d.Start(shutdown)
+		close(stopped)
+	}()
+	sigterm()
+	time.Sleep(50 * time.Millisecond)
+	if write.Err() != nil {
+		t.Fatal("write in flight was cancelled by shutdown")
+	}
+	if _, _, err := d.begin(context.Background()); err == nil {
+		t.Fatal("write started after shutdown began")
+	}
+	done()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("drain didn't stop once the write was done")
+	}
+}
+
+func TestDrainCancelsOnLeadershipLoss(t *testing.T) {
+	d := NewDrain(context.Background(), time.Minute)
+	leaderCtx, loseLeadership := context.WithCancel(context.Background())
+	guard := &LeaderGuard{leaderCtx: leaderCtx}
+
+	cancelled := make(chan error, 1)
+	go guard.do(context.Background(), func(ctx context.Context) error {
+		write, done, err := d.begin(ctx)
+		if err != nil {
+			cancelled <- err
+			return err
+		}
+		defer done()
+		<-write.Done()
+		cancelled <- write.Err()
+		return write.Err()
+	})
+	time.Sleep(50 * time.Millisecond)
+	loseLeadership()
+	select {
+	case err := <-cancelled:
+		if err == nil {
+			t.Fatal("write wasn't cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write kept running after leadership was lost")
+	}
+}
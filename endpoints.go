@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// maxRecordsPerSet is azure private DNS's limit on records in one record set.
+const maxRecordsPerSet = 20
+
+// endpointSlicePageSize bounds how many slices are held in memory at once while aggregating.
+const endpointSlicePageSize = 50
+
+var endpointsTruncated = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "azure_dns_headless_endpoints_truncated_total",
+	Help: "Headless service aggregations that had more ready addresses than fit in one record set.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(endpointsTruncated)
+}
+
+// endpointAggregate collects what a headless service publishes from its endpoints: every ready address
+// at the service wide name, those of endpoints with a hostname at <hostname>.<base> and, with topology,
+// those of each topology zone at <zone>.<base>, see topologyName. Every name keeps at most limit
+// addresses, the numerically lowest, so the selection is the same every time however the slices are
+// split and memory grows with the names published rather than with the endpoints.
+type endpointAggregate struct {
+	service   types.NamespacedName
+	base      string
+	limit     int
+	topology  bool
+	all       addressSelector
+	hostnames map[string]*addressSelector // by record name
+	zones     map[string]*addressSelector // by record name
+}
+
+func newEndpointAggregate(service types.NamespacedName, base string, limit int, topology bool) *endpointAggregate {
+	return &endpointAggregate{
+		service:   service,
+		base:      base,
+		limit:     limit,
+		topology:  topology,
+		all:       addressSelector{limit: limit},
+		hostnames: map[string]*addressSelector{},
+		zones:     map[string]*addressSelector{},
+	}
+}
+
+// addSlice adds the ready endpoints of slice.
+func (a *endpointAggregate) addSlice(slice *discoveryv1.EndpointSlice) {
+	for _, ep := range slice.Endpoints {
+		// nil ready means unknown which consumers should treat as ready.
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		hostname := ""
+		if ep.Hostname != nil {
+			hostname = *ep.Hostname
+		}
+		zone := ""
+		if a.topology {
+			zone, _ = topologyName(a.service, a.base, ep)
+		}
+		a.add(ep.Addresses, hostname, zone)
+	}
+}
+
+// addLegacy adds the ready addresses of a core/v1 Endpoints, which carry no topology zones.
+func (a *endpointAggregate) addLegacy(ep *corev1.Endpoints) {
+	for _, subset := range ep.Subsets {
+		for _, addr := range subset.Addresses {
+			a.add([]string{addr.IP}, addr.Hostname, "")
+		}
+	}
+}
+
+func (a *endpointAggregate) add(addrs []string, hostname, zoneName string) {
+	for _, s := range addrs {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			log.Printf("Warning: skipping address %q of headless service %s: %s", s, a.service, err)
+			continue
+		}
+		a.all.add(addr)
+		if hostname != "" {
+			a.selector(a.hostnames, hostname+"."+a.base).add(addr)
+		}
+		if zoneName != "" {
+			a.selector(a.zones, zoneName).add(addr)
+		}
+	}
+}
+
+func (a *endpointAggregate) selector(m map[string]*addressSelector, name string) *addressSelector {
+	if m[name] == nil {
+		m[name] = &addressSelector{limit: a.limit}
+	}
+	return m[name]
+}
+
+// records maps every name to publish to its addresses. The service wide name is always there, empty when
+// nothing is ready. A pod hostname that happens to be a zone name keeps its own record.
+func (a *endpointAggregate) records() map[string][]string {
+	records := map[string][]string{a.base: a.all.result(a.service, a.base)}
+	for name, sel := range a.hostnames {
+		records[name] = sel.result(a.service, name)
+	}
+	for name, sel := range a.zones {
+		if _, ok := records[name]; ok {
+			log.Printf("Warning: not publishing topology record %s for %s, a pod hostname already uses it", name, a.service)
+			continue
+		}
+		records[name] = sel.result(a.service, name)
+	}
+	return records
+}
+
+// pageEndpointSlices calls each with every EndpointSlice of service, a page at a time so only
+// endpointSlicePageSize slices are held in memory however large the service is.
+//
+// reader should be an API reader, the cache ignores paging.
+func pageEndpointSlices(ctx context.Context, reader client.Reader, service types.NamespacedName, each func(*discoveryv1.EndpointSlice)) error {
+	opts := []client.ListOption{
+		client.InNamespace(service.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: service.Name},
+		client.Limit(endpointSlicePageSize),
+	}
+	for {
+		var page discoveryv1.EndpointSliceList
+		if err := reader.List(ctx, &page, opts...); err != nil {
+			return err
+		}
+		for i := range page.Items {
+			each(&page.Items[i])
+		}
+		if page.Continue == "" {
+			return nil
+		}
+		opts = append(opts[:3], client.Continue(page.Continue))
+	}
+}
+
+// addressSelector keeps the lowest limit distinct addresses it is given, in address order with IPv4
+// before IPv6.
+type addressSelector struct {
+	limit int
+	kept  []netip.Addr
+	total int // distinct addresses seen, approximate once past limit
+}
+
+func (s *addressSelector) add(addr netip.Addr) {
+	i, found := slices.BinarySearchFunc(s.kept, addr, netip.Addr.Compare)
+	if found {
+		return
+	}
+	s.total++
+	if i >= s.limit {
+		return
+	}
+	s.kept = slices.Insert(s.kept, i, addr)
+	if len(s.kept) > s.limit {
+		s.kept = s.kept[:s.limit]
+	}
+}
+
+// result returns the kept addresses for name, counting and logging when some had to be dropped.
+func (s *addressSelector) result(service types.NamespacedName, name string) []string {
+	if s.total > s.limit {
+		endpointsTruncated.Inc()
+		log.Printf("Warning: %s of headless service %s has %d ready addresses, only publishing the first %d", name, service, s.total, s.limit)
+	}
+	kept := make([]string, len(s.kept))
+	for i, addr := range s.kept {
+		kept[i] = addr.String()
+	}
+	return kept
+}
+
+// endpointSliceHandler maps EndpointSlice events to a request for their owning service, delayed by
+// debounce. The workqueue holds one entry per key, so every slice of a service that changes within
+// debounce of the first lands in a single reconcile, which aggregates the slices as they are by then.
+func endpointSliceHandler(debounce time.Duration) handler.Funcs {
+	enqueue := func(obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+		name := obj.GetLabels()[discoveryv1.LabelServiceName]
+		if name == "" {
+			return
+		}
+		q.AddAfter(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}, debounce)
+	}
+	return handler.Funcs{
+		CreateFunc: func(_ context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(e.Object, q)
+		},
+		UpdateFunc: func(_ context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(e.ObjectNew, q)
+		},
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(e.Object, q)
+		},
+		GenericFunc: func(_ context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(e.Object, q)
+		},
+	}
+}
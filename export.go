@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// Export formats for -export.
+const (
+	exportTerraform = "terraform"
+	exportARM       = "arm"
+)
+
+// exportAPIVersion is the private DNS API version written into ARM templates.
+const exportAPIVersion = "2020-06-01"
+
+type exportKey struct {
+	zone string
+	rt   dns.RecordType
+	name string
+}
+
+type exportRecordSet struct {
+	resourceGroup string
+	ttl           int64
+	values        []string
+}
+
+// Exporter keeps the desired record sets of every zone and rewrites them to a file, as Terraform
+// azurerm_private_dns_* resources or an ARM template, after every change. Nothing is written to azure.
+type Exporter struct {
+	Format string
+	Path   string
+
+	mu      sync.Mutex
+	records map[exportKey]exportRecordSet
+}
+
+func NewExporter(format, path string) (*Exporter, error) {
+	if format != exportTerraform && format != exportARM {
+		return nil, fmt.Errorf("unknown export format %q, must be %s or %s", format, exportTerraform, exportARM)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("an export file is required")
+	}
+	return &Exporter{Format: format, Path: path, records: map[exportKey]exportRecordSet{}}, nil
+}
+
+// set stores rs at key, nil removes it, and rewrites the file when that changed anything.
+func (e *Exporter) set(key exportKey, rs *exportRecordSet) (changed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	old, ok := e.records[key]
+	if rs == nil {
+		if !ok {
+			return false
+		}
+		delete(e.records, key)
+	} else {
+		if ok && old.resourceGroup == rs.resourceGroup && old.ttl == rs.ttl && slices.Equal(old.values, rs.values) {
+			return false
+		}
+		e.records[key] = *rs
+	}
+	if err := e.write(); err != nil {
+		log.Printf("Failed to write %s export to %s: %v", e.Format, e.Path, err)
+	}
+	return true
+}
+
+// write renders every record set and atomically replaces the export file.
+func (e *Exporter) write() error {
+	keys := make([]exportKey, 0, len(e.records))
+	for k := range e.records {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b exportKey) int {
+		return strings.Compare(a.zone+"/"+string(a.rt)+"/"+a.name, b.zone+"/"+string(b.rt)+"/"+b.name)
+	})
+
+	var out []byte
+	var err error
+	if e.Format == exportTerraform {
+		out = e.terraform(keys)
+	} else if out, err = e.arm(keys); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(e.Path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), e.Path)
+}
+
+var terraformUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func (e *Exporter) terraform(keys []exportKey) []byte {
+	var b bytes.Buffer
+	for _, k := range keys {
+		rs := e.records[k]
+		rt := strings.ToLower(string(k.rt))
+		id := terraformUnsafe.ReplaceAllString(k.zone+"_"+k.name, "_")
+		fmt.Fprintf(&b, "resource \"azurerm_private_dns_%s_record\" \"%s\" {\n", rt, id)
+		fmt.Fprintf(&b, "  name                = %q\n", k.name)
+		fmt.Fprintf(&b, "  zone_name           = %q\n", k.zone)
+		fmt.Fprintf(&b, "  resource_group_name = %q\n", rs.resourceGroup)
+		fmt.Fprintf(&b, "  ttl                 = %d\n", rs.ttl)
+		switch k.rt {
+		case dns.RecordTypeTXT:
+			for _, v := range rs.values {
+				fmt.Fprintf(&b, "\n  record {\n    value = %q\n  }\n", v)
+			}
+		case dns.RecordTypeMX:
+			for _, v := range rs.values {
+				mx, _ := parseMX(v)
+				fmt.Fprintf(&b, "\n  record {\n    preference = %d\n    exchange   = %q\n  }\n", *mx.Preference, *mx.Exchange)
+			}
+		case dns.RecordTypeCNAME:
+			fmt.Fprintf(&b, "  record              = %q\n", rs.values[0])
+		default:
+			quoted := make([]string, len(rs.values))
+			for i, v := range rs.values {
+				quoted[i] = fmt.Sprintf("%q", v)
+			}
+			fmt.Fprintf(&b, "  records             = [%s]\n", strings.Join(quoted, ", "))
+		}
+		b.WriteString("}\n\n")
+	}
+	return b.Bytes()
+}
+
+func (e *Exporter) arm(keys []exportKey) ([]byte, error) {
+	resources := []map[string]any{}
+	for _, k := range keys {
+		rs := e.records[k]
+		props := map[string]any{"ttl": rs.ttl}
+		switch k.rt {
+		case dns.RecordTypeA:
+			var records []map[string]string
+			for _, v := range rs.values {
+				records = append(records, map[string]string{"ipv4Address": v})
+			}
+			props["aRecords"] = records
+		case dns.RecordTypeAAAA:
+			var records []map[string]string
+			for _, v := range rs.values {
+				records = append(records, map[string]string{"ipv6Address": v})
+			}
+			props["aaaaRecords"] = records
+		case dns.RecordTypeTXT:
+			props["txtRecords"] = []map[string][]string{{"value": rs.values}}
+		case dns.RecordTypeMX:
+			var records []map[string]any
+			for _, v := range rs.values {
+				mx, _ := parseMX(v)
+				records = append(records, map[string]any{"preference": *mx.Preference, "exchange": *mx.Exchange})
+			}
+			props["mxRecords"] = records
+		case dns.RecordTypeCNAME:
+			props["cnameRecord"] = map[string]string{"cname": rs.values[0]}
+		case dns.RecordTypePTR:
+			var records []map[string]string
+			for _, v := range rs.values {
+				records = append(records, map[string]string{"ptrdname": v})
+			}
+			props["ptrRecords"] = records
+		}
+		resources = append(resources, map[string]any{
+			"type":       "Microsoft.Network/privateDnsZones/" + string(k.rt),
+			"apiVersion": exportAPIVersion,
+			"name":       k.zone + "/" + k.name,
+			"properties": props,
+		})
+	}
+	return json.MarshalIndent(map[string]any{
+		"$schema":        "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+		"contentVersion": "1.0.0.0",
+		"resources":      resources,
+	}, "", "  ")
+}
+
+// ExportDNSConfig records what would be written to its zone in an Exporter instead of writing it.
+type ExportDNSConfig struct {
+	*AzureDNSConfig
+	exporter *Exporter
+}
+
+func (x *ExportDNSConfig) key(rt dns.RecordType, dnsName string) (exportKey, error) {
+	name, err := x.relativeName(dnsName)
+	return exportKey{zone: x.ZoneName, rt: rt, name: name}, err
+}
+
+func (x *ExportDNSConfig) UpsertDNSRecords(_ context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	changed := 0
+	if len(ipList) > 0 {
+		// like in azure address records replace a CNAME.
+		key, err := x.key(dns.RecordTypeCNAME, dnsName)
+		if err != nil {
+			return 0, err
+		}
+		if x.exporter.set(key, nil) {
+			changed++
+		}
+	}
+	v4, v6 := splitIPFamilies(ipList)
+	for rt, ips := range map[dns.RecordType][]string{dns.RecordTypeA: v4, dns.RecordTypeAAAA: v6} {
+		key, err := x.key(rt, dnsName)
+		if err != nil {
+			return changed, err
+		}
+		var rs *exportRecordSet
+		if len(ips) > 0 {
+			rs = &exportRecordSet{resourceGroup: x.ResourceGroup, ttl: x.ttl(ttl), values: slices.Sorted(slices.Values(ips))}
+		}
+		if x.exporter.set(key, rs) {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func (x *ExportDNSConfig) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	_, err := x.UpsertDNSRecords(ctx, dnsName, nil, 0)
+	return err
+}
+
+// RetainDNSRecords drops the records, a tombstone has no place in the desired state.
+func (x *ExportDNSConfig) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return x.DeleteDNSRecords(ctx, dnsName)
+}
+
+func (x *ExportDNSConfig) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	for _, n := range dnsNames {
+		if err := x.DeleteDNSRecords(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *ExportDNSConfig) UpsertExtraRecords(_ context.Context, dnsName string, records []ExtraRecord) error {
+	for _, rt := range extraRecordTypes {
+		key, err := x.key(rt, dnsName)
+		if err != nil {
+			return err
+		}
+		rs := exportRecordSet{resourceGroup: x.ResourceGroup}
+		var ttl int64
+		for _, rec := range records {
+			if dns.RecordType(rec.Type) == rt {
+				ttl = max(ttl, rec.TTL)
+				rs.values = append(rs.values, rec.Value)
+			}
+		}
+		if len(rs.values) == 0 {
+			x.exporter.set(key, nil)
+			continue
+		}
+		rs.ttl = x.ttl(ttl)
+		x.exporter.set(key, &rs)
+	}
+	return nil
+}
+
+// UpsertCNAMERecord replaces the address records at dnsName with a CNAME, or drops it for an empty target.
+func (x *ExportDNSConfig) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	key, err := x.key(dns.RecordTypeCNAME, dnsName)
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		x.exporter.set(key, nil)
+		return nil
+	}
+	if _, err := x.UpsertDNSRecords(ctx, dnsName, nil, 0); err != nil {
+		return err
+	}
+	x.exporter.set(key, &exportRecordSet{resourceGroup: x.ResourceGroup, ttl: x.ttl(ttl), values: []string{normalizeTarget(target)}})
+	return nil
+}
+
+func (x *ExportDNSConfig) UpsertPTRRecords(_ context.Context, ips []string, target string) error {
+	for _, ip := range ips {
+		name, ok, err := x.reverseRecordName(ip)
+		if err != nil {
+			return err
+		}
+		if ok {
+			x.exporter.set(exportKey{zone: x.ZoneName, rt: dns.RecordTypePTR, name: name}, &exportRecordSet{resourceGroup: x.ResourceGroup, ttl: x.ttl(0), values: []string{normalizeTarget(target)}})
+		}
+	}
+	return nil
+}
+
+func (x *ExportDNSConfig) DeletePTRRecords(_ context.Context, ips []string) error {
+	for _, ip := range ips {
+		name, ok, err := x.reverseRecordName(ip)
+		if err != nil {
+			return err
+		}
+		if ok {
+			x.exporter.set(exportKey{zone: x.ZoneName, rt: dns.RecordTypePTR, name: name}, nil)
+		}
+	}
+	return nil
+}
+
+func (x *ExportDNSConfig) UpsertTXTRecord(_ context.Context, dnsName string, values []string) error {
+	key, err := x.key(dns.RecordTypeTXT, dnsName)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		x.exporter.set(key, nil)
+		return nil
+	}
+	x.exporter.set(key, &exportRecordSet{resourceGroup: x.ResourceGroup, ttl: x.ttl(0), values: values})
+	return nil
+}
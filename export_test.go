@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportTerraformSnippet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.tf")
+	exporter, err := NewExporter(exportTerraform, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone, sets := newTestAzureDNSConfig(t)
+	svc := testService("web", "10.0.0.2", "10.0.0.1")
+	r, _ := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.dns = &ExportDNSConfig{AzureDNSConfig: zone, exporter: exporter}
+
+	reconcileService(t, r, svc)
+	if err := r.dns.UpsertCNAMERecord(context.Background(), "docs.default.svc", "docs.example.com.", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `resource "azurerm_private_dns_a_record" "example_internal_web_default_svc" {
+  name                = "web.default.svc"
+  zone_name           = "example.internal"
+  resource_group_name = "rg"
+  ttl                 = 300
+  records             = ["10.0.0.1", "10.0.0.2"]
+}
+
+resource "azurerm_private_dns_cname_record" "example_internal_docs_default_svc" {
+  name                = "docs.default.svc"
+  zone_name           = "example.internal"
+  resource_group_name = "rg"
+  ttl                 = 60
+  record              = "docs.example.com"
+}
+
+`
+	if string(got) != want {
+		t.Errorf("terraform export =\n%s\nwant\n%s", got, want)
+	}
+	if len(sets.calls) > 0 {
+		t.Errorf("export mode called azure: %v", sets.calls)
+	}
+}
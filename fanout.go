@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/time/rate"
+)
+
+// ZoneFanout writes every change to each of its zones, at most concurrency zones at a time.
+// Errors from individual zones are aggregated so one failing zone doesn't hide the others.
+// PTR records only go to the reverse zone, if there is one. Every other change must be routed with withZone,
+// to one zone or with an empty one to every zone that isn't routed.
+type ZoneFanout struct {
+	mu          sync.RWMutex              // guards zones and routed, which DNSZones change at runtime
+	zones       map[string]pausableTarget // keyed by zone name
+	concurrency int
+	// routed zones are only written for changes routed to them with withZone, e.g. from -zone mappings.
+	routed map[string]bool
+
+	reverseZone string
+	reverse     pausableTarget // optional, nil skips PTR records
+}
+
+func NewZoneFanout(zones map[string]pausableTarget, concurrency int) *ZoneFanout {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &ZoneFanout{zones: zones, concurrency: concurrency, routed: map[string]bool{}}
+}
+
+// setZone adds or replaces a zone only written for changes routed to it, e.g. from a DNSZone.
+func (f *ZoneFanout) setZone(name string, zone pausableTarget) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones[name] = zone
+	f.routed[name] = true
+}
+
+// removeZone drops a zone added with setZone.
+func (f *ZoneFanout) removeZone(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.zones, name)
+	delete(f.routed, name)
+}
+
+// UpsertDNSRecords counts the record sets changed across every zone written.
+func (f *ZoneFanout) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	var changed atomic.Int64
+	err := f.each(ctx, "upsert", func(zone pausableTarget) error {
+		n, err := zone.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+		changed.Add(int64(n))
+		return err
+	})
+	return int(changed.Load()), err
+}
+
+func (f *ZoneFanout) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	return f.each(ctx, "delete", func(zone pausableTarget) error {
+		return zone.DeleteDNSRecords(ctx, dnsName)
+	})
+}
+
+func (f *ZoneFanout) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return f.each(ctx, "retain", func(zone pausableTarget) error {
+		return zone.RetainDNSRecords(ctx, dnsName)
+	})
+}
+
+func (f *ZoneFanout) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	return f.each(ctx, "upsert-extra", func(zone pausableTarget) error {
+		return zone.UpsertExtraRecords(ctx, dnsName, records)
+	})
+}
+
+func (f *ZoneFanout) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	return f.each(ctx, "upsert-cname", func(zone pausableTarget) error {
+		return zone.UpsertCNAMERecord(ctx, dnsName, target, ttl)
+	})
+}
+
+func (f *ZoneFanout) UpsertPTRRecords(ctx context.Context, ips []string, target string) error {
+	return f.reverseOp("upsert-ptr", func(zone pausableTarget) error {
+		return zone.UpsertPTRRecords(ctx, ips, target)
+	})
+}
+
+func (f *ZoneFanout) DeletePTRRecords(ctx context.Context, ips []string) error {
+	return f.reverseOp("delete-ptr", func(zone pausableTarget) error {
+		return zone.DeletePTRRecords(ctx, ips)
+	})
+}
+
+// reverseOp runs op against the reverse zone, recording it in the zone metrics like each.
+func (f *ZoneFanout) reverseOp(operation string, op func(zone pausableTarget) error) error {
+	if f.reverse == nil {
+		return nil
+	}
+	start := time.Now()
+	err := op(f.reverse)
+	observeZoneWrite(f.reverseZone, operation, start, err)
+	if err != nil {
+		return fmt.Errorf("zone %s: %w", f.reverseZone, err)
+	}
+	return nil
+}
+
+func (f *ZoneFanout) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	return f.each(ctx, "batch-delete", func(zone pausableTarget) error {
+		return zone.BatchDeleteDNSRecords(ctx, dnsNames)
+	})
+}
+
+func (f *ZoneFanout) UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error {
+	return f.each(ctx, "upsert-txt", func(zone pausableTarget) error {
+		return zone.UpsertTXTRecord(ctx, dnsName, values)
+	})
+}
+
+// each runs op against the zone set with withZone, or every zone that isn't routed for an empty one, with
+// bounded parallelism and joins the errors. A context without a zone fails with errUnroutedWrite.
+// Every zone's outcome is recorded in the zone metrics under operation.
+func (f *ZoneFanout) each(ctx context.Context, operation string, op func(zone pausableTarget) error) error {
+	run := func(name string, zone pausableTarget) error {
+		start := time.Now()
+		err := op(zone)
+		observeZoneWrite(name, operation, start, err)
+		return err
+	}
+	name, routed := zoneFromContext(ctx)
+	if !routed {
+		return fmt.Errorf("%s: %w", operation, errUnroutedWrite)
+	}
+	f.mu.RLock()
+	zone, ok := f.zones[name]
+	zones := maps.Clone(f.zones)
+	maps.DeleteFunc(zones, func(name string, _ pausableTarget) bool { return f.routed[name] })
+	f.mu.RUnlock()
+	if name != "" {
+		if !ok {
+			return fmt.Errorf("zone %s: %w", name, errUnknownZone)
+		}
+		if err := run(name, zone); err != nil {
+			return fmt.Errorf("zone %s: %w", name, err)
+		}
+		return nil
+	}
+	if len(zones) == 1 {
+		for name, zone := range zones {
+			if err := run(name, zone); err != nil {
+				return fmt.Errorf("zone %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	sem := make(chan struct{}, f.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for name, zone := range zones {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := run(name, zone); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("zone %s: %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rateLimitPolicy is an azure pipeline policy that makes every request, including retries, wait on
+// a shared limiter so concurrent zone writes can't exceed the global azure request rate.
+// With adaptive set the limit backs off on azure throttling, see aimdLimiter.
+type rateLimitPolicy struct {
+	limiter  *rate.Limiter
+	adaptive *aimdLimiter // optional
+}
+
+func (p rateLimitPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if err := p.limiter.Wait(req.Raw().Context()); err != nil {
+		return nil, err
+	}
+	resp, err := req.Next()
+	if p.adaptive != nil && err == nil {
+		p.adaptive.observe(resp.StatusCode)
+	}
+	return resp, err
+}
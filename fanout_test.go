@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestFanoutRejectsUnroutedWrites(t *testing.T) {
+	a, b := newFakeDNSClient(), newFakeDNSClient()
+	fanout := NewZoneFanout(map[string]pausableTarget{"a.example": a, "b.example": b}, 2)
+	fanout.setZone("routed.example", newFakeDNSClient())
+
+	if err := fanout.DeleteDNSRecords(context.Background(), "web.default.svc"); !errors.Is(err, errUnroutedWrite) {
+		t.Errorf("unrouted delete returned %v, want errUnroutedWrite", err)
+	}
+	if a.callCount()+b.callCount() > 0 {
+		t.Errorf("unrouted delete reached the zones: %v %v", a.calls, b.calls)
+	}
+	if err := fanout.DeleteDNSRecords(withZone(context.Background(), ""), "web.default.svc"); err != nil {
+		t.Fatal(err)
+	}
+	if a.callCount() != 1 || b.callCount() != 1 {
+		t.Errorf("routing to the -zoneName zones made calls %v %v, want one in each", a.calls, b.calls)
+	}
+}
+
+// barrierZone only finishes an upsert once every zone sharing the barrier has started one.
+type barrierZone struct {
+	*fakeDNSClient
+	started *sync.WaitGroup
+	all     <-chan struct{}
+	err     error
+}
+
+func (z *barrierZone) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	z.started.Done()
+	select {
+	case <-z.all:
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("other zones weren't written concurrently")
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	return z.fakeDNSClient.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+}
+
+func TestFanoutWritesZonesConcurrently(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(3)
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	zones := map[string]pausableTarget{}
+	for _, name := range []string{"a.example", "b.example", "c.example"} {
+		z := &barrierZone{fakeDNSClient: newFakeDNSClient(), started: &started, all: all}
+		if name == "b.example" {
+			z.err = errors.New("throttled")
+		}
+		zones[name] = z
+	}
+	fanout := NewZoneFanout(zones, 3)
+
+	_, err := fanout.UpsertDNSRecords(withZone(context.Background(), ""), "web.default.svc", []string{"10.0.0.1"}, 0)
+	if err == nil || !strings.Contains(err.Error(), "b.example") || !strings.Contains(err.Error(), "throttled") {
+		t.Fatalf("fan out returned %v, want the b.example error", err)
+	}
+	if strings.Contains(err.Error(), "concurrently") {
+		t.Fatalf("zones were written one at a time: %v", err)
+	}
+	for _, name := range []string{"a.example", "c.example"} {
+		if got := zones[name].(*barrierZone).snapshot(); len(got["web.default.svc"]) != 1 {
+			t.Errorf("%s records = %v, the failing zone stopped it being written", name, got)
+		}
+	}
+}
+
+func TestReconcileLeavesRecordsInUnknownZone(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	svc.Annotations = map[string]string{publishedZoneAnnotation: "gone.example"}
+	setPublishedNames(svc, []string{"web.default.svc"})
+	svc.Finalizers = []string{finalizer}
+	svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.zones = &ZoneRouter{Zones: []string{"other.example"}}
+
+	reconcileService(t, r, svc)
+	if n := dns.callCount(); n != 0 {
+		t.Errorf("%d azure calls for a zone that isn't configured: %v", n, dns.calls)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &got); err == nil && controllerutil.ContainsFinalizer(&got, finalizer) {
+		t.Errorf("finalizer left on %s", svc.Name)
+	}
+}
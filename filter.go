@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ServiceFilter decides whether a service is managed using a CEL expression.
+// The expression sees the service as `service` and its namespace's labels as `namespaceLabels`, e.g.
+//
+//	size(service.spec.ports) > 1 && namespaceLabels["team"] == "dns"
+//
+// A field the service doesn't have, e.g. service.metadata.labels.team on one without labels, makes it not match.
+type ServiceFilter struct {
+	expr string
+	prg  cel.Program
+	// failing is the last evaluation error logged by service, so requeues don't log it again.
+	failing sync.Map
+}
+
+// NewServiceFilter compiles expr and checks it evaluates to a bool.
+func NewServiceFilter(expr string) (*ServiceFilter, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("service", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("namespaceLabels", cel.MapType(cel.StringType, cel.StringType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("filter expression must evaluate to bool, got %s", ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceFilter{expr: expr, prg: prg}, nil
+}
+
+// Matches evaluates the filter against svc. namespaceLabels may be nil.
+func (f *ServiceFilter) Matches(svc *corev1.Service, namespaceLabels map[string]string) (bool, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(svc)
+	if err != nil {
+		return false, err
+	}
+	if namespaceLabels == nil {
+		namespaceLabels = map[string]string{}
+	}
+	out, _, err := f.prg.Eval(map[string]any{
+		"service":         obj,
+		"namespaceLabels": namespaceLabels,
+	})
+	key := svc.Namespace + "/" + svc.Name
+	if err != nil {
+		err = fmt.Errorf("evaluating %q: %w", f.expr, err)
+		if prev, ok := f.failing.Swap(key, err.Error()); !ok || prev != err.Error() {
+			log.Printf("Warning: -filter-expr failed on %s: %v", key, err)
+		}
+		// the unstructured service has no schema, an absent field is only known to be missing at evaluation.
+		if strings.Contains(err.Error(), "no such key") {
+			return false, nil
+		}
+		return false, err
+	}
+	f.failing.Delete(key)
+	match, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("filter %q returned %T, not bool", f.expr, out.Value())
+	}
+	return match, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServiceFilterMissingKey(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	f, err := NewServiceFilter(`service.metadata.labels.team == "dns"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := testService("web", "10.0.0.1")
+	for range 3 {
+		if match, err := f.Matches(svc, nil); match || err != nil {
+			t.Fatalf("service without labels: match %v, err %v", match, err)
+		}
+	}
+	if n := strings.Count(out.String(), "default/web"); n != 1 {
+		t.Errorf("logged the failure %d times, want once:\n%s", n, out.String())
+	}
+
+	svc.Labels = map[string]string{"team": "dns"}
+	if match, err := f.Matches(svc, nil); !match || err != nil {
+		t.Errorf("labeled service: match %v, err %v", match, err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Gateway API objects are handled as unstructured so the controller doesn't depend on the gateway-api module.
+var (
+	httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+	gatewayGVK   = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+)
+
+// publishedHostnamesAnnotation remembers which hostnames a route or headless service published so dropped ones are cleaned up.
+const publishedHostnamesAnnotation = annotationPrefix + "published-hostnames"
+
+func newHTTPRoute() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(httpRouteGVK)
+	return u
+}
+
+func newGateway() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gatewayGVK)
+	return u
+}
+
+// HTTPRouteReconciler publishes the hostnames of HTTPRoutes pointing at the addresses of their parent Gateways.
+// Hostnames must fall in one of Zones and are written relative to it, to that zone only. Routes get the same
+// finalizer as services.
+type HTTPRouteReconciler struct {
+	client.Client
+	dns      dnsClient
+	recorder record.EventRecorder
+	Zones    []string
+	// SkipDeletes is ServiceReconciler's, records are left in azure and only the finalizer is dropped.
+	SkipDeletes bool
+}
+
+func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx = withRecordSource(ctx, "httproute", req.NamespacedName)
+	route := newHTTPRoute()
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	published := publishedHostnames(route)
+
+	if route.GetDeletionTimestamp() != nil {
+		if !controllerutil.ContainsFinalizer(route, finalizer) {
+			return reconcile.Result{}, nil
+		}
+		log.Printf("Deleting HTTPRoute %s ...", req.NamespacedName)
+		return reconcile.Result{}, r.release(ctx, route)
+	}
+
+	ips, err := r.gatewayAddresses(ctx, route)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	hostnames, _, err := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// the annotation keeps full hostnames, the zone each was written to is found from them again.
+	var names []string
+	for _, h := range hostnames {
+		if _, _, ok := r.relativeHostname(h); !ok {
+			log.Printf("Skipping hostname %s of HTTPRoute %s, it isn't in zones %v", h, req.NamespacedName, r.Zones)
+			continue
+		}
+		names = append(names, strings.ToLower(strings.TrimSuffix(h, ".")))
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	// the finalizer and the hostnames about to be published are recorded before writing any records.
+	if err := updateFinalizer(ctx, r.Client, route, controllerutil.AddFinalizer); err != nil {
+		return reconcile.Result{}, err
+	}
+	pending := slices.Concat(published, names)
+	slices.Sort(pending)
+	pending = slices.Compact(pending)
+	if !slices.Equal(pending, published) {
+		if err := r.patchPublished(ctx, route, pending); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	for _, hostname := range names {
+		name, zone, _ := r.relativeHostname(hostname)
+		if _, err := r.dns.UpsertDNSRecords(withZone(ctx, zone), name, ips, 0); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	dropped := slices.DeleteFunc(slices.Clone(published), func(hostname string) bool { return slices.Contains(names, hostname) })
+	if err := r.deleteHostnames(ctx, route, dropped); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if !slices.Equal(names, pending) {
+		if err := r.patchPublished(ctx, route, names); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	log.Printf("Successfully updated DNS for HTTPRoute %s: %v -> %v", req.NamespacedName, names, ips)
+	return reconcile.Result{}, nil
+}
+
+// release deletes the records route published and then drops our finalizer from it.
+func (r *HTTPRouteReconciler) release(ctx context.Context, route *unstructured.Unstructured) error {
+	ctx = withRecordSource(ctx, "httproute", client.ObjectKeyFromObject(route))
+	if err := r.deleteHostnames(ctx, route, publishedHostnames(route)); err != nil {
+		return err
+	}
+	return updateFinalizer(ctx, r.Client, route, controllerutil.RemoveFinalizer)
+}
+
+// patchPublished records the hostnames route publishes.
+func (r *HTTPRouteReconciler) patchPublished(ctx context.Context, route *unstructured.Unstructured, hostnames []string) error {
+	base := route.DeepCopy()
+	setPublishedHostnames(route, hostnames)
+	return r.Patch(ctx, route, client.MergeFrom(base))
+}
+
+// publishedHostnames reads back the record names a route or headless service published last time.
+func publishedHostnames(obj client.Object) []string {
+	v := obj.GetAnnotations()[publishedHostnamesAnnotation]
+	if v == "" {
+		return nil
+	}
+	names := strings.Split(v, ",")
+	slices.Sort(names)
+	return names
+}
+
+// relativeHostname turns a route hostname into a record name relative to the zone it falls in, and that zone.
+func (r *HTTPRouteReconciler) relativeHostname(hostname string) (name, zone string, ok bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	for _, zone := range r.Zones {
+		if name, ok := strings.CutSuffix(hostname, "."+strings.ToLower(zone)); ok {
+			return name, zone, true
+		}
+	}
+	return "", "", false
+}
+
+// deleteHostnames deletes the records of hostnames route published. With SkipDeletes they are left in azure.
+func (r *HTTPRouteReconciler) deleteHostnames(ctx context.Context, route *unstructured.Unstructured, hostnames []string) error {
+	if r.SkipDeletes {
+		if len(hostnames) > 0 {
+			log.Printf("Not deleting records %v of HTTPRoute %s/%s, -allow-delete is off", hostnames, route.GetNamespace(), route.GetName())
+			r.recorder.Event(route, corev1.EventTypeNormal, recordsNotDeletedReason, recordsNotDeletedMessage)
+		}
+		return nil
+	}
+	for _, hostname := range hostnames {
+		if err := r.deleteHostname(ctx, hostname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteHostname deletes the records of a published hostname from its zone. Routes published before the
+// annotation held full hostnames recorded relative names, those are deleted from every zone as they were written.
+func (r *HTTPRouteReconciler) deleteHostname(ctx context.Context, hostname string) error {
+	if name, zone, ok := r.relativeHostname(hostname); ok {
+		return r.dns.DeleteDNSRecords(withZone(ctx, zone), name)
+	}
+	return r.dns.DeleteDNSRecords(withZone(ctx, ""), hostname)
+}
+
+// gatewayAddresses collects the IP addresses in the status of every Gateway the route is attached to.
+func (r *HTTPRouteReconciler) gatewayAddresses(ctx context.Context, route *unstructured.Unstructured) ([]string, error) {
+	var ips []string
+	for _, gw := range gatewayRefs(route) {
+		gateway := newGateway()
+		if err := r.Get(ctx, gw, gateway); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				log.Printf("Gateway %s of HTTPRoute %s/%s not found", gw, route.GetNamespace(), route.GetName())
+				continue
+			}
+			return nil, err
+		}
+		addresses, _, err := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+		if err != nil {
+			return nil, fmt.Errorf("gateway %s: %w", gw, err)
+		}
+		for _, a := range addresses {
+			addr, ok := a.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// hostname addresses can't go in an A record.
+			if t, _ := addr["type"].(string); t != "" && t != "IPAddress" {
+				continue
+			}
+			if v, _ := addr["value"].(string); v != "" && !slices.Contains(ips, v) {
+				ips = append(ips, v)
+			}
+		}
+	}
+	slices.Sort(ips)
+	return ips, nil
+}
+
+// gatewayRefs returns the Gateways in a route's parentRefs, defaulting the namespace to the route's.
+func gatewayRefs(route *unstructured.Unstructured) []types.NamespacedName {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	var refs []types.NamespacedName
+	for _, p := range parents {
+		ref, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if kind, _ := ref["kind"].(string); kind != "" && kind != "Gateway" {
+			continue
+		}
+		name, _ := ref["name"].(string)
+		ns, _ := ref["namespace"].(string)
+		if ns == "" {
+			ns = route.GetNamespace()
+		}
+		if name != "" {
+			refs = append(refs, types.NamespacedName{Namespace: ns, Name: name})
+		}
+	}
+	return refs
+}
+
+// routesForGateway maps a Gateway to the HTTPRoutes attached to it, so address changes are republished.
+func (r *HTTPRouteReconciler) routesForGateway(ctx context.Context, gateway client.Object) []reconcile.Request {
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind("HTTPRouteList"))
+	if err := r.List(ctx, routes); err != nil {
+		log.Printf("Failed to list HTTPRoutes for Gateway %s/%s: %v", gateway.GetNamespace(), gateway.GetName(), err)
+		return nil
+	}
+	key := client.ObjectKeyFromObject(gateway)
+	var reqs []reconcile.Request
+	for i := range routes.Items {
+		if slices.Contains(gatewayRefs(&routes.Items[i]), key) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&routes.Items[i])})
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestHTTPRouteWritesToMatchedZone(t *testing.T) {
+	gateway := newGateway()
+	gateway.SetNamespace("default")
+	gateway.SetName("gw")
+	_ = unstructured.SetNestedSlice(gateway.Object, []interface{}{map[string]interface{}{"type": "IPAddress", "value": "10.0.0.1"}}, "status", "addresses")
+	route := newHTTPRoute()
+	route.SetNamespace("default")
+	route.SetName("web")
+	_ = unstructured.SetNestedSlice(route.Object, []interface{}{map[string]interface{}{"name": "gw"}}, "spec", "parentRefs")
+	_ = unstructured.SetNestedStringSlice(route.Object, []string{"www.a.example", "api.b.example.", "www.elsewhere.example"}, "spec", "hostnames")
+
+	c := fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(gateway, route).Build()
+	dns := newFakeDNSClient()
+	r := &HTTPRouteReconciler{Client: c, dns: dns, Zones: []string{"a.example", "b.example"}}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	for zone, name := range map[string]string{"a.example": "www", "b.example": "api"} {
+		if !dns.zones[zone][name] || len(dns.zones[zone]) != 1 {
+			t.Errorf("zone %s was written %v, want only %s", zone, dns.zones[zone], name)
+		}
+	}
+	if len(dns.zones[""]) > 0 {
+		t.Errorf("written to every zone: %v", dns.zones[""])
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"}, route); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := publishedHostnames(route), []string{"api.b.example", "www.a.example"}; !slices.Equal(got, want) {
+		t.Errorf("published hostnames %v, want %v", got, want)
+	}
+}
+
+func TestHTTPRouteUnchangedNotWritten(t *testing.T) {
+	gateway := newGateway()
+	gateway.SetNamespace("default")
+	gateway.SetName("gw")
+	_ = unstructured.SetNestedSlice(gateway.Object, []interface{}{map[string]interface{}{"type": "IPAddress", "value": "10.0.0.1"}}, "status", "addresses")
+	route := newHTTPRoute()
+	route.SetNamespace("default")
+	route.SetName("web")
+	_ = unstructured.SetNestedSlice(route.Object, []interface{}{map[string]interface{}{"name": "gw"}}, "spec", "parentRefs")
+	_ = unstructured.SetNestedStringSlice(route.Object, []string{"www.a.example"}, "spec", "hostnames")
+
+	var writes []string
+	c := interceptor.NewClient(fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(gateway, route).Build(), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			writes = append(writes, "patch")
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			writes = append(writes, "update")
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+	r := &HTTPRouteReconciler{Client: c, dns: newFakeDNSClient(), Zones: []string{"a.example"}}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	// the finalizer and the hostname, each patched once.
+	if !slices.Equal(writes, []string{"patch", "patch"}) {
+		t.Errorf("first reconcile wrote the route with %v, want two patches", writes)
+	}
+	writes = nil
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(writes) > 0 {
+		t.Errorf("unchanged route written with %v", writes)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// HeadlessReconciler publishes headless services from their endpoints, which ServiceReconciler skips.
+// Every ready address goes in <service>.<namespace>.svc and endpoints with a hostname also get
+// <hostname>.<service>.<namespace>.svc, as in the kubernetes DNS spec, svc being RecordSuffix. With TopologyRecords
+// endpoints with a topology zone also go in <zone>.<service>.<namespace>.svc. Requests are keyed by service,
+// see endpointSliceHandler. The names published are kept in an annotation so dropped ones are deleted.
+type HeadlessReconciler struct {
+	client.Client
+	APIReader client.Reader // pages EndpointSlices, the cache ignores paging
+	dns       dnsClient
+	shard     Shard
+	state     *ReconcilerState
+	recorder  record.EventRecorder
+	// LegacyEndpoints reads core/v1 Endpoints instead of EndpointSlices.
+	LegacyEndpoints bool
+	// SkipDeletes is ServiceReconciler's, records are left in azure and only the finalizer is dropped.
+	SkipDeletes bool
+	// DeleteProtectedNamespaces is ServiceReconciler's, records there are retained as tombstones.
+	DeleteProtectedNamespaces map[string]bool
+	// RecordSuffix is ServiceReconciler's, both name services the same way.
+	RecordSuffix string
+	// zones routes services to a zone like ServiceReconciler's, nil writes them to the -zoneName zones.
+	zones *ZoneRouter
+	// TopologyRecords publishes the addresses in each topology zone at their own name, see topologyName.
+	// Legacy Endpoints carry no zones so there are none with LegacyEndpoints.
+	TopologyRecords bool
+	// optOut is why a service isn't managed, see ServiceReconciler.optOut. nil manages every headless service.
+	optOut func(ctx context.Context, svc *corev1.Service) (string, error)
+	// names resolves service wide names claimed by more than one service like ServiceReconciler's, nil trusts them to be unique.
+	names *NameRegistry
+	// recordTTL is the TTL a service's records get, see ServiceReconciler.recordTTL. nil uses the zone's.
+	recordTTL func(svc *corev1.Service) int64
+}
+
+func (r *HeadlessReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx = withRecordSource(ctx, "service", req.NamespacedName)
+	if !r.shard.owns(req.NamespacedName) {
+		return reconcile.Result{}, nil
+	}
+	var svc corev1.Service
+	if err := r.Get(ctx, req.NamespacedName, &svc); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		return reconcile.Result{}, nil
+	}
+	published := publishedHostnames(&svc)
+	publishedZone := svc.Annotations[publishedZoneAnnotation]
+	// records are removed from the zone they were written to, like the service reconciler does.
+	known, err := r.zones.Known(ctx, publishedZone)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !known && len(published) > 0 {
+		// e.g. its DNSZone was deleted, nothing can be removed from a zone that isn't configured.
+		log.Printf("Zone %s of headless Service %s is no longer configured, leaving its records there", publishedZone, req.NamespacedName)
+		published = nil
+	}
+
+	if svc.DeletionTimestamp != nil {
+		if !controllerutil.ContainsFinalizer(&svc, finalizer) {
+			return reconcile.Result{}, nil
+		}
+		log.Printf("Deleting headless Service %s ...", req.NamespacedName)
+		if err := r.deleteNames(withZone(ctx, publishedZone), &svc, published); err != nil {
+			return reconcile.Result{}, err
+		}
+		r.names.release(req.NamespacedName)
+		return reconcile.Result{}, updateFinalizer(ctx, r.Client, &svc, controllerutil.RemoveFinalizer)
+	}
+	if r.optOut != nil {
+		reason, err := r.optOut(ctx, &svc)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if reason != "" {
+			if !controllerutil.ContainsFinalizer(&svc, finalizer) {
+				return reconcile.Result{}, nil
+			}
+			log.Printf("Headless Service %s %s, removing its records", req.NamespacedName, reason)
+			if err := r.deleteNames(withZone(ctx, publishedZone), &svc, published); err != nil {
+				return reconcile.Result{}, err
+			}
+			if err := r.patchPublished(ctx, &svc, nil, ""); err != nil {
+				return reconcile.Result{}, err
+			}
+			r.names.release(req.NamespacedName)
+			return reconcile.Result{}, updateFinalizer(ctx, r.Client, &svc, controllerutil.RemoveFinalizer)
+		}
+	}
+
+	// routed like the service reconciler routes other services, see ZoneRouter.
+	zone, err := r.zones.Zone(ctx, &svc)
+	if err != nil {
+		log.Printf("Refusing to publish headless Service %s: %v", req.NamespacedName, err)
+		return reconcile.Result{}, nil
+	}
+	if zone != publishedZone && len(published) > 0 {
+		log.Printf("Headless Service %s moved from zone %q to %q, removing its records from the old zone", req.NamespacedName, publishedZone, zone)
+		if err := r.deleteNames(withZone(ctx, publishedZone), &svc, published); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.patchPublished(ctx, &svc, nil, zone); err != nil {
+			return reconcile.Result{}, err
+		}
+		published = nil
+	}
+	ctx = withZone(ctx, zone)
+
+	records, err := r.desiredRecords(ctx, &svc)
+	if errors.Is(err, errInvalidHostname) {
+		// nothing to retry until the annotation is fixed, which queues the service again.
+		r.recorder.Event(&svc, corev1.EventTypeWarning, "InvalidHostname", err.Error())
+		log.Printf("Refusing to publish headless Service %s: %v", req.NamespacedName, err)
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	names := slices.Sorted(maps.Keys(records))
+
+	// like HTTPRoutes the finalizer and the names about to be published are recorded before writing.
+	if err := updateFinalizer(ctx, r.Client, &svc, controllerutil.AddFinalizer); err != nil {
+		return reconcile.Result{}, err
+	}
+	pending := slices.Concat(published, names)
+	slices.Sort(pending)
+	pending = slices.Compact(pending)
+	if !slices.Equal(pending, published) || zone != publishedZone {
+		if err := r.patchPublished(ctx, &svc, pending, zone); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	var ttl int64
+	if r.recordTTL != nil {
+		ttl = r.recordTTL(&svc)
+	}
+	// upserts are authoritative, so addresses that went away are dropped from the record sets.
+	for _, name := range names {
+		if _, err := r.dns.UpsertDNSRecords(ctx, name, records[name], ttl); err != nil {
+			return reconcile.Result{}, err
+		}
+		r.state.published(name, records[name])
+	}
+	var dropped []string
+	for _, name := range published {
+		if _, ok := records[name]; !ok {
+			dropped = append(dropped, name)
+		}
+	}
+	if err := r.deleteNames(ctx, &svc, dropped); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if !slices.Equal(names, pending) {
+		if err := r.patchPublished(ctx, &svc, names, zone); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	log.Printf("Successfully updated DNS for headless Service %s: %v", req.NamespacedName, records)
+	return reconcile.Result{}, nil
+}
+
+// deleteNames deletes the records svc published at names, in the zone set on ctx, or retains them as
+// tombstones in a delete protected namespace like ServiceReconciler.removeRecords. With SkipDeletes
+// they are only forgotten.
+func (r *HeadlessReconciler) deleteNames(ctx context.Context, svc *corev1.Service, names []string) error {
+	if r.SkipDeletes && len(names) > 0 {
+		log.Printf("Not deleting records %v of headless Service %s/%s, -allow-delete is off", names, svc.Namespace, svc.Name)
+		r.recorder.Event(svc, corev1.EventTypeNormal, recordsNotDeletedReason, recordsNotDeletedMessage)
+		for _, name := range names {
+			r.state.removed(name)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := removeRecords(ctx, r.dns, r.DeleteProtectedNamespaces, svc, name); err != nil {
+			return err
+		}
+		r.state.removed(name)
+	}
+	return nil
+}
+
+// patchPublished records the names svc publishes and the zone they are in.
+func (r *HeadlessReconciler) patchPublished(ctx context.Context, svc *corev1.Service, names []string, zone string) error {
+	base := svc.DeepCopy()
+	setPublishedHostnames(svc, names)
+	if zone == "" {
+		delete(svc.Annotations, publishedZoneAnnotation)
+	} else {
+		svc.Annotations[publishedZoneAnnotation] = zone
+	}
+	return r.Patch(ctx, svc, client.MergeFrom(base))
+}
+
+// desiredRecords maps every name svc should publish to its ready addresses, see endpointAggregate.
+func (r *HeadlessReconciler) desiredRecords(ctx context.Context, svc *corev1.Service) (map[string][]string, error) {
+	key := client.ObjectKeyFromObject(svc)
+	base, err := serviceRecordName(svc, r.RecordSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if r.names != nil {
+		// retried with backoff in case the other service goes away.
+		if base, err = r.names.Claim(base, key); err != nil {
+			return nil, err
+		}
+	}
+	// legacy Endpoints carry no topology zones.
+	agg := newEndpointAggregate(key, base, maxRecordsPerSet, r.TopologyRecords && !r.LegacyEndpoints)
+	if r.LegacyEndpoints {
+		var ep corev1.Endpoints
+		if err := r.APIReader.Get(ctx, key, &ep); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		agg.addLegacy(&ep)
+	} else if err := pageEndpointSlices(ctx, r.APIReader, key, agg.addSlice); err != nil {
+		return nil, err
+	}
+	return agg.records(), nil
+}
+
+func setPublishedHostnames(obj client.Object, names []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[publishedHostnamesAnnotation] = strings.Join(names, ",")
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTestHeadlessReconciler returns a HeadlessReconciler over a fake cluster holding objs and a fake zone.
+func newTestHeadlessReconciler(t *testing.T, objs ...client.Object) (*HeadlessReconciler, *fakeDNSClient) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(objs...).Build()
+	dns := newFakeDNSClient()
+	return &HeadlessReconciler{Client: c, APIReader: c, dns: dns, state: NewReconcilerState(), recorder: record.NewFakeRecorder(100), RecordSuffix: "svc"}, dns
+}
+
+func testEndpointSlice(service, name string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+}
+
+func zonedEndpoint(zone string, addrs ...string) discoveryv1.Endpoint {
+	ep := discoveryv1.Endpoint{Addresses: addrs, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}}
+	if zone != "" {
+		ep.Zone = ptr.To(zone)
+	}
+	return ep
+}
+
+func TestHeadlessTopologyRecords(t *testing.T) {
+	objs := []client.Object{
+		testService("db", corev1.ClusterIPNone),
+		testEndpointSlice("db", "db-a",
+			zonedEndpoint("EastUS-1", "10.0.1.2"),
+			zonedEndpoint("eastus-1", "10.0.1.1"),
+			zonedEndpoint("", "10.0.3.1")),
+		testEndpointSlice("db", "db-b",
+			zonedEndpoint("eastus-2", "10.0.2.1"),
+			discoveryv1.Endpoint{Addresses: []string{"10.0.2.9"}, Zone: ptr.To("eastus-2"), Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(false)}}),
+	}
+	for _, enabled := range []bool{false, true} {
+		r, dns := newTestHeadlessReconciler(t, objs...)
+		r.RecordSuffix = "cluster"
+		r.TopologyRecords = enabled
+		if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}}); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		want := map[string][]string{"db.default.cluster": {"10.0.1.1", "10.0.1.2", "10.0.2.1", "10.0.3.1"}}
+		if enabled {
+			want["eastus-1.db.default.cluster"] = []string{"10.0.1.1", "10.0.1.2"}
+			want["eastus-2.db.default.cluster"] = []string{"10.0.2.1"}
+		}
+		if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+			t.Errorf("topology records %v: records = %v, want %v", enabled, got, want)
+		}
+	}
+}
+
+func TestHeadlessRoutesByZone(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	svc.Annotations = map[string]string{zoneAnnotation: "other.example"}
+	r, dns := newTestHeadlessReconciler(t, svc, testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.1.1")))
+	r.zones = &ZoneRouter{Zones: []string{"other.example"}}
+	key := types.NamespacedName{Namespace: "default", Name: "db"}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !dns.zones["other.example"]["db.default.svc"] || len(dns.zones[""]) > 0 {
+		t.Errorf("written to zones %v, want only other.example", dns.zones)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[publishedZoneAnnotation] != "other.example" || !controllerutil.ContainsFinalizer(&got, finalizer) {
+		t.Errorf("annotations %v, finalizers %v", got.Annotations, got.Finalizers)
+	}
+
+	// deleting removes the records from the zone they were published to.
+	if err := r.Delete(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	dns.zones = map[string]map[string]bool{}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(dns.records) > 0 || !dns.zones["other.example"]["db.default.svc"] {
+		t.Errorf("left records %v, deleted in zones %v", dns.records, dns.zones)
+	}
+	if err := r.Get(context.Background(), key, &got); err == nil {
+		t.Errorf("service still exists with finalizers %v", got.Finalizers)
+	}
+}
+
+func TestHeadlessDeleteFromUnknownZone(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	svc.Annotations = map[string]string{publishedZoneAnnotation: "gone.example"}
+	setPublishedHostnames(svc, []string{"db.default.svc"})
+	svc.Finalizers = []string{finalizer}
+	svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	r, dns := newTestHeadlessReconciler(t, svc)
+	r.zones = &ZoneRouter{Zones: []string{"other.example"}}
+	key := types.NamespacedName{Namespace: "default", Name: "db"}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if n := dns.callCount(); n != 0 {
+		t.Errorf("%d azure calls for a zone that isn't configured: %v", n, dns.calls)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), key, &got); err == nil {
+		t.Errorf("service still exists with finalizers %v", got.Finalizers)
+	}
+}
+
+func TestHeadlessExcludedRemovesRecords(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	svc.Annotations = map[string]string{excludeAnnotation: "true"}
+	setPublishedHostnames(svc, []string{"db.default.svc"})
+	svc.Finalizers = []string{finalizer}
+	r, dns := newTestHeadlessReconciler(t, svc, testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.1.1")))
+	r.optOut = (&ServiceReconciler{}).optOut
+	dns.records["db.default.svc"] = []string{"10.0.1.1"}
+	key := types.NamespacedName{Namespace: "default", Name: "db"}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(dns.records) > 0 {
+		t.Errorf("excluded service left records %v", dns.records)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if controllerutil.ContainsFinalizer(&got, finalizer) || len(publishedHostnames(&got)) > 0 {
+		t.Errorf("finalizers %v, published %v", got.Finalizers, publishedHostnames(&got))
+	}
+}
+
+func TestHeadlessOverRecordSetLimit(t *testing.T) {
+	var a, b []discoveryv1.Endpoint
+	for i := range maxRecordsPerSet + 5 {
+		addr := fmt.Sprintf("10.0.0.%d", i+1)
+		ep := zonedEndpoint("", addr)
+		ep.Hostname = ptr.To("shared")
+		if i%2 == 0 {
+			a = append(a, ep)
+		} else {
+			b = append(b, ep)
+		}
+	}
+	r, dns := newTestHeadlessReconciler(t, testService("db", corev1.ClusterIPNone), testEndpointSlice("db", "db-a", a...), testEndpointSlice("db", "db-b", b...))
+	truncated := testutil.ToFloat64(endpointsTruncated)
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	// the numerically lowest addresses whichever slice they are in: 10.0.0.1 to 10.0.0.20, where string
+	// order would have kept 10.0.0.10 to 10.0.0.19 over 10.0.0.3 to 10.0.0.9.
+	want := []string{
+		"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9", "10.0.0.10",
+		"10.0.0.11", "10.0.0.12", "10.0.0.13", "10.0.0.14", "10.0.0.15", "10.0.0.16", "10.0.0.17", "10.0.0.18", "10.0.0.19", "10.0.0.20",
+	}
+	for _, name := range []string{"db.default.svc", "shared.db.default.svc"} {
+		if got := dns.records[name]; !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(endpointsTruncated) - truncated; got != 2 {
+		t.Errorf("counted %v truncations, want 2", got)
+	}
+}
+
+func TestHeadlessLegacyEndpoints(t *testing.T) {
+	ep := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.1.2", Hostname: "db-0"}, {IP: "10.0.1.1"}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.1.9", Hostname: "db-9"}},
+				Ports:             []corev1.EndpointPort{{Port: 5432}},
+			},
+			{
+				// another port set, the same address isn't published twice.
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.2.1", Hostname: "db-1"}, {IP: "10.0.1.1"}},
+				Ports:     []corev1.EndpointPort{{Port: 9187}},
+			},
+		},
+	}
+	// slices are ignored with LegacyEndpoints.
+	slice := testEndpointSlice("db", "db-a", zonedEndpoint("eastus-1", "10.0.3.1"))
+	r, dns := newTestHeadlessReconciler(t, testService("db", corev1.ClusterIPNone), ep, slice)
+	r.LegacyEndpoints = true
+	r.TopologyRecords = true
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := map[string][]string{
+		"db.default.svc":      {"10.0.1.1", "10.0.1.2", "10.0.2.1"},
+		"db-0.db.default.svc": {"10.0.1.2"},
+		"db-1.db.default.svc": {"10.0.2.1"},
+	}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointSliceBurstWrittenOnce(t *testing.T) {
+	slice := testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.0.1"))
+	r, dns := newTestHeadlessReconciler(t, testService("db", corev1.ClusterIPNone), slice)
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+	debounce := 50 * time.Millisecond
+	h := endpointSliceHandler(debounce)
+	ctx := context.Background()
+
+	// a scale up touches the slices five times in quick succession.
+	for i := range 5 {
+		old := slice.DeepCopy()
+		slice.Endpoints = append(slice.Endpoints, zonedEndpoint("", fmt.Sprintf("10.0.0.%d", i+2)))
+		if err := r.Update(ctx, slice); err != nil {
+			t.Fatal(err)
+		}
+		h.Update(ctx, event.UpdateEvent{ObjectOld: old, ObjectNew: slice}, q)
+	}
+	// a slice of no service is dropped.
+	h.Create(ctx, event.CreateEvent{Object: &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default"}}}, q)
+	if q.Len() > 0 {
+		t.Fatalf("%d requests queued before the debounce passed", q.Len())
+	}
+
+	req, _ := q.Get()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	q.Done(req)
+	time.Sleep(2 * debounce)
+	if q.Len() > 0 {
+		t.Errorf("%d more requests queued for the burst", q.Len())
+	}
+	if got := slices.DeleteFunc(slices.Clone(dns.calls), func(c string) bool { return c != "upsert db.default.svc" }); len(got) != 1 {
+		t.Errorf("azure calls %v, want a single write", dns.calls)
+	}
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	if got := dns.records["db.default.svc"]; !slices.Equal(got, want) {
+		t.Errorf("db.default.svc = %v, want %v", got, want)
+	}
+}
+
+func TestHeadlessInvalidHostnameNotRetried(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	svc.Annotations = map[string]string{hostnameAnnotation: "not_a_hostname"}
+	r, dns := newTestHeadlessReconciler(t, svc, testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.1.1")))
+	res, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(svc)})
+	if err != nil || res.Requeue || res.RequeueAfter > 0 {
+		t.Errorf("Reconcile = %+v, %v, want it not retried until the annotation changes", res, err)
+	}
+	if len(dns.calls) > 0 {
+		t.Errorf("azure calls %v for an invalid hostname", dns.calls)
+	}
+	if !recordedEvent(r.recorder, "InvalidHostname") {
+		t.Error("no InvalidHostname event")
+	}
+}
+
+func TestAddressSelectorOrder(t *testing.T) {
+	s := addressSelector{limit: 3}
+	for _, addr := range []string{"fd00::1", "10.0.0.10", "10.0.0.9", "10.0.0.9", "9.0.0.1", "10.0.0.100"} {
+		s.add(netip.MustParseAddr(addr))
+	}
+	want := []string{"9.0.0.1", "10.0.0.9", "10.0.0.10"}
+	if got := s.result(types.NamespacedName{Namespace: "default", Name: "db"}, "db.default.svc"); !slices.Equal(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeatRecordName is the TXT record the controller refreshes to show it is alive.
+// Like the controller's other TXT records it is reserved, see reservedRecordName.
+const heartbeatRecordName = "controller-health"
+
+// Heartbeat periodically writes the current time and the time of the last successful
+// reconcile to the controller-health TXT record, so a stalled controller can be spotted with a DNS lookup.
+type Heartbeat struct {
+	dns      txtWriter
+	Interval time.Duration
+
+	lastSuccess atomic.Int64 // unix seconds, 0 before the first success
+}
+
+func NewHeartbeat(dns txtWriter, interval time.Duration) *Heartbeat {
+	return &Heartbeat{dns: dns, Interval: interval}
+}
+
+// succeeded records a successful reconcile. Safe to call on a nil heartbeat.
+func (h *Heartbeat) succeeded() {
+	if h == nil {
+		return
+	}
+	h.lastSuccess.Store(time.Now().Unix())
+}
+
+// Start implements manager.Runnable.
+func (h *Heartbeat) Start(ctx context.Context) error {
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	for {
+		h.write(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Heartbeat) write(ctx context.Context) {
+	values := []string{"heartbeat=" + time.Now().UTC().Format(time.RFC3339)}
+	if last := h.lastSuccess.Load(); last != 0 {
+		values = append(values, "last-reconcile="+time.Unix(last, 0).UTC().Format(time.RFC3339))
+	}
+	if err := h.dns.UpsertTXTRecord(withZone(ctx, ""), heartbeatRecordName, values); err != nil {
+		log.Printf("Failed to write %s heartbeat: %v", heartbeatRecordName, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatRefreshesRecord(t *testing.T) {
+	dns := newFakeDNSClient()
+	h := NewHeartbeat(dns, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- h.Start(ctx) }()
+
+	// the record is written straight away, then again on every tick with the last success added.
+	waitForTXT := func(cond func([]string) bool) []string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			dns.mu.Lock()
+			values := slices.Clone(dns.txt[heartbeatRecordName])
+			dns.mu.Unlock()
+			if cond(values) {
+				return values
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("%s never refreshed, calls %v", heartbeatRecordName, dns.calls)
+		return nil
+	}
+	first := waitForTXT(func(v []string) bool { return len(v) > 0 })
+	if len(first) != 1 || !strings.HasPrefix(first[0], "heartbeat=") {
+		t.Errorf("first heartbeat = %v, want only heartbeat=<time>", first)
+	}
+	h.succeeded()
+	refreshed := waitForTXT(func(v []string) bool { return len(v) == 2 })
+	if !strings.HasPrefix(refreshed[1], "last-reconcile=") {
+		t.Errorf("refreshed heartbeat = %v, want last-reconcile=<time>", refreshed)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range dns.calls {
+		if call != "upsert-txt "+heartbeatRecordName {
+			t.Errorf("unexpected call %s", call)
+		}
+	}
+}
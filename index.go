@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexRecordName is the TXT record listing every service the controller manages. An index too long for one
+// record set continues in services-index-1, services-index-2 and so on, readers stop at the first one missing.
+const indexRecordName = "services-index"
+
+// maxTXTStringLen is the DNS limit for a single character-string in a TXT record.
+const maxTXTStringLen = 255
+
+// indexPartStrings is how many strings go in each index record set, keeping it under the 1024 characters
+// azure allows in a TXT record set.
+const indexPartStrings = 4
+
+// maxIndexParts caps the record sets the index is split across. Names past the cap are left out and logged.
+const maxIndexParts = 20
+
+type txtWriter interface {
+	UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error
+}
+
+// ServiceIndex keeps a TXT record listing all managed service names up to date.
+// Writes are debounced so a burst of service changes results in a single update.
+type ServiceIndex struct {
+	dns      txtWriter
+	debounce time.Duration
+
+	mu    sync.Mutex
+	names map[string]struct{}
+	timer *time.Timer
+	parts int // index record sets last written, -1 before the first write when any up to maxIndexParts may be left over
+}
+
+func NewServiceIndex(dns txtWriter, debounce time.Duration) *ServiceIndex {
+	return &ServiceIndex{
+		dns:      dns,
+		debounce: debounce,
+		names:    map[string]struct{}{},
+		parts:    -1,
+	}
+}
+
+// Add records a service name and schedules an index write if it is new.
+func (i *ServiceIndex) Add(name string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.names[name]; ok {
+		return
+	}
+	i.names[name] = struct{}{}
+	i.schedule()
+}
+
+// Remove drops a service name and schedules an index write if it was present.
+func (i *ServiceIndex) Remove(name string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.names[name]; !ok {
+		return
+	}
+	delete(i.names, name)
+	i.schedule()
+}
+
+// schedule (re)starts the debounce timer. Caller must hold mu.
+func (i *ServiceIndex) schedule() {
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+	i.timer = time.AfterFunc(i.debounce, func() {
+		if err := i.Flush(context.Background()); err != nil {
+			log.Printf("Failed to update %s TXT record: %v", indexRecordName, err)
+		}
+	})
+}
+
+// Flush writes the current index immediately, split across as many record sets as it needs.
+// Record sets left from a longer index are removed.
+func (i *ServiceIndex) Flush(ctx context.Context) error {
+	// the index lists services of every zone but lives in the -zoneName zones.
+	ctx = withZone(ctx, "")
+	i.mu.Lock()
+	names := make([]string, 0, len(i.names))
+	for n := range i.names {
+		names = append(names, n)
+	}
+	previous := i.parts
+	i.mu.Unlock()
+
+	sort.Strings(names)
+	chunks := chunkNames(names, maxTXTStringLen)
+	if len(chunks) > indexPartStrings*maxIndexParts {
+		log.Printf("Warning: services index is over %d record sets, leaving out %d of %d strings of names", maxIndexParts, len(chunks)-indexPartStrings*maxIndexParts, len(chunks))
+		chunks = chunks[:indexPartStrings*maxIndexParts]
+	}
+	parts := 0
+	for ; len(chunks) > 0; parts++ {
+		n := min(indexPartStrings, len(chunks))
+		if err := i.dns.UpsertTXTRecord(ctx, indexPartName(parts), chunks[:n]); err != nil {
+			return err
+		}
+		chunks = chunks[n:]
+	}
+	if previous < 0 {
+		previous = maxIndexParts
+	}
+	for part := parts; part < previous; part++ {
+		if err := i.dns.UpsertTXTRecord(ctx, indexPartName(part), nil); err != nil {
+			return err
+		}
+	}
+	i.mu.Lock()
+	i.parts = parts
+	i.mu.Unlock()
+	return nil
+}
+
+// indexPartName is the record set holding part n of the index, counting from 0.
+func indexPartName(n int) string {
+	if n == 0 {
+		return indexRecordName
+	}
+	return fmt.Sprintf("%s-%d", indexRecordName, n)
+}
+
+// chunkNames packs space separated names into strings no longer than max.
+// A single name longer than max is split across strings.
+func chunkNames(names []string, max int) []string {
+	var chunks []string
+	var cur strings.Builder
+	for _, n := range names {
+		if cur.Len() > 0 && cur.Len()+1+len(n) > max {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteByte(' ')
+		}
+		for len(n) > max-cur.Len() {
+			split := max - cur.Len()
+			cur.WriteString(n[:split])
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+			n = n[split:]
+		}
+		cur.WriteString(n)
+	}
+	// azure rejects an empty TXT record set so always write at least one string.
+	if cur.Len() > 0 || len(chunks) == 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
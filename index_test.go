@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// indexContent joins the index parts back together like a reader would, stopping at the first missing one.
+func indexContent(dns *fakeDNSClient) (names []string, parts int) {
+	for ; ; parts++ {
+		values, ok := dns.txt[indexPartName(parts)]
+		if !ok {
+			return names, parts
+		}
+		for _, v := range values {
+			if len(v) > maxTXTStringLen {
+				panic(fmt.Sprintf("string of %d characters in %s", len(v), indexPartName(parts)))
+			}
+		}
+		names = append(names, strings.Fields(strings.Join(values, " "))...)
+	}
+}
+
+func TestServiceIndexFlush(t *testing.T) {
+	dns := newFakeDNSClient()
+	index := NewServiceIndex(dns, 0)
+	var want []string
+	for n := range 200 {
+		name := fmt.Sprintf("svc-%03d.default.svc", n)
+		index.names[name] = struct{}{}
+		want = append(want, name)
+	}
+	if err := index.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, parts := indexContent(dns)
+	if !slices.Equal(got, want) {
+		t.Errorf("index holds %d names, want %d: %v", len(got), len(want), got)
+	}
+	if parts < 2 {
+		t.Errorf("index of %d names written to %d record sets, want it split", len(want), parts)
+	}
+	for p := range parts {
+		if n := len(dns.txt[indexPartName(p)]); n > indexPartStrings {
+			t.Errorf("%s holds %d strings, at most %d fit", indexPartName(p), n, indexPartStrings)
+		}
+	}
+
+	// a shorter index removes the parts it no longer needs.
+	for _, name := range want[1:] {
+		delete(index.names, name)
+	}
+	if err := index.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, parts := indexContent(dns); !slices.Equal(got, want[:1]) || parts != 1 {
+		t.Errorf("index holds %v in %d record sets, want %v in 1", got, parts, want[:1])
+	}
+	if len(dns.txt) != 1 {
+		t.Errorf("left over index record sets: %v", dns.txt)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// errNotLeader is returned for azure writes attempted while this instance isn't the leader.
+var errNotLeader = errors.New("not the leader, refusing azure write")
+
+// LeaderGuard only lets azure writes through while this instance holds leadership.
+// It is added to the manager as a leader election runnable, so Start runs once elected and
+// its context is cancelled when leadership is lost. That cancels in flight writes and turns
+// the instance passive so a new leader never races a stale one.
+// Without leader election the manager starts it straight away and it only stops on shutdown.
+type LeaderGuard struct {
+	dns pausableTarget
+
+	mu        sync.RWMutex
+	leaderCtx context.Context // nil until elected
+}
+
+func NewLeaderGuard(dns pausableTarget) *LeaderGuard {
+	return &LeaderGuard{dns: dns}
+}
+
+// Start implements manager.Runnable.
+func (g *LeaderGuard) Start(ctx context.Context) error {
+	g.mu.Lock()
+	g.leaderCtx = ctx
+	g.mu.Unlock()
+	log.Println("Acquired leadership, azure writes enabled")
+
+	<-ctx.Done()
+	log.Println("Lost leadership or shutting down, azure writes disabled")
+	return nil
+}
+
+// leading reports whether writes are currently let through.
+func (g *LeaderGuard) leading() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.leaderCtx != nil && g.leaderCtx.Err() == nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (g *LeaderGuard) NeedLeaderElection() bool {
+	return true
+}
+
+func (g *LeaderGuard) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	var changed int
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		changed, err = g.dns.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+		return err
+	})
+	return changed, err
+}
+
+func (g *LeaderGuard) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.DeleteDNSRecords(ctx, dnsName)
+	})
+}
+
+func (g *LeaderGuard) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.RetainDNSRecords(ctx, dnsName)
+	})
+}
+
+func (g *LeaderGuard) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.UpsertExtraRecords(ctx, dnsName, records)
+	})
+}
+
+func (g *LeaderGuard) UpsertPTRRecords(ctx context.Context, ips []string, target string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.UpsertPTRRecords(ctx, ips, target)
+	})
+}
+
+func (g *LeaderGuard) DeletePTRRecords(ctx context.Context, ips []string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.DeletePTRRecords(ctx, ips)
+	})
+}
+
+func (g *LeaderGuard) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.UpsertCNAMERecord(ctx, dnsName, target, ttl)
+	})
+}
+
+func (g *LeaderGuard) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.BatchDeleteDNSRecords(ctx, dnsNames)
+	})
+}
+
+func (g *LeaderGuard) UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.dns.UpsertTXTRecord(ctx, dnsName, values)
+	})
+}
+
+// do runs op with a context that is also cancelled if leadership is lost mid call.
+func (g *LeaderGuard) do(ctx context.Context, op func(context.Context) error) error {
+	g.mu.RLock()
+	leaderCtx := g.leaderCtx
+	g.mu.RUnlock()
+	if leaderCtx == nil || leaderCtx.Err() != nil {
+		return errNotLeader
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(leaderCtx, cancel)
+	defer stop()
+	return op(ctx)
+}
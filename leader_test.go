@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaderGuardHaltsWritesAfterLosingLeadership(t *testing.T) {
+	dns := newFakeDNSClient()
+	guard := NewLeaderGuard(dns)
+	ctx := withZone(context.Background(), "")
+	if _, err := guard.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); !errors.Is(err, errNotLeader) {
+		t.Errorf("write before being elected returned %v, want errNotLeader", err)
+	}
+
+	leaderCtx, loseLeadership := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		guard.Start(leaderCtx)
+		close(stopped)
+	}()
+	for !guard.leading() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := guard.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatalf("write as the leader: %v", err)
+	}
+
+	loseLeadership()
+	<-stopped
+	if _, err := guard.UpsertDNSRecords(ctx, "db.default.svc", []string{"10.0.0.2"}, 0); !errors.Is(err, errNotLeader) {
+		t.Errorf("write after losing leadership returned %v, want errNotLeader", err)
+	}
+	if n := dns.callCount(); n != 1 {
+		t.Errorf("azure calls = %v, want only the one made as the leader", dns.calls)
+	}
+}
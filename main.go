@@ -1,23 +1,57 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	// Core Kubernetes types
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
 
 	// Kubebuilder/controller-runtime imports
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	// Azure DNS SDK
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/azcore/log"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/dns/armdns"
 	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"golang.org/x/time/rate"
 )
 
 //https://github.com/kubernetes/dns/blob/master/docs/specification.md
@@ -31,101 +65,954 @@ import (
 	ttl 30
   }*/
 
-//TODO endpoint slices controller for headless
 //TODO SRV records
-//TODO PTR records
 
-// +kubebuilder:rbac:groups="",resources=pods;services,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods;services;namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=dns.azure.com,resources=aggregaterecords,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=dns.azure.com,resources=dnszones,verbs=get;list;watch
 
 func main() {
 	var (
 		subscriptionID = flag.String("subscription", "", "Azure subscription ID")
 		resourceGroup  = flag.String("resourcegroup", "", "Azure resource group")
-		zoneName       = flag.String("zoneName", "cluster.local", "DNS Zone name (e.g. example.com)")
+		zoneName       = flag.String("zoneName", "cluster.local", "DNS Zone name (e.g. example.com). Comma separate several zones to write every record to each of them")
+		zoneType       = flag.String("zoneType", zoneTypePrivate, "Kind of Azure DNS zone the zones are: private or public")
+		zoneConcurrent = flag.Int("zone-concurrency", 4, "How many zones a single change is written to in parallel")
+		azureQPS       = flag.Float64("azure-qps", 10, "Maximum Azure DNS requests per second across all zones, 0 for no limit")
+		azureBurst     = flag.Int("azure-burst", 20, "Burst allowed above -azure-qps")
+		adaptiveQPS    = flag.Bool("azure-adaptive-qps", false, "Halve the Azure request rate whenever Azure throttles and slowly recover up to -azure-qps")
+		shutdownWait   = flag.Duration("shutdown-timeout", 30*time.Second, "How long Azure writes in flight at shutdown get to finish before they are cancelled")
+		recordCacheTTL = flag.Duration("record-cache-ttl", 10*time.Minute, "How long record sets read from or written to Azure DNS are trusted before being read again, the zones are relisted every half of it. 0 reads every record set before writing it")
+		azureTimeout   = flag.Duration("azure-timeout", 30*time.Second, "How long a single Azure DNS call may take before it fails and is retried, 0 for no limit")
+		apiVersion     = flag.String("azure-api-version", "", "Pin the Azure private DNS API version (defaults to the SDK's version)")
+		corednsCompat  = flag.Bool("coredns-compat", false, "Mirror the AKS CoreDNS kubernetes plugin: default -ttl to 30, -zoneName to cluster.local and -record-suffix to svc.cluster.local, each unless set explicitly. -ttl-from-soa and the runtime configmap still override the ttl")
+		recordTTL      = flag.Int64("ttl", defaultTTL, "Default TTL in seconds for records, services can override it with the dns.azure.com/ttl annotation")
+		ttlFromSOA     = flag.Bool("ttl-from-soa", false, "Default record TTL to each zone's SOA minimum TTL instead of -ttl")
+		zonePolicy     = flag.Bool("zone-policy", false, "Read default TTL and allowed record types from dns.azure.com/ tags on each Azure zone")
+		softDelete     = flag.Bool("soft-delete", false, "Tombstone records of deleted services and only purge them after -soft-delete-retention")
+		softRetention  = flag.Duration("soft-delete-retention", time.Hour, "How long tombstoned records are kept before being purged")
+		clientID       = flag.String("client-id", "", "Client ID of the user-assigned managed identity or workload identity to authenticate as, instead of whatever DefaultAzureCredential finds")
+		tenantID       = flag.String("tenant-id", "", "Tenant of the -client-id workload identity, defaults to $AZURE_TENANT_ID")
+		credSecret     = flag.String("credential-secret", "", "namespace/name of a secret with tenantId, clientId and clientSecret to authenticate with. Reloaded when the secret changes")
+		paused         = flag.Bool("paused", false, "Start with all Azure writes and deletes paused")
+		runtimeConfig  = flag.String("runtime-configmap", "", "namespace/name of a configmap with hot reloadable paused, ttl and filter-expr keys")
+		deleteBatch    = flag.Int("delete-batch-threshold", 3, "Delete records as one batch once this many services in a namespace are deleting at once, 0 to disable")
+		logWrites      = flag.Bool("log-written-records", false, "Log each record set as stored in Azure after it is written")
+		namespaces     = flag.String("namespace", "", "Comma separated namespaces to manage services in, empty for all")
+		selector       = flag.String("selector", "", "Label selector limiting the services managed, e.g. dns=azure")
+		filterExpr     = flag.String("filter-expr", "", "CEL expression over `service` and `namespaceLabels` selecting which services to manage, e.g. size(service.spec.ports) > 1")
+		notifyWebhook  = flag.String("notify-webhook", "", "URL that receives a JSON POST describing the outcome of every reconcile")
+		publishAPISvc  = flag.Bool("publish-kubernetes-service", false, "Also publish records for the default/kubernetes API server service")
+		confirmWrites  = flag.Bool("confirm-writes", false, "Read each record set back after writing it and retry the reconcile if it doesn't match")
+		nameCollision  = flag.String("name-collision", "", "What to do when two services want the same record name: reject or hash (suffix the namespace hash). Empty skips collision tracking")
+		auditLog       = flag.String("audit-log", "", "File to append a JSON audit line to for every Azure mutation, - for stdout")
+		debugAddr      = flag.String("debug-addr", "", "Address to serve a JSON dump of internal state on /debug, e.g. :8082. Off when empty")
+		publishMode    = flag.String("publish-mode", publishExternal, "Addresses LoadBalancer services publish: cluster-ip, external (the load balancer ingress, a CNAME for a hostname ingress) or both")
+		publishExtIPs  = flag.Bool("publish-external-ips", false, "Publish each service's spec.externalIPs as <service>.<namespace>.external")
+		metricsAddr    = flag.String("metrics-bind-address", ":8080", "Address to serve Prometheus metrics on, 0 to disable")
+		probeAddr      = flag.String("health-probe-addr", ":8081", "Address to serve /healthz and /readyz on, 0 to disable")
+		verifyOnStart  = flag.Bool("verify-on-start", false, "Reconcile every service against Azure at startup and only report ready once that sweep finishes")
+		sortedSync     = flag.Bool("sorted-initial-sync", false, "Reconcile every service once at startup in namespace/name order, for reproducible logs. Also orders the -verify-on-start sweep")
+		heartbeat      = flag.Duration("heartbeat-interval", 0, "How often to refresh the controller-health TXT record with a heartbeat, 0 to disable")
+		allowedNames   = flag.String("allowed-names", "", "Regular expression record names must fully match before the controller writes or deletes them, e.g. .*\\.team-a\\.svc. Empty allows every name")
+		shadowExtDNS   = flag.Bool("shadow-external-dns", false, "Never write to Azure, instead compare the records this controller would publish with those external-dns owns and report differences")
+		extDNSOwner    = flag.String("external-dns-owner", "", "Only count records with this external-dns owner id as owned in -shadow-external-dns mode")
+		shardCount     = flag.Int("shard-count", 1, "Split services across this many replicas by hashing namespace/name, each replica needs a distinct -shard-index")
+		shardIndex     = flag.Int("shard-index", -1, "Which shard this replica reconciles, -1 takes it from the StatefulSet pod ordinal in the hostname")
+		minTTL         = flag.Int64("min-ttl", 0, "Floor for every record TTL, 0 for none")
+		maxTTL         = flag.Int64("max-ttl", 0, "Ceiling for every record TTL, 0 for none")
+		criticality    = flag.String("criticality-ttls", "high=30,normal=300,low=3600", "TTL for each dns.azure.com/criticality annotation tier")
+		recordSuffix   = flag.String("record-suffix", "svc", "Labels following <service>.<namespace> in record names. One ending in the zone name is relative to that zone, e.g. svc.cluster.local writes web.default.svc in zone cluster.local but web.default.svc.cluster.local in zone example.com. Empty leaves <service>.<namespace>")
+		ipv6Label      = flag.String("ipv6-label", "", "Publish AAAA records at <service>.<label>.<namespace>.svc instead of alongside the A records, e.g. v6")
+		protectedNS    = flag.String("delete-protected-namespaces", "", "Comma separated namespaces whose deleted services only have their records tombstoned, never purged, unless annotated dns.azure.com/allow-delete=true")
+		gatewayAPI     = flag.Bool("enable-gateway-api", false, "Publish the hostnames of Gateway API HTTPRoutes pointing at their Gateways' addresses")
+		resyncPeriod   = flag.Duration("resync-period", 0, "Re-reconcile every published service this often to correct drift in Azure, 0 to disable")
+		resyncJitter   = flag.Duration("resync-jitter", 5*time.Minute, "Random extra delay per service on top of -resync-period so resyncs are spread out")
+		stabilization  = flag.Duration("stabilization-delay", 0, "Only publish a new service once it is this old, so short lived services never get records")
+		maxNames       = flag.Int("max-names-per-service", 0, "Most record names a single service may publish, 0 for no limit")
+		exportFormat   = flag.String("export", "", "Never write to Azure, instead keep -export-file up to date with the desired records as terraform or arm")
+		exportFile     = flag.String("export-file", "", "File -export writes the desired records to")
+		dryRun         = flag.Bool("dry-run", false, "Log every record set the controller would write or delete instead of changing Azure")
+		verboseLogs    = flag.Bool("v", false, "Log debug messages too")
+		zoneWait       = flag.Duration("zone-wait", 5*time.Minute, "How long to wait at startup for a zone that doesn't exist yet, e.g. one created alongside the controller")
+		azureSDKLog    = flag.Bool("azure-sdk-log", false, "Log the Azure SDK's HTTP requests, responses and retries, for troubleshooting")
+		summaryEvery   = flag.Duration("summary-interval", 0, "Log a summary of reconciles, errors and Azure writes this often, 0 to disable")
+		controllerID   = flag.String("controller-id", "", "Stamp written record sets with this owner id and the service they are for, and never touch record sets another id owns. Empty disables ownership checks")
+		orphanGC       = flag.Duration("orphan-gc-interval", 0, "How often the leader deletes records this -controller-id published for services that no longer exist, 0 to disable")
+		adoptUnowned   = flag.Bool("adopt-unowned", true, "With -controller-id, take over record sets without an owner, e.g. written before ownership was turned on. Off leaves them alone, e.g. records created by hand")
+		canarySelector = flag.String("canary-selector", "", "Label selector for canary services that get -canary-behavior while the rest keep the current behavior")
+		canaryBehavior = flag.String("canary-behavior", "", "Behavior canary services get, currently only ttl=<seconds>, e.g. ttl=60")
+		apexPolicy     = flag.String("apex-policy", apexReject, "What to do with A and AAAA records that would land on a zone's apex: reject, allow or redirect=<name>")
+		dnsZoneCRD     = flag.Bool("enable-dnszones", false, "Also write services to the zones of DNSZone resources, picked by their namespace selector or the dns.azure.com/zone annotation. Needs the CRD in config/crd")
+		workers        = flag.Int("workers", 1, "How many services are reconciled at once")
+		updateDebounce = flag.Duration("update-debounce", time.Second, "How long to wait after a service update before reconciling it, updates in the meantime are folded in. 0 reconciles straight away")
+		cleanup        = flag.Bool("cleanup", false, "Delete the records of every service, and of AggregateRecords and HTTPRoutes when enabled, and remove their finalizers, then exit. For uninstalling, safe to run again")
+		aggregates     = flag.Bool("enable-aggregate-records", false, "Publish AggregateRecords, record names combining the IPs of the services they select. Needs the CRD in config/crd")
+		allowDelete    = flag.Bool("allow-delete", true, "Delete records of deleted services. When false finalizers are removed without deleting anything, for identities without delete permission")
+		reverseZone    = flag.String("reverseZone", "", "Reverse DNS zone (e.g. 10.in-addr.arpa) to publish PTR records for service cluster IPs in, pointing at their names in the zone each service is published to. Off when empty")
+		headless       = flag.Bool("publish-headless", false, "Publish headless services from their EndpointSlices, every ready address and a record per endpoint hostname")
+		legacyEndpts   = flag.Bool("legacy-endpoints", false, "With -publish-headless read core/v1 Endpoints instead of EndpointSlices, for clusters or tools that don't keep slices up to date")
+		topologyRecs   = flag.Bool("topology-records", false, "With -publish-headless also publish <zone>.<service>.<namespace>.<record-suffix> per topology zone, holding the ready addresses in that zone. Needs EndpointSlices")
+		endptDebounce  = flag.Duration("endpoints-debounce", 2*time.Second, "How long to wait for a headless service's EndpointSlices to settle before publishing them")
+		conflictRetry  = flag.Int("write-conflict-retries", 3, "How many times a record set write is retried after another writer changed the record set first")
+		leaderElect    = flag.Bool("enable-leader-election", false, "Elect a leader so only one of several replicas reconciles and writes to azure")
+		leaderElectID  = flag.String("leader-election-id", "azure-k8s-dns", "Name of the lease used for leader election")
+		leaderElectNS  = flag.String("leader-election-namespace", "", "Namespace of the leader election lease, defaults to $POD_NAMESPACE from the downward API when not set")
+		serviceIndex   = flag.Bool("service-index", false, "Maintain a services-index TXT record listing all managed services")
+		indexDebounce  = flag.Duration("service-index-debounce", 10*time.Second, "How long to wait for service changes to settle before rewriting the services index")
 	)
+	kubeconfig := kubeconfigFlag(flag.CommandLine)
+	zoneMap := zoneMappings{}
+	flag.Var(zoneMap, "zone", "namespace=zoneName, repeat to write the services of a namespace to their own zone instead of the -zoneName zones. Overridden by the dns.azure.com/zone annotation")
+	flag.StringVar(controllerID, "owner-id", "", "Same as -controller-id, the name external-dns users know it by")
+	flag.StringVar(probeAddr, "health-probe-bind-address", ":8081", "Same as -health-probe-addr, the name kubebuilder scaffolding uses")
 	flag.Parse()
-	ctx := context.Background()
+	if *corednsCompat {
+		if err := applyCorednsCompat(flag.CommandLine); err != nil {
+			log.Fatalf("Invalid -coredns-compat defaults: %v", err)
+		}
+	}
+	verbose = *verboseLogs
+	if *azureSDKLog {
+		enableAzureSDKLog()
+	}
+	// SIGTERM cancels setup too, the manager is started with the same context.
+	ctx := ctrl.SetupSignalHandler()
 
 	// Basic validation
 	if *subscriptionID == "" || *resourceGroup == "" || *zoneName == "" {
 		log.Fatal("All flags -subscription, -resourcegroup, -zoneName are required.")
 	}
+	suffix, err := parseRecordSuffix(*recordSuffix)
+	if err != nil {
+		log.Fatalf("Invalid -record-suffix: %v", err)
+	}
+	if *corednsCompat && !slices.Contains(strings.Split(*zoneName, ","), corednsZone) {
+		log.Printf("Warning: -coredns-compat with -zoneName %s, CoreDNS serves %s", *zoneName, corednsZone)
+	}
 
-	cfg, err := rest.InClusterConfig()
+	cfg, err := kubeConfig(kubeconfig.Value.String())
 	if err != nil {
 		log.Fatalf("Unable to get Kubernetes config: %v", err)
 	}
 
-	// Create the manager
-	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+	mgrOpts := ctrl.Options{
 		Scheme: schemeSetup(),
-	})
+		// the priority queue lets deletions be reconciled ahead of a backlog of creates and updates.
+		Controller: config.Controller{UsePriorityQueue: ptr.To(true)},
+
+		HealthProbeBindAddress: *probeAddr,
+		Metrics:                metricsserver.Options{BindAddress: *metricsAddr},
+
+		LeaderElection:   *leaderElect,
+		LeaderElectionID: *leaderElectID,
+		// LeaderGuard stops writes as soon as leadership is lost, so the lease can be handed over straight away.
+		LeaderElectionReleaseOnCancel: true,
+		// past -shutdown-timeout so the Drain gives up on the writes in flight before the manager gives up on it.
+		GracefulShutdownTimeout: ptr.To(*shutdownWait + 5*time.Second),
+	}
+	if *leaderElect {
+		// the flag wins over the downward API, it is only the default.
+		mgrOpts.LeaderElectionNamespace = cmp.Or(*leaderElectNS, os.Getenv("POD_NAMESPACE"))
+		if mgrOpts.LeaderElectionNamespace == "" {
+			log.Fatal("-enable-leader-election needs $POD_NAMESPACE or -leader-election-namespace")
+		}
+	}
+
+	// namespaced objects are only watched in -namespace, the secret and configmap below set their own.
+	for _, ns := range strings.Split(*namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			if mgrOpts.Cache.DefaultNamespaces == nil {
+				mgrOpts.Cache.DefaultNamespaces = map[string]cache.Config{}
+			}
+			mgrOpts.Cache.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+
+	// only cache the one secret and configmap we care about.
+	mgrOpts.Cache.ByObject = map[client.Object]cache.ByObject{}
+	var secretRef types.NamespacedName
+	if *credSecret != "" {
+		secretRef, err = parseObjectRef(*credSecret)
+		if err != nil {
+			log.Fatalf("Invalid -credential-secret: %v", err)
+		}
+		mgrOpts.Cache.ByObject[&corev1.Secret{}] = singleObjectCache(secretRef)
+	}
+	var runtimeRef types.NamespacedName
+	if *runtimeConfig != "" {
+		runtimeRef, err = parseObjectRef(*runtimeConfig)
+		if err != nil {
+			log.Fatalf("Invalid -runtime-configmap: %v", err)
+		}
+		mgrOpts.Cache.ByObject[&corev1.ConfigMap{}] = singleObjectCache(runtimeRef)
+	}
+
+	var sel labels.Selector
+	if *selector != "" {
+		sel, err = labels.Parse(*selector)
+		if err != nil {
+			log.Fatalf("Invalid -selector: %v", err)
+		}
+	}
+
+	var filter *ServiceFilter
+	if *filterExpr != "" {
+		filter, err = NewServiceFilter(*filterExpr)
+		if err != nil {
+			log.Fatalf("Invalid -filter-expr: %v", err)
+		}
+	}
+
+	shard := Shard{Index: *shardIndex, Count: *shardCount}
+	if shard.Count > 1 {
+		if *serviceIndex {
+			log.Fatal("-service-index lists every service and can't be used with -shard-count > 1")
+		}
+		// only the leader would reconcile, the other shards' services would never be published.
+		if *leaderElect {
+			log.Fatal("-enable-leader-election can't be used with -shard-count > 1, every shard replica must reconcile")
+		}
+		if shard.Index == -1 {
+			shard.Index, err = shardIndexFromHostname()
+			if err != nil {
+				log.Fatalf("Unable to determine -shard-index: %v", err)
+			}
+		}
+	}
+	if err := shard.validate(); err != nil {
+		log.Fatalf("Invalid sharding: %v", err)
+	}
+	if shard.Count > 1 {
+		log.Printf("Reconciling shard %d of %d", shard.Index, shard.Count)
+	}
+
+	criticalityTTLs, err := parseCriticalityTTLs(*criticality)
+	if err != nil {
+		log.Fatalf("Invalid -criticality-ttls: %v", err)
+	}
+	if *recordTTL <= 0 {
+		log.Fatalf("-ttl must be positive, got %d", *recordTTL)
+	}
+	mode, err := parsePublishMode(*publishMode)
+	if err != nil {
+		log.Fatalf("Invalid -publish-mode: %v", err)
+	}
+
+	var canary *Canary
+	if *canarySelector != "" {
+		canary, err = NewCanary(*canarySelector, *canaryBehavior)
+		if err != nil {
+			log.Fatalf("Invalid -canary-selector or -canary-behavior: %v", err)
+		}
+		log.Printf("Services matching %s are canaries", canary.Selector)
+	} else if *canaryBehavior != "" {
+		log.Fatal("-canary-behavior needs -canary-selector")
+	}
+
+	var names *NameRegistry
+	if *nameCollision != "" {
+		names, err = NewNameRegistry(*nameCollision)
+		if err != nil {
+			log.Fatalf("Invalid -name-collision: %v", err)
+		}
+	}
+
+	// Create the manager
+	mgr, err := ctrl.NewManager(cfg, mgrOpts)
 	if err != nil {
 		log.Fatalf("Unable to start manager: %v", err)
 	}
+	if names != nil {
+		if err := names.Seed(ctx, mgr.GetAPIReader(), suffix); err != nil {
+			log.Fatalf("Unable to read the names services are published under: %v", err)
+		}
+	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	var limiter *rate.Limiter
+	if *azureQPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(*azureQPS), *azureBurst)
+	}
+	zt, err := parseZoneType(*zoneType)
 	if err != nil {
-		log.Fatalf("Failed to get Azure credentials: %v", err)
+		log.Fatalf("Invalid -zoneType: %v", err)
 	}
-	dnsClient, err := dns.NewRecordSetsClient(*subscriptionID, cred, nil)
+	if zt == zoneTypePublic && *apiVersion != "" {
+		log.Fatalf("-azure-api-version only applies to private zones")
+	}
+	clientOpts, err := recordSetsClientOptions(*apiVersion, limiter, *adaptiveQPS)
+	if err != nil {
+		log.Fatalf("Invalid -azure-api-version: %v", err)
+	}
+
+	if *credSecret != "" && (*clientID != "" || *tenantID != "") {
+		log.Fatal("-credential-secret already names the identity, it can't be used with -client-id or -tenant-id")
+	}
+	var cred azcore.TokenCredential
+	var credReconciler *CredentialSecretReconciler
+	if *credSecret != "" {
+		rotating := &RotatingCredential{}
+		credReconciler = &CredentialSecretReconciler{Reader: mgr.GetAPIReader(), Secret: secretRef, cred: rotating}
+		if err := credReconciler.Load(ctx); err != nil {
+			log.Fatalf("Failed to load Azure credentials from secret %s: %v", secretRef, err)
+		}
+		credReconciler.Reader = mgr.GetClient()
+		cred = rotating
+	} else {
+		var kind string
+		cred, kind, err = newAzureCredential(*clientID, *tenantID)
+		if err != nil {
+			log.Fatalf("Failed to get Azure credentials: %v", err)
+		}
+		log.Printf("Authenticating to Azure with %s", kind)
+	}
+	dnsClient, zonesClient, err := newAzureClients(zt, *subscriptionID, cred, clientOpts)
 	if err != nil {
-		log.Fatalf("Failed to get Azure dns client: %v", err)
+		log.Fatalf("Failed to get Azure dns clients: %v", err)
+	}
+
+	var audit *AuditLogger
+	if *auditLog != "" {
+		w := os.Stdout
+		if *auditLog != "-" {
+			w, err = os.OpenFile(*auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				log.Fatalf("Unable to open -audit-log: %v", err)
+			}
+		}
+		audit = NewAuditLogger(w, azureActor(*credSecret, *clientID))
 	}
 
-	// TODO contructor for AzureDNSConfig
-	dnscfg := &AzureDNSConfig{
-		SubscriptionID: *subscriptionID,
-		ResourceGroup:  *resourceGroup,
-		ZoneName:       *zoneName,
-		DNSClient:      dnsClient,
+	var exporter *Exporter
+	if *exportFormat != "" {
+		exporter, err = NewExporter(*exportFormat, *exportFile)
+		if err != nil {
+			log.Fatalf("Invalid -export: %v", err)
+		}
 	}
 
-	MustSetTxTVerion(ctx, dnscfg)
+	drain := NewDrain(ctx, *shutdownWait)
+	if err := mgr.Add(drain); err != nil {
+		log.Fatalf("Unable to add shutdown drain: %v", err)
+	}
+	ttlOverride := &atomic.Int64{}
+	var purgers []*TombstonePurger
+	var policyZones []*AzureDNSConfig
+	var writtenZones []*AzureDNSConfig
+	zones := map[string]pausableTarget{}
+	zoneOpts := []Option{
+		WithTTL(*recordTTL),
+		WithTTLOverride(ttlOverride),
+		WithTTLBounds(*minTTL, *maxTTL),
+		WithDryRun(*dryRun),
+		WithOwnerID(*controllerID, *adoptUnowned),
+		WithZonesClient(zonesClient),
+		WithAudit(audit),
+		WithWriteChecks(*logWrites, *confirmWrites),
+		WithConflictRetries(*conflictRetry),
+		WithCallTimeout(*azureTimeout),
+		WithRecordCache(*recordCacheTTL),
+		WithDrain(drain),
+		WithPublic(zt == zoneTypePublic),
+	}
+	// zones only named by -zone mappings are written for the services routed to them alone.
+	var zoneList []string
+	for _, zone := range strings.Split(*zoneName, ",") {
+		zoneList = append(zoneList, strings.TrimSpace(zone))
+	}
+	routed := map[string]bool{}
+	for _, zone := range zoneMap {
+		if !slices.Contains(zoneList, zone) {
+			zoneList = append(zoneList, zone)
+			routed[zone] = true
+		}
+	}
+	for _, zone := range zoneList {
+		dnscfg, err := NewAzureDNSConfig(*subscriptionID, *resourceGroup, zone, dnsClient, slices.Concat(zoneOpts, []Option{WithApexPolicy(*apexPolicy)})...)
+		if err != nil {
+			log.Fatalf("Invalid configuration for zone %q: %v", zone, err)
+		}
+
+		if err := dnscfg.Preflight(ctx, *zoneWait); err != nil {
+			log.Fatalf("Startup check of zone %s failed, %v", zone, err)
+		}
+
+		if *ttlFromSOA {
+			dnscfg.UseSOAMinimumTTL(ctx)
+		}
+
+		if *zonePolicy {
+			if err := dnscfg.LoadZonePolicy(ctx); err != nil {
+				log.Fatalf("Failed to load zone policy: %v", err)
+			}
+			policyZones = append(policyZones, dnscfg)
+		}
+
+		if exporter != nil {
+			zones[zone] = &ExportDNSConfig{AzureDNSConfig: dnscfg, exporter: exporter}
+			continue
+		}
+		if *shadowExtDNS {
+			zones[zone] = &ShadowDNSConfig{AzureDNSConfig: dnscfg, Owner: *extDNSOwner}
+			continue
+		}
+
+		MustSetTXTVersion(ctx, dnscfg)
+
+		zones[zone] = dnscfg
+		writtenZones = append(writtenZones, dnscfg)
+		if *softDelete {
+			zones[zone] = &SoftDeleteDNSConfig{AzureDNSConfig: dnscfg}
+			purgers = append(purgers, &TombstonePurger{dns: dnscfg, Retention: *softRetention, Interval: time.Minute})
+		}
+	}
+
+	if *recordCacheTTL > 0 && len(writtenZones) > 0 {
+		if err := mgr.Add(&RecordCacheSync{zones: writtenZones, Interval: *recordCacheTTL / 2}); err != nil {
+			log.Fatalf("Unable to add record cache sync: %v", err)
+		}
+	}
+
+	if len(policyZones) > 0 {
+		if err := mgr.Add(&ZonePolicyRefresher{zones: policyZones, Interval: 10 * time.Minute}); err != nil {
+			log.Fatalf("Unable to add zone policy refresher: %v", err)
+		}
+	}
+
+	fanout := NewZoneFanout(zones, *zoneConcurrent)
+	fanout.routed = routed
+	if *reverseZone != "" {
+		revcfg, err := NewAzureDNSConfig(*subscriptionID, *resourceGroup, *reverseZone, dnsClient, zoneOpts...)
+		if err != nil {
+			log.Fatalf("Invalid configuration for reverse zone %q: %v", *reverseZone, err)
+		}
+		if err := revcfg.Preflight(ctx, *zoneWait); err != nil {
+			log.Fatalf("Startup check of reverse zone %s failed, %v", *reverseZone, err)
+		}
+		fanout.reverseZone = *reverseZone
+		switch {
+		case exporter != nil:
+			fanout.reverse = &ExportDNSConfig{AzureDNSConfig: revcfg, exporter: exporter}
+		case *shadowExtDNS:
+			fanout.reverse = &ShadowDNSConfig{AzureDNSConfig: revcfg, Owner: *extDNSOwner}
+		default:
+			fanout.reverse = revcfg
+		}
+	}
+	guard := NewLeaderGuard(fanout)
+	if err := mgr.Add(guard); err != nil {
+		log.Fatalf("Unable to add leader guard: %v", err)
+	}
+	pausable := NewPausableDNS(guard, *paused)
+	// everything writing or deleting records for services goes through the allowlist, the TXT records don't.
+	serviceDNS, err := withAllowlist(pausable, *allowedNames)
+	if err != nil {
+		log.Fatalf("Invalid -allowed-names: %v", err)
+	}
+	for _, purger := range purgers {
+		purger.Paused = pausable.Paused
+		if err := mgr.Add(purger); err != nil {
+			log.Fatalf("Unable to add tombstone purger: %v", err)
+		}
+	}
+	if *orphanGC > 0 {
+		if *controllerID == "" {
+			log.Fatalf("-orphan-gc-interval needs -controller-id to tell this controller's records apart")
+		}
+		gc := &OrphanCollector{Reader: mgr.GetAPIReader(), zones: writtenZones, dns: serviceDNS, Interval: *orphanGC, Paused: pausable.Paused}
+		if err := mgr.Add(gc); err != nil {
+			log.Fatalf("Unable to add orphan collector: %v", err)
+		}
+	}
 
 	sr := &ServiceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		dns:    dnscfg,
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		dns:      serviceDNS,
+		names:    names,
+		state:    NewReconcilerState(),
+		recorder: mgr.GetEventRecorderFor("azure-k8s-dns"),
+		shard:    shard,
+		canary:   canary,
+		backoff:  NewAzureBackoff(5*time.Second, 10*time.Minute),
+		failures: NewEventLimiter(10 * time.Minute),
+
+		DeleteBatchThreshold:    *deleteBatch,
+		PublishAPIServerService: *publishAPISvc,
+		PublishExternalIPs:      *publishExtIPs,
+		PublishMode:             mode,
+		PublicZones:             zt == zoneTypePublic,
+		PTRDomain:               ptrDomain(*reverseZone, *zoneName),
+		Zones:                   slices.DeleteFunc(slices.Sorted(maps.Keys(zones)), func(zone string) bool { return routed[zone] }),
+		CriticalityTTLs:         criticalityTTLs,
+		IPv6Label:               *ipv6Label,
+		RecordSuffix:            suffix,
+		StabilizationDelay:      *stabilization,
+		MaxNamesPerService:      *maxNames,
+		SkipDeletes:             !*allowDelete,
+		ResyncPeriod:            *resyncPeriod,
+		ResyncJitter:            *resyncJitter,
+		Selector:                sel,
+	}
+	sr.filter.Store(filter)
+	sr.zones = &ZoneRouter{Namespaces: zoneMap, Zones: slices.Sorted(maps.Keys(zones))}
+	if *dnsZoneCRD {
+		sr.zones.DNSZones = mgr.GetClient()
+	}
+	for _, ns := range strings.Split(*protectedNS, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			if sr.DeleteProtectedNamespaces == nil {
+				sr.DeleteProtectedNamespaces = map[string]bool{}
+			}
+			sr.DeleteProtectedNamespaces[ns] = true
+		}
+	}
+	if *notifyWebhook != "" {
+		sr.notifier = NewNotifier(*notifyWebhook, 5*time.Second, 3)
+		if err := mgr.Add(sr.notifier); err != nil {
+			log.Fatalf("Unable to add webhook notifier: %v", err)
+		}
+	}
+	if *summaryEvery > 0 {
+		if err := mgr.Add(&Summary{state: sr.state, Interval: *summaryEvery}); err != nil {
+			log.Fatalf("Unable to add summary log: %v", err)
+		}
+	}
+	if *debugAddr != "" {
+		if err := mgr.Add(&DebugServer{Addr: *debugAddr, state: sr.state, pause: pausable, backoff: sr.backoff, zones: writtenZones}); err != nil {
+			log.Fatalf("Unable to add debug server: %v", err)
+		}
+	}
+	if *heartbeat > 0 {
+		sr.health = NewHeartbeat(pausable, *heartbeat)
+		if err := mgr.Add(sr.health); err != nil {
+			log.Fatalf("Unable to add heartbeat: %v", err)
+		}
+	}
+	if *serviceIndex {
+		sr.index = NewServiceIndex(pausable, *indexDebounce)
+	}
+
+	var dz *DNSZoneReconciler
+	if *dnsZoneCRD {
+		dz = &DNSZoneReconciler{Client: mgr.GetClient(), fanout: fanout, static: sr.zones.Zones}
+		// DNSZones get the same options and wrappers as the -zoneName zones, only soft deleted records aren't purged.
+		dz.newZone = func(ctx context.Context, spec DNSZoneSpec) (pausableTarget, error) {
+			sub, rg := cmp.Or(spec.SubscriptionID, *subscriptionID), cmp.Or(spec.ResourceGroup, *resourceGroup)
+			records, zc := dnsClient, zonesClient
+			if sub != *subscriptionID {
+				var err error
+				if records, zc, err = newAzureClients(zt, sub, cred, clientOpts); err != nil {
+					return nil, err
+				}
+			}
+			opts := slices.Concat(zoneOpts, []Option{WithZonesClient(zc), WithApexPolicy(*apexPolicy)})
+			if spec.TTL > 0 {
+				opts = append(opts, WithTTL(spec.TTL))
+			}
+			dnscfg, err := NewAzureDNSConfig(sub, rg, spec.ZoneName, records, opts...)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := zc.Get(ctx, rg, spec.ZoneName, &dns.PrivateZonesClientGetOptions{}); err != nil {
+				return nil, fmt.Errorf("unable to find zone %s: %w", spec.ZoneName, err)
+			}
+			switch {
+			case exporter != nil:
+				return &ExportDNSConfig{AzureDNSConfig: dnscfg, exporter: exporter}, nil
+			case *shadowExtDNS:
+				return &ShadowDNSConfig{AzureDNSConfig: dnscfg, Owner: *extDNSOwner}, nil
+			}
+			if err := dnscfg.SetTXTVersion(ctx, specVersion); err != nil {
+				return nil, err
+			}
+			if *softDelete {
+				return &SoftDeleteDNSConfig{AzureDNSConfig: dnscfg}, nil
+			}
+			return dnscfg, nil
+		}
+	}
+
+	// AggregateRecords and HTTPRoutes carry the finalizer too, -cleanup releases them as well.
+	var aggs *AggregateRecordReconciler
+	if *aggregates {
+		aggs = &AggregateRecordReconciler{Client: mgr.GetClient(), dns: sr.dns, recorder: sr.recorder, SkipDeletes: sr.SkipDeletes}
+	}
+	var routes *HTTPRouteReconciler
+	if *gatewayAPI {
+		// routes aren't routed with -zone, so only hostnames in the -zoneName zones are published.
+		routes = &HTTPRouteReconciler{Client: mgr.GetClient(), dns: sr.dns, recorder: sr.recorder, Zones: sr.Zones, SkipDeletes: sr.SkipDeletes}
+	}
+
+	if *cleanup {
+		if *dryRun {
+			log.Fatal("-cleanup removes finalizers, it can't be used with -dry-run")
+		}
+		ctx, done := context.WithCancel(ctx)
+		c := &Cleanup{Reader: mgr.GetAPIReader(), services: sr, dnsZones: dz, aggregates: aggs, routes: routes, guard: guard, done: done}
+		if err := mgr.Add(c); err != nil {
+			log.Fatalf("Unable to add cleanup: %v", err)
+		}
+		log.Println("Starting manager to clean up...")
+		if err := mgr.Start(ctx); err != nil {
+			log.Fatalf("Cleanup failed: %v", err)
+		}
+		return
 	}
 
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Fatalf("Unable to add health check: %v", err)
+	}
+	resync := make(chan event.GenericEvent)
+	var initialSync *InitialSync
+	var serviceReconciler reconcile.Reconciler = sr
+	if *verifyOnStart || *sortedSync {
+		initialSync = &InitialSync{Reader: mgr.GetClient(), Sorted: *sortedSync, resync: resync, elected: mgr.Elected()}
+		serviceReconciler = initialSync.Track(sr)
+		if err := mgr.Add(initialSync); err != nil {
+			log.Fatalf("Unable to add initial sync: %v", err)
+		}
+	}
+	if *verifyOnStart {
+		if err := mgr.AddReadyzCheck("initial-sync", initialSync.ReadyCheck); err != nil {
+			log.Fatalf("Unable to add initial sync ready check: %v", err)
+		}
+	} else if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		log.Fatalf("Unable to add ready check: %v", err)
+	}
+	for _, zone := range writtenZones {
+		if err := mgr.AddReadyzCheck("azure-"+zone.ZoneName, zone.ReadyCheck); err != nil {
+			log.Fatalf("Unable to add azure ready check for zone %s: %v", zone.ZoneName, err)
+		}
+	}
+
+	servicePredicates := []predicate.Predicate{serviceChangedPredicate()}
+	if sel != nil {
+		servicePredicates = append(servicePredicates, selectorPredicate(sel))
+	}
 	err = ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Service{}).
+		Named("service").
+		// deletionsFirst instead of For so deleting services jump the queue.
+		Watches(&corev1.Service{}, deletionsFirst{Debounce: *updateDebounce}, builder.WithPredicates(servicePredicates...)).
 		//For(&corev1.EndpointSlices{}).
-		Complete(sr)
+		WatchesRawSource(source.Channel(resync, deletionsFirst{})).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: *workers,
+			// failed reconciles start at a second rather than 5ms so a flapping service can't spin, azure errors
+			// are paced by AzureBackoff instead. The bucket caps requeues across all services.
+			RateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+				workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Second, 5*time.Minute),
+				&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+			),
+		}).
+		Complete(serviceReconciler)
 	if err != nil {
 		log.Fatalf("Unable to create service controller: %v", err)
 	}
 
+	if *headless {
+		if *topologyRecs && *legacyEndpts {
+			log.Printf("Warning: -topology-records has no effect with -legacy-endpoints, Endpoints carry no topology zones")
+		}
+		hr := &HeadlessReconciler{
+			Client:          mgr.GetClient(),
+			APIReader:       mgr.GetAPIReader(),
+			dns:             sr.dns,
+			shard:           shard,
+			state:           sr.state,
+			recorder:        sr.recorder,
+			LegacyEndpoints: *legacyEndpts,
+			SkipDeletes:     sr.SkipDeletes,
+			RecordSuffix:    sr.RecordSuffix,
+			zones:           sr.zones,
+			TopologyRecords: *topologyRecs,
+			optOut:          sr.optOut,
+			recordTTL:       sr.recordTTL,
+			names:           sr.names,
+
+			DeleteProtectedNamespaces: sr.DeleteProtectedNamespaces,
+		}
+		headlessPredicates := []predicate.Predicate{headlessPredicate()}
+		if sel != nil {
+			headlessPredicates = append(headlessPredicates, selectorPredicate(sel))
+		}
+		b := ctrl.NewControllerManagedBy(mgr).
+			Named("headless").
+			Watches(&corev1.Service{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(headlessPredicates...))
+		if *legacyEndpts {
+			// Endpoints share their service's name.
+			b = b.Watches(&corev1.Endpoints{}, &handler.EnqueueRequestForObject{})
+		} else {
+			b = b.Watches(&discoveryv1.EndpointSlice{}, endpointSliceHandler(*endptDebounce))
+		}
+		if err := b.Complete(hr); err != nil {
+			log.Fatalf("Unable to create headless service controller: %v", err)
+		}
+	}
+
+	if dz != nil {
+		dz.resync = resync
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("dnszone").
+			Watches(&DNSZone{}, handler.EnqueueRequestsFromMapFunc(dz.dnsZoneRequests)).
+			Complete(dz)
+		if err != nil {
+			log.Fatalf("Unable to create DNSZone controller: %v", err)
+		}
+	}
+
+	if aggs != nil {
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("aggregaterecord").
+			For(&AggregateRecord{}).
+			Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(aggs.aggregatesForService)).
+			Complete(aggs)
+		if err != nil {
+			log.Fatalf("Unable to create AggregateRecord controller: %v", err)
+		}
+	}
+
+	if routes != nil {
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("httproute").
+			For(newHTTPRoute()).
+			Watches(newGateway(), handler.EnqueueRequestsFromMapFunc(routes.routesForGateway)).
+			Complete(routes)
+		if err != nil {
+			log.Fatalf("Unable to create HTTPRoute controller: %v", err)
+		}
+	}
+
+	if credReconciler != nil {
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("credential-secret").
+			For(&corev1.Secret{}).
+			Complete(credReconciler)
+		if err != nil {
+			log.Fatalf("Unable to create credential secret controller: %v", err)
+		}
+	}
+
+	if *runtimeConfig != "" {
+		defaults := RuntimeDefaults{Paused: *paused, FilterExpr: *filterExpr}
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("runtime-configmap").
+			For(&corev1.ConfigMap{}).
+			Complete(&RuntimeConfigReconciler{
+				Reader:    mgr.GetClient(),
+				ConfigMap: runtimeRef,
+				Defaults:  defaults,
+				pause:     pausable,
+				ttl:       ttlOverride,
+				filter:    &sr.filter,
+				resync:    resync,
+
+				ttlApplied:    defaults.TTL,
+				filterApplied: defaults.FilterExpr,
+			})
+		if err != nil {
+			log.Fatalf("Unable to create runtime configmap controller: %v", err)
+		}
+	}
+
 	log.Println("Starting manager...")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		log.Fatalf("Unable to start manager: %v", err)
 	}
 }
 
 var specVersion string = "1.1.0"
 
-// move to dnsclient?
-func MustSetTxTVerion(ctx context.Context, cfg *AzureDNSConfig) {
-	rs := dns.RecordSet{
-		Properties: &dns.RecordSetProperties{
-			TxtRecords: []*dns.TxtRecord{
-				{
-					Value: []*string{&specVersion},
-				},
-			},
-		},
+// verbose enables debugf, set by -v.
+var verbose bool
+
+// debugf logs like log.Printf but only with -v.
+func debugf(format string, args ...any) {
+	if verbose {
+		log.Printf(format, args...)
 	}
+}
 
-	_, err := cfg.DNSClient.CreateOrUpdate(ctx, cfg.ResourceGroup, cfg.ZoneName, armprivatedns.RecordTypeTXT, "dns-version", rs, &armprivatedns.RecordSetsClientCreateOrUpdateOptions{})
-	if err != nil {
+// What the AKS CoreDNS config at the top of this file serves, used by -coredns-compat.
+const (
+	corednsZone = "cluster.local"
+	corednsTTL  = 30
+)
+
+// corednsDefaults are the flag values -coredns-compat defaults to.
+var corednsDefaults = map[string]string{
+	"ttl":           strconv.Itoa(corednsTTL),
+	"zoneName":      corednsZone,
+	"record-suffix": "svc." + corednsZone,
+}
+
+// applyCorednsCompat sets every flag of corednsDefaults that wasn't given on the command line.
+func applyCorednsCompat(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, v := range corednsDefaults {
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// MustSetTXTVersion is SetTXTVersion that exits once its retries are exhausted.
+func MustSetTXTVersion(ctx context.Context, cfg *AzureDNSConfig) {
+	if err := cfg.SetTXTVersion(ctx, specVersion); err != nil {
 		log.Fatalf("Failed to update TXT record: %v", err)
 	}
 }
 
+// newAzureClients creates the record sets and zones clients for zones of type zt in subscriptionID.
+func newAzureClients(zt, subscriptionID string, cred azcore.TokenCredential, opts *arm.ClientOptions) (instrumentedRecordSets, zonesAPI, error) {
+	if zt == zoneTypePublic {
+		recordSetsClient, err := armdns.NewRecordSetsClient(subscriptionID, cred, opts)
+		if err != nil {
+			return instrumentedRecordSets{}, nil, err
+		}
+		zonesClient, err := armdns.NewZonesClient(subscriptionID, cred, opts)
+		if err != nil {
+			return instrumentedRecordSets{}, nil, err
+		}
+		return instrumentedRecordSets{publicRecordSets{recordSetsClient}}, publicZones{zonesClient}, nil
+	}
+	recordSetsClient, err := dns.NewRecordSetsClient(subscriptionID, cred, opts)
+	if err != nil {
+		return instrumentedRecordSets{}, nil, err
+	}
+	zonesClient, err := dns.NewPrivateZonesClient(subscriptionID, cred, opts)
+	if err != nil {
+		return instrumentedRecordSets{}, nil, err
+	}
+	return instrumentedRecordSets{recordSetsClient}, zonesClient, nil
+}
+
+// enableAzureSDKLog routes the Azure SDK's own log into ours. The SDK redacts the Authorization header
+// and query parameters itself. Authentication events are left out since they describe credentials.
+func enableAzureSDKLog() {
+	azlog.SetEvents(azlog.EventRequest, azlog.EventResponse, azlog.EventResponseError, azlog.EventRetryPolicy)
+	azlog.SetListener(func(event azlog.Event, msg string) {
+		log.Printf("azure sdk %s: %s", event, msg)
+	})
+}
+
+// azureActor describes the identity azure calls are made as, for the audit log. Never includes secrets.
+func azureActor(credSecret, clientID string) string {
+	if credSecret != "" {
+		return "secret:" + credSecret
+	}
+	if id := cmp.Or(clientID, os.Getenv("AZURE_CLIENT_ID")); id != "" {
+		return "client:" + id
+	}
+	return "default-credential"
+}
+
+// newAzureCredential picks the credential to authenticate with and describes it for the log. With a
+// clientID it is that workload identity when a federated token is mounted, else that user-assigned
+// managed identity. Without one it is DefaultAzureCredential.
+func newAzureCredential(clientID, tenantID string) (azcore.TokenCredential, string, error) {
+	if clientID == "" {
+		if tenantID != "" {
+			return nil, "", errors.New("-tenant-id needs -client-id")
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		return cred, "DefaultAzureCredential", err
+	}
+	// the workload identity webhook mounts the token and sets this for pods using a federated identity.
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+		cred, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{ClientID: clientID, TenantID: tenantID})
+		return cred, fmt.Sprintf("workload identity %s", clientID), err
+	}
+	if tenantID != "" {
+		log.Printf("Ignoring -tenant-id, managed identities are always in the tenant of their host")
+	}
+	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ClientID(clientID)})
+	return cred, fmt.Sprintf("user-assigned managed identity %s", clientID), err
+}
+
+// singleObjectCache restricts a cached type to the one object at ref.
+func singleObjectCache(ref types.NamespacedName) cache.ByObject {
+	return cache.ByObject{
+		Namespaces: map[string]cache.Config{ref.Namespace: {}},
+		Field:      fields.OneTermEqualSelector("metadata.name", ref.Name),
+	}
+}
+
+// ptrDomain is the zone PTR records point into, the first of zones, or empty without a reverse zone.
+func ptrDomain(reverseZone, zones string) string {
+	if reverseZone == "" {
+		return ""
+	}
+	first, _, _ := strings.Cut(zones, ",")
+	return strings.TrimSpace(first)
+}
+
+// kubeconfigFlagName is the flag naming the kubeconfig to use, see kubeConfig.
+const kubeconfigFlagName = "kubeconfig"
+
+// kubeconfigFlag returns -kubeconfig on fs. controller-runtime already defines it on the command line and
+// defining it again panics, so it is only defined when missing. Either way the usage is replaced with ours.
+func kubeconfigFlag(fs *flag.FlagSet) *flag.Flag {
+	if fs.Lookup(kubeconfigFlagName) == nil {
+		fs.String(kubeconfigFlagName, "", "")
+	}
+	f := fs.Lookup(kubeconfigFlagName)
+	f.Usage = "Kubeconfig to use, wins over the in cluster config. When not running in a cluster defaults to the files in $KUBECONFIG, separated like $PATH, then ~/.kube/config"
+	return f
+}
+
+// kubeConfig loads path when it is set, then the in cluster config when there is one, then the kubeconfigs
+// listed in $KUBECONFIG, merged like kubectl does, or ~/.kube/config, so the controller can run locally
+// against e.g. a kind cluster.
+func kubeConfig(path string) (*rest.Config, error) {
+	if path != "" {
+		cfg, err := clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			return nil, fmt.Errorf("loading -kubeconfig %s failed: %w", path, err)
+		}
+		log.Printf("Using kubeconfig %s", path)
+		return cfg, nil
+	}
+	cfg, inClusterErr := rest.InClusterConfig()
+	if inClusterErr == nil {
+		return cfg, nil
+	}
+	var paths []string
+	for _, p := range filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)) {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{clientcmd.RecommendedHomeFile}
+	}
+	rules := &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("not in a cluster (%v) and loading kubeconfig %s failed: %w", inClusterErr, strings.Join(paths, ", "), err)
+	}
+	log.Printf("Not running in a cluster, using kubeconfig %s", strings.Join(paths, ", "))
+	return cfg, nil
+}
+
 // schemeSetup sets up the Scheme for corev1 types and any additional CRDs
 func schemeSetup() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(discoveryv1.AddToScheme(scheme))
+	utilruntime.Must(addAggregateRecordToScheme(scheme))
+	utilruntime.Must(addDNSZoneToScheme(scheme))
 	return scheme
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/azcore/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+func TestCorednsCompatDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ttl := fs.Int64("ttl", defaultTTL, "")
+	zone := fs.String("zoneName", "example.internal", "")
+	suffix := fs.String("record-suffix", "svc", "")
+	if err := fs.Parse([]string{"-ttl=60"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyCorednsCompat(fs); err != nil {
+		t.Fatal(err)
+	}
+	// an explicit flag keeps its value, the rest mirror CoreDNS.
+	if *ttl != 60 || *zone != "cluster.local" || *suffix != "svc.cluster.local" {
+		t.Errorf("ttl %d, zoneName %s, record-suffix %s", *ttl, *zone, *suffix)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	ttl = fs.Int64("ttl", defaultTTL, "")
+	fs.String("zoneName", "", "")
+	fs.String("record-suffix", "", "")
+	if err := applyCorednsCompat(fs); err != nil {
+		t.Fatal(err)
+	}
+	if *ttl != corednsTTL {
+		t.Errorf("ttl %d, want %d", *ttl, corednsTTL)
+	}
+}
+
+// TestMainFlags defines main's flags on the real command line, next to whatever the libraries it imports
+// define there, by running main with -h in a child process. A flag defined twice panics there.
+func TestMainFlags(t *testing.T) {
+	if os.Getenv("AZURE_K8S_DNS_MAIN") == "1" {
+		os.Args = []string{"azure-k8s-dns", "-h"}
+		main()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainFlags$")
+	cmd.Env = append(os.Environ(), "AZURE_K8S_DNS_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("main -h: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "-"+kubeconfigFlagName) {
+		t.Errorf("-%s missing from the usage:\n%s", kubeconfigFlagName, out)
+	}
+}
+
+func TestKubeConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, server string) string {
+		path := filepath.Join(dir, name)
+		kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters: [{name: c, cluster: {server: %s}}]
+users: [{name: u, user: {}}]
+contexts: [{name: ctx, context: {cluster: c, user: u}}]
+current-context: ctx
+`, server)
+		if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	listed := write("listed", "https://listed.example:6443")
+	explicit := write("explicit", "https://explicit.example:6443")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	// the first file listed doesn't exist, the next one is used.
+	t.Setenv("KUBECONFIG", strings.Join([]string{filepath.Join(dir, "missing"), listed}, string(os.PathListSeparator)))
+
+	cfg, err := kubeConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://listed.example:6443" {
+		t.Errorf("host from $KUBECONFIG = %s", cfg.Host)
+	}
+	cfg, err = kubeConfig(explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://explicit.example:6443" {
+		t.Errorf("host from -kubeconfig = %s", cfg.Host)
+	}
+
+	t.Setenv("KUBECONFIG", filepath.Join(dir, "missing"))
+	if _, err := kubeConfig(""); err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "missing")) {
+		t.Errorf("error %v doesn't name the kubeconfig tried", err)
+	}
+}
+
+func TestAzureSDKLogRoutedToControllerLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	enableAzureSDKLog()
+	t.Cleanup(func() { azlog.SetListener(nil) })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	pl := runtime.NewPipeline("test", "v1", runtime.PipelineOptions{}, &policy.ClientOptions{Retry: policy.RetryOptions{MaxRetries: -1}})
+	req, err := runtime.NewRequest(context.Background(), http.MethodGet, srv.URL+"/zones/example.internal?sig=secret-sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Raw().Header.Set("Authorization", "Bearer secret-token")
+	if _, err := pl.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"azure sdk Request: ==> OUTGOING REQUEST", "azure sdk Response: ==> REQUEST/RESPONSE", "/zones/example.internal"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log = %q, want it to contain %q", out.String(), want)
+		}
+	}
+	for _, secret := range []string{"secret-token", "secret-sig"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("log leaked %s: %q", secret, out.String())
+		}
+	}
+}
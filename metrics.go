@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Zone metrics are labeled by zone name, which is bounded by the -zone flag.
+var (
+	zoneWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_dns_zone_writes_total",
+		Help: "Azure DNS writes per zone, by operation and result.",
+	}, []string{"zone", "operation", "result"})
+
+	zoneWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "azure_dns_zone_write_duration_seconds",
+		Help:    "Latency of azure DNS writes per zone, by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"zone", "operation"})
+)
+
+// finalizerConflicts counts finalizer updates retried after a conflict with another writer.
+var finalizerConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "azure_dns_finalizer_conflict_retries_total",
+	Help: "Finalizer updates of services, AggregateRecords and HTTPRoutes retried after an optimistic concurrency conflict.",
+})
+
+// namesOverLimit counts record names not published because a service was over -max-names-per-service.
+var namesOverLimit = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "azure_dns_names_over_limit_total",
+	Help: "Record names not published because their service exceeded -max-names-per-service.",
+})
+
+// goneServices counts reconciles for services that no longer exist, a benign no-op after deletes.
+var goneServices = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "azure_dns_reconcile_gone_total",
+	Help: "Reconciles skipped because the service no longer exists.",
+})
+
+// ownershipConflicts counts record sets left alone because another controller instance owns them.
+var ownershipConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_dns_ownership_conflicts_total",
+	Help: "Record sets not written or deleted because another -controller-id owns them, by zone.",
+}, []string{"zone"})
+
+// recordSetSize is how many values each written record set holds, large ones creep towards maxRecordsPerSet.
+var recordSetSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "azure_dns_record_set_size",
+	Help:    "Values (IPs for A and AAAA) in each record set written to azure, by record type.",
+	Buckets: []float64{1, 2, 3, 5, 10, 15, maxRecordsPerSet},
+}, []string{"type"})
+
+// unchangedWrites counts record set writes skipped because azure already held the same record set.
+var unchangedWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_dns_unchanged_writes_skipped_total",
+	Help: "Record set writes skipped because azure already had the same values, TTL and metadata, by zone.",
+}, []string{"zone"})
+
+// reconcilePanics counts service reconciles that panicked and were turned into a requeue.
+var reconcilePanics = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "azure_dns_reconcile_panics_total",
+	Help: "Service reconciles that panicked, usually on a service shaped in a way the controller doesn't expect.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(zoneWrites, zoneWriteDuration, finalizerConflicts, namesOverLimit, goneServices, ownershipConflicts, recordSetSize, reconcilePanics, unchangedWrites,
+		azureCalls, azureCallDuration, reconcileResults, managedRecordSets)
+}
+
+// observeZoneWrite records the outcome of one operation against one zone.
+func observeZoneWrite(zone, operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	zoneWrites.WithLabelValues(zone, operation, result).Inc()
+	zoneWriteDuration.WithLabelValues(zone, operation).Observe(time.Since(start).Seconds())
+}
+
+// Azure record set API calls, labeled by zone like the zone metrics and by record type which is a small fixed set.
+var (
+	azureCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_dns_api_calls_total",
+		Help: "Azure record set CreateOrUpdate and Delete calls, by zone, operation, record type and result.",
+	}, []string{"zone", "operation", "type", "result"})
+
+	azureCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "azure_dns_api_call_duration_seconds",
+		Help:    "Latency of azure record set CreateOrUpdate and Delete calls, by zone, operation and record type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"zone", "operation", "type"})
+)
+
+// reconcileResults counts service reconciles by ReconcileEvent result.
+var reconcileResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_dns_reconciles_total",
+	Help: "Service reconciles by result: updated, deleted, skipped or error.",
+}, []string{"result"})
+
+// managedRecordSets is how many record names the controller currently publishes.
+var managedRecordSets = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "azure_dns_managed_record_names",
+	Help: "Record names the controller currently publishes.",
+})
+
+// recordSetsAPI is the part of the azure record sets client the controller uses.
+type recordSetsAPI interface {
+	Get(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientGetOptions) (dns.RecordSetsClientGetResponse, error)
+	CreateOrUpdate(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, parameters dns.RecordSet, options *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error)
+	Delete(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error)
+	NewListPager(resourceGroupName, privateZoneName string, options *dns.RecordSetsClientListOptions) *runtime.Pager[dns.RecordSetsClientListResponse]
+}
+
+// instrumentedRecordSets times and counts the mutating calls of a record sets client, by the zone each is made to.
+type instrumentedRecordSets struct {
+	recordSetsAPI
+}
+
+func (c instrumentedRecordSets) CreateOrUpdate(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, parameters dns.RecordSet, options *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error) {
+	start := time.Now()
+	resp, err := c.recordSetsAPI.CreateOrUpdate(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, parameters, options)
+	observeAzureCall(privateZoneName, "create-or-update", recordType, start, err)
+	return resp, err
+}
+
+func (c instrumentedRecordSets) Delete(ctx context.Context, resourceGroupName, privateZoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error) {
+	start := time.Now()
+	resp, err := c.recordSetsAPI.Delete(ctx, resourceGroupName, privateZoneName, recordType, relativeRecordSetName, options)
+	observeAzureCall(privateZoneName, "delete", recordType, start, err)
+	return resp, err
+}
+
+func observeAzureCall(zone, operation string, rt dns.RecordType, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	azureCalls.WithLabelValues(zone, operation, string(rt), result).Inc()
+	azureWrites.Add(1)
+	azureCallDuration.WithLabelValues(zone, operation, string(rt)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestAzureCallsLabeledByZone(t *testing.T) {
+	c := instrumentedRecordSets{newFakeRecordSets()}
+	before := testutil.ToFloat64(azureCalls.WithLabelValues("metrics.example", "create-or-update", "A", "success"))
+	rs := dns.RecordSet{Properties: &dns.RecordSetProperties{ARecords: []*dns.ARecord{{IPv4Address: to.StringPtr("10.0.0.1")}}}}
+	if _, err := c.CreateOrUpdate(context.Background(), "rg", "metrics.example", dns.RecordTypeA, "web", rs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(azureCalls.WithLabelValues("metrics.example", "create-or-update", "A", "success")) - before; got != 1 {
+		t.Errorf("zone metrics.example counted %v calls, want 1", got)
+	}
+}
+
+func TestFanoutWriteLabelsEachZone(t *testing.T) {
+	zones := map[string]pausableTarget{}
+	for _, name := range []string{"fanout-a.example", "fanout-b.example"} {
+		rs := newFakeRecordSets()
+		zone, err := NewAzureDNSConfig("sub", "rg", name, instrumentedRecordSets{rs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		zones[name] = zone
+	}
+	fanout := NewZoneFanout(zones, 2)
+	if _, err := fanout.UpsertDNSRecords(withZone(context.Background(), ""), "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	for name := range zones {
+		if got := testutil.ToFloat64(zoneWrites.WithLabelValues(name, "upsert", "success")); got != 1 {
+			t.Errorf("zone %s counted %v upserts, want 1", name, got)
+		}
+		if got := testutil.ToFloat64(azureCalls.WithLabelValues(name, "create-or-update", "A", "success")); got != 1 {
+			t.Errorf("zone %s counted %v azure calls, want 1", name, got)
+		}
+	}
+}
+
+func TestSummaryCountsAzureWrites(t *testing.T) {
+	r, _ := newTestAzureDNSConfig(t, func(r *AzureDNSConfig) { r.DNSClient = instrumentedRecordSets{r.DNSClient} })
+	azureWrites.Store(0)
+	// the second upsert is unchanged so never reaches azure.
+	for range 2 {
+		if err := r.UpsertTXTRecord(context.Background(), "services-index", []string{"web.default.svc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := azureWrites.Load(); got != 1 {
+		t.Errorf("counted %d azure writes, want 1", got)
+	}
+}
+
+// aRecordSetSizes reads the A series of recordSetSize: its count, sum and cumulative count by bucket.
+func aRecordSetSizes(t *testing.T) (count uint64, sum float64, buckets map[float64]uint64) {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets = map[float64]uint64{}
+	for _, f := range families {
+		if f.GetName() != "azure_dns_record_set_size" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if len(m.GetLabel()) != 1 || m.GetLabel()[0].GetValue() != "A" {
+				continue
+			}
+			h := m.GetHistogram()
+			for _, b := range h.GetBucket() {
+				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+			}
+			return h.GetSampleCount(), h.GetSampleSum(), buckets
+		}
+	}
+	return 0, 0, buckets
+}
+
+func TestRecordSetSizeObserved(t *testing.T) {
+	r, _ := newTestAzureDNSConfig(t)
+	count, sum, buckets := aRecordSetSizes(t)
+	if _, err := r.UpsertDNSRecords(context.Background(), "web.default.svc", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	gotCount, gotSum, gotBuckets := aRecordSetSizes(t)
+	if gotCount-count != 1 || gotSum-sum != 3 {
+		t.Errorf("observed %d record sets summing to %v, want one of 3", gotCount-count, gotSum-sum)
+	}
+	if gotBuckets[2]-buckets[2] != 0 || gotBuckets[3]-buckets[3] != 1 {
+		t.Errorf("3 values landed in buckets %v, was %v", gotBuckets, buckets)
+	}
+}
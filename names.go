@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// parseRecordSuffix validates -record-suffix, the labels following <service>.<namespace> in record names.
+func parseRecordSuffix(v string) (string, error) {
+	suffix := strings.ToLower(strings.Trim(strings.TrimSpace(v), "."))
+	if suffix == "" {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(suffix); len(errs) > 0 {
+		return "", fmt.Errorf("invalid record suffix %q: %s", v, strings.Join(errs, ", "))
+	}
+	return suffix, nil
+}
+
+// Collision strategies for -name-collision.
+const (
+	collisionReject = "reject"
+	collisionHash   = "hash"
+)
+
+// errNameCollision means a record name is already claimed by another service.
+var errNameCollision = errors.New("record name already claimed by another service")
+
+// NameRegistry tracks which service owns each record name so two services never write the same records.
+// Claims are held in memory and rebuilt from the services' published name annotations by Seed, so a
+// contested name stays with the service that had it across restarts.
+type NameRegistry struct {
+	strategy string
+
+	mu     sync.Mutex
+	owners map[string]types.NamespacedName // record name -> service
+	names  map[types.NamespacedName]string // service -> record name
+}
+
+func NewNameRegistry(strategy string) (*NameRegistry, error) {
+	if strategy != collisionReject && strategy != collisionHash {
+		return nil, fmt.Errorf("unknown collision strategy %q, must be %s or %s", strategy, collisionReject, collisionHash)
+	}
+	return &NameRegistry{
+		strategy: strategy,
+		owners:   map[string]types.NamespacedName{},
+		names:    map[types.NamespacedName]string{},
+	}, nil
+}
+
+// Claim returns the record name svc should use for the desired name. If another service already owns it
+// the reject strategy returns errNameCollision and the hash strategy suffixes the first label with a hash of
+// svc's namespace, e.g. web.team-a.svc -> web-1a2b3c4d.team-a.svc.
+func (n *NameRegistry) Claim(desired string, svc types.NamespacedName) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// keep a hashed name once given out so the records don't move if the original owner goes away.
+	if prev, ok := n.names[svc]; ok && prev == hashSuffixed(desired, svc.Namespace) {
+		return prev, nil
+	}
+
+	name := desired
+	if owner, ok := n.owners[name]; ok && owner != svc {
+		if n.strategy == collisionReject {
+			return "", fmt.Errorf("%w: %s is used by %s", errNameCollision, name, owner)
+		}
+		name = hashSuffixed(desired, svc.Namespace)
+		if owner, ok := n.owners[name]; ok && owner != svc {
+			return "", fmt.Errorf("%w: %s and its hashed form %s are used by %s", errNameCollision, desired, name, owner)
+		}
+	}
+
+	if prev, ok := n.names[svc]; ok && prev != name {
+		delete(n.owners, prev)
+	}
+	n.owners[name] = svc
+	n.names[svc] = name
+	return name, nil
+}
+
+// Seed claims the names services are already published under before anything is reconciled. A name
+// claimed by more than one service, e.g. published before -name-collision was set, goes to the one created first.
+// suffix is -record-suffix, it finds the service wide name among the names of headless services.
+//
+// reader should be an API reader, Seed runs before the cache is started.
+func (n *NameRegistry) Seed(ctx context.Context, reader client.Reader, suffix string) error {
+	var list corev1.ServiceList
+	if err := reader.List(ctx, &list); err != nil {
+		return err
+	}
+	slices.SortFunc(list.Items, func(a, b corev1.Service) int {
+		return cmp.Or(a.CreationTimestamp.Compare(b.CreationTimestamp.Time), cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range list.Items {
+		svc := &list.Items[i]
+		name := seededName(svc, suffix)
+		if name == "" {
+			continue
+		}
+		key := client.ObjectKeyFromObject(svc)
+		if owner, ok := n.owners[name]; ok {
+			log.Printf("Warning: %s and %s are both published as %s, %s keeps it", owner, key, name, owner)
+			continue
+		}
+		n.owners[name] = key
+		n.names[key] = name
+	}
+	return nil
+}
+
+// seededName is the name svc is published under, empty if it hasn't been published.
+func seededName(svc *corev1.Service, suffix string) string {
+	// the current name is appended last, earlier ones are only there until their records are removed.
+	if published := publishedNames(svc); len(published) > 0 {
+		return published[len(published)-1]
+	}
+	desired, err := serviceRecordName(svc, suffix)
+	if err != nil {
+		return ""
+	}
+	hostnames := publishedHostnames(svc)
+	for _, name := range []string{desired, hashSuffixed(desired, svc.Namespace)} {
+		if slices.Contains(hostnames, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// release drops whatever name svc holds. Safe to call on a nil registry.
+func (n *NameRegistry) release(svc types.NamespacedName) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if name, ok := n.names[svc]; ok {
+		delete(n.owners, name)
+		delete(n.names, svc)
+	}
+}
+
+// hashSuffixed appends a short deterministic hash of namespace to the first label of name.
+func hashSuffixed(name, namespace string) string {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	first, rest, _ := strings.Cut(name, ".")
+	suffixed := fmt.Sprintf("%s-%08x", first, h.Sum32())
+	if rest == "" {
+		return suffixed
+	}
+	return suffixed + "." + rest
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// collidingService is a service in namespace asking for the name api.example.
+func collidingService(namespace string, created time.Time) *corev1.Service {
+	svc := testService("api", "10.0.0.1")
+	svc.Namespace = namespace
+	svc.CreationTimestamp = metav1.NewTime(created)
+	svc.Annotations = map[string]string{hostnameAnnotation: "api.example"}
+	return svc
+}
+
+func TestHashStrategyKeepsCollidingNamesAcrossRestarts(t *testing.T) {
+	first := collidingService("team-a", time.Now().Add(-time.Hour))
+	second := collidingService("team-b", time.Now())
+	r, dns := newTestReconciler(t, first, second)
+	r.names, _ = NewNameRegistry(collisionHash)
+
+	reconcileService(t, r, first)
+	reconcileService(t, r, second)
+	hashed := hashSuffixed("api.example", "team-b")
+	if len(dns.records["api.example"]) == 0 || len(dns.records[hashed]) == 0 || hashed == "api.example" {
+		t.Fatalf("records = %v, want api.example and %s", dns.records, hashed)
+	}
+
+	// a restart seeds the claims from the cluster, so reconciling in the other order moves nothing.
+	r.names, _ = NewNameRegistry(collisionHash)
+	if err := r.names.Seed(context.Background(), r.Client, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []*corev1.Service{second, first} {
+		var current corev1.Service
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &current); err != nil {
+			t.Fatal(err)
+		}
+		want := "api.example"
+		if svc == second {
+			want = hashed
+		}
+		if got, err := r.recordName(&current); got != want || err != nil {
+			t.Errorf("%s/%s after restart: %q, %v, want %q", svc.Namespace, svc.Name, got, err, want)
+		}
+	}
+}
+
+func TestSeedGivesContestedNamesToOldestService(t *testing.T) {
+	older := collidingService("team-b", time.Now().Add(-time.Hour))
+	newer := collidingService("team-a", time.Now())
+	for _, svc := range []*corev1.Service{older, newer} {
+		setPublishedNames(svc, []string{"api.example"})
+	}
+	r, _ := newTestReconciler(t, newer, older)
+	names, _ := NewNameRegistry(collisionReject)
+	if err := names.Seed(context.Background(), r.Client, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := names.Claim("api.example", client.ObjectKeyFromObject(older)); err != nil {
+		t.Errorf("older service lost its name: %v", err)
+	}
+	if _, err := names.Claim("api.example", client.ObjectKeyFromObject(newer)); err == nil {
+		t.Error("newer service got the name too")
+	}
+}
+
+func TestHeadlessClaimsNames(t *testing.T) {
+	svc := testService("api", corev1.ClusterIPNone)
+	svc.Annotations = map[string]string{hostnameAnnotation: "api.example"}
+	r, dns := newTestHeadlessReconciler(t, svc, testEndpointSlice("api", "api-a", zonedEndpoint("", "10.0.1.1")))
+	r.names, _ = NewNameRegistry(collisionHash)
+	other := collidingService("team-b", time.Now())
+	if _, err := r.names.Claim("api.example", client.ObjectKeyFromObject(other)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(svc)}); err != nil {
+		t.Fatal(err)
+	}
+	if hashed := hashSuffixed("api.example", "default"); len(dns.records[hashed]) == 0 || len(dns.records["api.example"]) > 0 {
+		t.Errorf("records = %v, want only %s", dns.records, hashed)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Reconcile results reported to the webhook.
+const (
+	resultUpdated = "updated"
+	resultDeleted = "deleted"
+	resultSkipped = "skipped"
+	resultError   = "error"
+)
+
+// ReconcileEvent is the JSON payload POSTed to -notify-webhook after each reconcile.
+type ReconcileEvent struct {
+	Service string              `json:"service"`
+	Records map[string][]string `json:"records,omitempty"` // record name -> values
+	Result  string              `json:"result"`
+	Error   string              `json:"error,omitempty"`
+	Time    time.Time           `json:"time"`
+}
+
+// Notifier POSTs reconcile events to a webhook from a single background worker.
+// Events are dropped rather than blocking reconciles when the webhook falls behind.
+type Notifier struct {
+	url     string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	events  chan ReconcileEvent
+}
+
+func NewNotifier(url string, timeout time.Duration, retries int) *Notifier {
+	return &Notifier{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		backoff: time.Second,
+		events:  make(chan ReconcileEvent, 100),
+	}
+}
+
+// Notify queues ev for delivery. It never blocks.
+func (n *Notifier) Notify(ev ReconcileEvent) {
+	if n == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	select {
+	case n.events <- ev:
+	default:
+		log.Printf("Dropping webhook notification for %s, queue is full", ev.Service)
+	}
+}
+
+// Start implements manager.Runnable.
+func (n *Notifier) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-n.events:
+			if err := n.send(ctx, ev); err != nil {
+				log.Printf("Failed to notify webhook for %s: %v", ev.Service, err)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica reports its own reconciles.
+func (n *Notifier) NeedLeaderElection() bool {
+	return false
+}
+
+func (n *Notifier) send(ctx context.Context, ev ReconcileEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, body)
+		if err == nil || attempt >= n.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(n.backoff << attempt):
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
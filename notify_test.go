@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNotifierPostsReconcileResult(t *testing.T) {
+	got := make(chan ReconcileEvent, 1)
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the first delivery fails and is retried.
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev ReconcileEvent
+		if err := json.NewDecoder(req.Body).Decode(&ev); err != nil {
+			t.Errorf("payload: %v", err)
+		}
+		got <- ev
+	}))
+	defer srv.Close()
+
+	n := NewNotifier(srv.URL, time.Second, 2)
+	n.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Start(ctx)
+
+	svc := testService("web", "10.0.0.1")
+	r, _ := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.notifier = n
+	reconcileService(t, r, svc)
+
+	select {
+	case ev := <-got:
+		if ev.Service != "default/web" || ev.Result != resultUpdated || ev.Error != "" {
+			t.Errorf("event = %+v, want an update of default/web", ev)
+		}
+		if !slices.Equal(ev.Records["web.default.svc"], []string{"10.0.0.1"}) {
+			t.Errorf("event records = %v", ev.Records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook never received the event")
+	}
+}
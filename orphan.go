@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var orphansDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_dns_orphaned_names_deleted_total",
+	Help: "Record names deleted by the orphan collector because the service they were published for is gone, by zone.",
+}, []string{"zone"})
+
+func init() {
+	metrics.Registry.MustRegister(orphansDeleted)
+}
+
+// OrphanCollector periodically deletes the records of services that no longer exist, e.g. force deleted
+// while the controller was down so their finalizer never ran. Only record sets carrying this controller's
+// owner and a service source are considered, see withRecordSource. It only runs on the leader.
+type OrphanCollector struct {
+	Reader   client.Reader // uncached, so a service created since the cache synced isn't mistaken for gone
+	zones    []*AzureDNSConfig
+	dns      dnsClient
+	Interval time.Duration
+	Paused   func() bool // optional, collection is skipped while it returns true
+}
+
+// Start implements manager.Runnable.
+func (o *OrphanCollector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if o.Paused != nil && o.Paused() {
+			continue
+		}
+		for _, zone := range o.zones {
+			if err := o.Collect(ctx, zone); err != nil {
+				log.Printf("Failed to collect orphaned records in zone %s: %v", zone.ZoneName, err)
+			}
+		}
+	}
+}
+
+// Collect deletes the records in zone whose source service is gone.
+func (o *OrphanCollector) Collect(ctx context.Context, zone *AzureDNSConfig) error {
+	ctx = withZone(ctx, zone.ZoneName)
+	// every record type at a name is removed together, so collect the types first.
+	orphans := map[string][]dns.RecordType{}
+	exists := map[types.NamespacedName]bool{}
+	pager := zone.DNSClient.NewListPager(zone.ResourceGroup, zone.ZoneName, &dns.RecordSetsClientListOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, rs := range page.Value {
+			if rs.Name == nil || rs.Type == nil || rs.Properties == nil {
+				continue
+			}
+			md := rs.Properties.Metadata
+			if to.String(md[ownerMetadataKey]) != zone.OwnerID || md[tombstoneMetadataKey] != nil {
+				continue
+			}
+			svc, ok := serviceSource(to.String(md[sourceMetadataKey]))
+			if !ok {
+				continue
+			}
+			found, seen := exists[svc]
+			if !seen {
+				found, err = o.serviceExists(ctx, svc)
+				if err != nil {
+					return err
+				}
+				exists[svc] = found
+			}
+			if !found {
+				orphans[*rs.Name] = append(orphans[*rs.Name], recordTypeFromResourceType(*rs.Type))
+			}
+		}
+	}
+
+	for name, rts := range orphans {
+		log.Printf("Deleting orphaned %v records for %s in zone %s, the service they were published for is gone", rts, name, zone.ZoneName)
+		if slices.Contains(rts, dns.RecordTypeA) || slices.Contains(rts, dns.RecordTypeAAAA) {
+			if err := o.dns.DeleteDNSRecords(ctx, name); err != nil {
+				return fmt.Errorf("error deleting orphaned records for %s: %w", name, err)
+			}
+		}
+		if slices.Contains(rts, dns.RecordTypeCNAME) {
+			if err := o.dns.UpsertCNAMERecord(ctx, name, "", 0); err != nil {
+				return fmt.Errorf("error deleting orphaned CNAME for %s: %w", name, err)
+			}
+		}
+		if slices.Contains(rts, dns.RecordTypeMX) {
+			if err := o.dns.UpsertExtraRecords(ctx, name, nil); err != nil {
+				return fmt.Errorf("error deleting orphaned extra records for %s: %w", name, err)
+			}
+		}
+		orphansDeleted.WithLabelValues(zone.ZoneName).Inc()
+	}
+	return nil
+}
+
+func (o *OrphanCollector) serviceExists(ctx context.Context, key types.NamespacedName) (bool, error) {
+	var svc corev1.Service
+	err := o.Reader.Get(ctx, key, &svc)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// serviceSource parses a source written by withRecordSource for a service, e.g. service/default/web.
+func serviceSource(source string) (types.NamespacedName, bool) {
+	rest, ok := strings.CutPrefix(source, "service/")
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+	namespace, name, ok := strings.Cut(rest, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, true
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type pausableTarget interface {
+	dnsClient
+	txtWriter
+}
+
+// PausableDNS holds back azure writes while paused. The latest desired change for each name
+// is remembered and applied in order once unpaused, so reconciles keep tracking state throughout.
+type PausableDNS struct {
+	dns pausableTarget
+
+	mu        sync.Mutex
+	paused    bool
+	replaying bool // SetPaused(false) is applying the queue, writes still queue behind it
+	pending   map[string]func(context.Context) error
+	order     []string
+}
+
+func NewPausableDNS(dns pausableTarget, paused bool) *PausableDNS {
+	return &PausableDNS{
+		dns:     dns,
+		paused:  paused,
+		pending: map[string]func(context.Context) error{},
+	}
+}
+
+// UpsertDNSRecords reports 0 changed for a write that was queued, it hasn't changed anything yet.
+// changed is atomic because a queued op still sets it when it is replayed.
+func (p *PausableDNS) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	var changed atomic.Int64
+	err := p.do(ctx, "records/"+dnsName, func(ctx context.Context) error {
+		n, err := p.dns.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+		changed.Store(int64(n))
+		return err
+	})
+	return int(changed.Load()), err
+}
+
+func (p *PausableDNS) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return p.do(ctx, "records/"+dnsName, func(ctx context.Context) error {
+		return p.dns.RetainDNSRecords(ctx, dnsName)
+	})
+}
+
+func (p *PausableDNS) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	return p.do(ctx, "extra/"+dnsName, func(ctx context.Context) error {
+		return p.dns.UpsertExtraRecords(ctx, dnsName, records)
+	})
+}
+
+func (p *PausableDNS) UpsertPTRRecords(ctx context.Context, ips []string, target string) error {
+	return p.do(ctx, "ptr/"+strings.Join(ips, ","), func(ctx context.Context) error {
+		return p.dns.UpsertPTRRecords(ctx, ips, target)
+	})
+}
+
+func (p *PausableDNS) DeletePTRRecords(ctx context.Context, ips []string) error {
+	return p.do(ctx, "ptr/"+strings.Join(ips, ","), func(ctx context.Context) error {
+		return p.dns.DeletePTRRecords(ctx, ips)
+	})
+}
+
+// UpsertCNAMERecord shares the records key, a CNAME replaces the address records at the name.
+func (p *PausableDNS) UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error {
+	return p.do(ctx, "records/"+dnsName, func(ctx context.Context) error {
+		return p.dns.UpsertCNAMERecord(ctx, dnsName, target, ttl)
+	})
+}
+
+func (p *PausableDNS) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	return p.do(ctx, "records/"+dnsName, func(ctx context.Context) error {
+		return p.dns.DeleteDNSRecords(ctx, dnsName)
+	})
+}
+
+// BatchDeleteDNSRecords is queued per name while paused so a later upsert of one name still wins.
+func (p *PausableDNS) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	if !p.Paused() {
+		p.mu.Lock()
+		for _, n := range dnsNames {
+			p.supersede(ctx, "records/"+n)
+		}
+		p.mu.Unlock()
+		return p.dns.BatchDeleteDNSRecords(ctx, dnsNames)
+	}
+	for _, n := range dnsNames {
+		if err := p.DeleteDNSRecords(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PausableDNS) UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error {
+	return p.do(ctx, "txt/"+dnsName, func(ctx context.Context) error {
+		return p.dns.UpsertTXTRecord(ctx, dnsName, values)
+	})
+}
+
+// do runs op now or, while paused, queues it replacing any earlier op for the same key in the same zone.
+// The context a queued op is replayed with gets the zone and record source of ctx, so it goes where it would have.
+func (p *PausableDNS) do(ctx context.Context, key string, op func(context.Context) error) error {
+	p.mu.Lock()
+	if !p.paused && !p.replaying {
+		p.supersede(ctx, key)
+		p.mu.Unlock()
+		return op(ctx)
+	}
+	defer p.mu.Unlock()
+	zone, routed := zoneFromContext(ctx)
+	source := recordSource(ctx)
+	key = zone + "/" + key
+	if _, ok := p.pending[key]; !ok {
+		p.order = append(p.order, key)
+	}
+	p.pending[key] = func(ctx context.Context) error {
+		if routed {
+			ctx = withZone(ctx, zone)
+		}
+		if source != "" {
+			ctx = context.WithValue(ctx, recordSourceKey{}, source)
+		}
+		return op(ctx)
+	}
+	return nil
+}
+
+// supersede drops the queued op for key in ctx's zone, left over from a replay that failed, because a newer
+// change to key is being made directly. Replaying it later would undo that change. Needs p.mu held.
+func (p *PausableDNS) supersede(ctx context.Context, key string) {
+	zone, _ := zoneFromContext(ctx)
+	key = zone + "/" + key
+	if _, ok := p.pending[key]; !ok {
+		return
+	}
+	delete(p.pending, key)
+	p.order = slices.DeleteFunc(p.order, func(k string) bool { return k == key })
+}
+
+// Paused is true while writes are held back, which they still are while the queued ones are replayed.
+func (p *PausableDNS) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused || p.replaying
+}
+
+// SetPaused toggles pausing. Unpausing applies every queued change in order, including ones queued
+// while it runs, without holding the lock over azure calls. Ones that fail stay queued and are retried
+// on the next call to SetPaused(false), unless the same key is written directly before then, see supersede.
+// Pausing again stops the replay, what is left stays queued.
+func (p *PausableDNS) SetPaused(ctx context.Context, paused bool) error {
+	p.mu.Lock()
+	if paused != p.paused {
+		log.Printf("Azure writes paused: %v (%d pending changes)", paused, len(p.order))
+	}
+	p.paused = paused
+	if paused || p.replaying {
+		p.mu.Unlock()
+		return nil
+	}
+	p.replaying = true
+	p.mu.Unlock()
+
+	var errs []error
+	var failed []string
+	failedOps := map[string]func(context.Context) error{}
+	for {
+		p.mu.Lock()
+		if p.paused || len(p.order) == 0 {
+			// failed changes go back in front, unless the name was changed again since.
+			var requeue []string
+			for _, key := range failed {
+				if _, ok := p.pending[key]; !ok {
+					requeue = append(requeue, key)
+					p.pending[key] = failedOps[key]
+				}
+			}
+			p.order = append(requeue, p.order...)
+			p.replaying = false
+			p.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		key := p.order[0]
+		op := p.pending[key]
+		p.order = p.order[1:]
+		delete(p.pending, key)
+		p.mu.Unlock()
+
+		if err := op(ctx); err != nil {
+			errs = append(errs, err)
+			failed = append(failed, key)
+			failedOps[key] = op
+		}
+	}
+}
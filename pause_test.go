@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// sourceDNSClient records the record source each upsert was made with.
+type sourceDNSClient struct {
+	*fakeDNSClient
+	sources map[string]string
+}
+
+func (s *sourceDNSClient) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	zone, _ := zoneFromContext(ctx)
+	s.sources[zone+"/"+dnsName] = recordSource(ctx)
+	return s.fakeDNSClient.UpsertDNSRecords(ctx, dnsName, ipList, ttl)
+}
+
+func TestPausableDNSReplaysWithQueuedZone(t *testing.T) {
+	dns := &sourceDNSClient{fakeDNSClient: newFakeDNSClient(), sources: map[string]string{}}
+	p := NewPausableDNS(dns, true)
+	ctx := withRecordSource(context.Background(), "service", types.NamespacedName{Namespace: "default", Name: "web"})
+
+	// the same name in two zones are two changes, not one replacing the other.
+	for _, zone := range []string{"a.example", "b.example"} {
+		if _, err := p.UpsertDNSRecords(withZone(ctx, zone), "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := dns.callCount(); n != 0 {
+		t.Fatalf("%d calls made while paused", n)
+	}
+	if err := p.SetPaused(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	for _, zone := range []string{"a.example", "b.example"} {
+		if !dns.zones[zone]["web.default.svc"] {
+			t.Errorf("replay didn't write web.default.svc to %s, wrote %v", zone, dns.zones)
+		}
+		if got := dns.sources[zone+"/web.default.svc"]; got != "service/default/web" {
+			t.Errorf("replay in %s had record source %q", zone, got)
+		}
+	}
+	if p.Paused() {
+		t.Error("still paused after replay")
+	}
+}
+
+func TestPausedReconcileWritesOnUnpause(t *testing.T) {
+	web := testService("web", "10.0.0.1")
+	gone := testService("gone", "10.0.0.2")
+	r, dns := newTestReconciler(t, web, gone)
+	r.RecordSuffix = "svc"
+	pausable := NewPausableDNS(dns, true)
+	r.dns = pausable
+	ctx := context.Background()
+
+	reconcileService(t, r, web)
+	reconcileService(t, r, gone)
+	if err := r.Delete(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, gone)
+	if n := dns.callCount(); n != 0 {
+		t.Fatalf("%d azure calls made while paused: %v", n, dns.calls)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "runtime"},
+		Data:       map[string]string{pauseConfigMapKey: "false"},
+	}
+	rc := &RuntimeConfigReconciler{
+		Reader:    fake.NewClientBuilder().WithObjects(cm).Build(),
+		ConfigMap: types.NamespacedName{Namespace: "kube-system", Name: "runtime"},
+		Defaults:  RuntimeDefaults{Paused: true},
+		pause:     pausable,
+	}
+	if _, err := rc.Reconcile(ctx, reconcile.Request{NamespacedName: rc.ConfigMap}); err != nil {
+		t.Fatal(err)
+	}
+	if pausable.Paused() {
+		t.Error("still paused after the configmap unpaused")
+	}
+	// the deleted service's upsert was replaced by its delete, only web is written.
+	want := map[string][]string{"web.default.svc": {"10.0.0.1"}}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestFailedReplaySupersededByDirectWrite(t *testing.T) {
+	dns := newFakeDNSClient()
+	p := NewPausableDNS(dns, true)
+	ctx := context.Background()
+	dns.records["web.default.svc"] = []string{"10.0.0.1"}
+	if err := p.DeleteDNSRecords(ctx, "web.default.svc"); err != nil {
+		t.Fatal(err)
+	}
+	dns.err = errors.New("azure unavailable")
+	if err := p.SetPaused(ctx, false); err == nil {
+		t.Fatal("replay didn't fail")
+	}
+	dns.err = nil
+
+	// the service came back and was published again after the failed replay.
+	if _, err := p.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.2"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. a ttl edit in the runtime configmap unpauses again.
+	if err := p.SetPaused(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := dns.snapshot()["web.default.svc"]; !slices.Equal(got, []string{"10.0.0.2"}) {
+		t.Errorf("records = %v, want the direct write 10.0.0.2 left alone, calls %v", got, dns.calls)
+	}
+}
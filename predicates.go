@@ -0,0 +1,112 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// annotationPrefix is the prefix for every service annotation the controller reads.
+const annotationPrefix = "dns.azure.com/"
+
+// serviceChangedPredicate filters service updates down to the ones that can change DNS.
+// Annotations and status don't bump generation so they are compared explicitly.
+func serviceChangedPredicate() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{UpdateFunc: dnsAnnotationsChanged},
+		predicate.Funcs{UpdateFunc: loadBalancerStatusChanged},
+		predicate.Funcs{UpdateFunc: serviceFieldsChanged},
+	)
+}
+
+// serviceFieldsChanged reports whether a field records are built from changed, for when a service's
+// generation doesn't move with its spec. Labels count too, -selector and -filter-expr read them.
+func serviceFieldsChanged(e event.UpdateEvent) bool {
+	oldSvc, ok := e.ObjectOld.(*corev1.Service)
+	if !ok {
+		return true
+	}
+	newSvc, ok := e.ObjectNew.(*corev1.Service)
+	if !ok {
+		return true
+	}
+	return !slices.Equal(oldSvc.Spec.ClusterIPs, newSvc.Spec.ClusterIPs) ||
+		!slices.Equal(oldSvc.Spec.ExternalIPs, newSvc.Spec.ExternalIPs) ||
+		oldSvc.Spec.Type != newSvc.Spec.Type ||
+		oldSvc.Spec.ExternalName != newSvc.Spec.ExternalName ||
+		!maps.Equal(oldSvc.Labels, newSvc.Labels) ||
+		!oldSvc.DeletionTimestamp.Equal(newSvc.DeletionTimestamp)
+}
+
+// dnsAnnotationsChanged reports whether any dns.azure.com/ annotation was added, removed or changed.
+func dnsAnnotationsChanged(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return true
+	}
+	return !reflect.DeepEqual(dnsAnnotations(e.ObjectOld.GetAnnotations()), dnsAnnotations(e.ObjectNew.GetAnnotations()))
+}
+
+// dnsAnnotations leaves out the ones the controller keeps for itself so its own bookkeeping doesn't requeue.
+func dnsAnnotations(annotations map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range annotations {
+		if k == publishedNameAnnotation || k == publishedHostnamesAnnotation || k == publishedZoneAnnotation {
+			continue
+		}
+		if strings.HasPrefix(k, annotationPrefix) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// loadBalancerStatusChanged reports whether the load balancer ingress of a service changed.
+func loadBalancerStatusChanged(e event.UpdateEvent) bool {
+	oldSvc, ok := e.ObjectOld.(*corev1.Service)
+	if !ok {
+		return false
+	}
+	newSvc, ok := e.ObjectNew.(*corev1.Service)
+	if !ok {
+		return false
+	}
+	return !reflect.DeepEqual(oldSvc.Status.LoadBalancer, newSvc.Status.LoadBalancer)
+}
+
+// headlessPredicate passes changes to headless services that can change DNS, like serviceChangedPredicate.
+// Load balancer status doesn't matter, their addresses come from endpoints which are watched separately.
+func headlessPredicate() predicate.Predicate {
+	return predicate.And(
+		predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			svc, ok := obj.(*corev1.Service)
+			return ok && svc.Spec.ClusterIP == corev1.ClusterIPNone
+		}),
+		predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.Funcs{UpdateFunc: dnsAnnotationsChanged},
+			predicate.Funcs{UpdateFunc: serviceFieldsChanged},
+		),
+	)
+}
+
+// selectorPredicate passes services matching sel. An update passes if either side matches so a
+// service relabeled out of the selector is still reconciled and has its records removed.
+func selectorPredicate(sel labels.Selector) predicate.Predicate {
+	matches := func(obj client.Object) bool { return sel.Matches(labels.Set(obj.GetLabels())) }
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return matches(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return matches(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return matches(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return matches(e.ObjectOld) || matches(e.ObjectNew)
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestTTLAnnotationTriggersWrite(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	reconcileService(t, r, svc)
+
+	var current corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &current); err != nil {
+		t.Fatal(err)
+	}
+	updated := current.DeepCopy()
+	updated.Annotations[ttlAnnotation] = "60"
+	// annotations don't bump generation.
+	e := event.UpdateEvent{ObjectOld: &current, ObjectNew: updated}
+	if !serviceChangedPredicate().Update(e) {
+		t.Fatal("adding a ttl annotation doesn't pass serviceChangedPredicate")
+	}
+	if err := r.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, svc)
+	if got := dns.ttls["web.default.svc"]; got != 60 {
+		t.Errorf("ttl written = %d, want 60", got)
+	}
+
+	// the reconciler's own bookkeeping doesn't requeue.
+	bookkeeping := updated.DeepCopy()
+	setPublishedNames(bookkeeping, []string{"web.default.svc", "www.default.svc"})
+	if serviceChangedPredicate().Update(event.UpdateEvent{ObjectOld: updated, ObjectNew: bookkeeping}) {
+		t.Error("a published names update passes serviceChangedPredicate")
+	}
+}
+
+func TestHeadlessTTLAnnotationTriggersWrite(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	r, dns := newTestHeadlessReconciler(t, svc, testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.1.1")))
+	r.recordTTL = (&ServiceReconciler{}).recordTTL
+	key := types.NamespacedName{Namespace: "default", Name: "db"}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	var current corev1.Service
+	if err := r.Get(context.Background(), key, &current); err != nil {
+		t.Fatal(err)
+	}
+	updated := current.DeepCopy()
+	updated.Annotations[ttlAnnotation] = "60"
+	if !headlessPredicate().Update(event.UpdateEvent{ObjectOld: &current, ObjectNew: updated}) {
+		t.Fatal("adding a ttl annotation doesn't pass headlessPredicate")
+	}
+	if err := r.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if got := dns.ttls["db.default.svc"]; got != 60 {
+		t.Errorf("ttl written = %d, want 60", got)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Preflight checks at startup that the zone exists and its record sets can be listed with the credentials
+// given, so a typo in -zoneName or -resourcegroup or a missing role assignment stops the controller straight
+// away instead of failing every reconcile. A zone that doesn't exist yet is waited for, see WaitForZone.
+func (r *AzureDNSConfig) Preflight(ctx context.Context, zoneWait time.Duration) error {
+	if err := r.WaitForZone(ctx, zoneWait); err != nil {
+		return fmt.Errorf("reading zone %s in resource group %s: %s: %w", r.ZoneName, r.ResourceGroup, azureFailure(err), err)
+	}
+	// reading the zone doesn't prove the record sets in it can be read, a role can be scoped to the zone alone.
+	pager := r.DNSClient.NewListPager(r.ResourceGroup, r.ZoneName, &dns.RecordSetsClientListOptions{Top: to.Int32Ptr(1)})
+	if _, err := pager.NextPage(ctx); err != nil {
+		return fmt.Errorf("listing record sets of zone %s: %s: %w", r.ZoneName, azureFailure(err), err)
+	}
+	return nil
+}
+
+// azureFailure says what kind of failure err is in terms an operator can act on: the zone, resource group
+// or subscription not existing, the identity not being allowed, authenticating failing or azure being unreachable.
+func azureFailure(err error) string {
+	var respErr *azcore.ResponseError
+	var authErr *azidentity.AuthenticationFailedError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &authErr):
+		return "authentication failed, check -client-id, -tenant-id or -credential-secret and the identity they name"
+	case errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound:
+		return fmt.Sprintf("not found (%s), check -zoneName, -resourcegroup and -subscription", respErr.ErrorCode)
+	case errors.As(err, &respErr) && (respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden):
+		return fmt.Sprintf("access denied (%s), the identity needs a (Private) DNS Zone Contributor role on the zone", respErr.ErrorCode)
+	case errors.As(err, &respErr):
+		return fmt.Sprintf("azure returned %d (%s)", respErr.StatusCode, respErr.ErrorCode)
+	case errors.Is(err, errAzureTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timed out reaching azure"
+	case errors.As(err, &netErr):
+		return "network error reaching azure"
+	default:
+		return "unexpected error"
+	}
+}
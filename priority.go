@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// deletionPriority puts services being deleted ahead of everything else in the queue.
+// A stale record for a deleted service does more harm than a new one showing up a little late.
+const deletionPriority = 10
+
+// deletionsFirst enqueues objects like handler.EnqueueRequestForObject but, when the controller
+// runs with the priority queue, objects with a deletion timestamp go in at deletionPriority.
+// Updates to objects that aren't deleting wait out Debounce, so a flapping one is reconciled once for the lot.
+type deletionsFirst struct {
+	Debounce time.Duration
+}
+
+var _ handler.EventHandler = deletionsFirst{}
+
+func (deletionsFirst) Create(_ context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	enqueue(e.Object, q)
+}
+
+func (d deletionsFirst) Update(_ context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	if d.Debounce > 0 && e.ObjectNew != nil && e.ObjectNew.GetDeletionTimestamp() == nil {
+		// the delaying queue keeps the earliest time an object is due, later updates fold into it.
+		q.AddAfter(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(e.ObjectNew)}, d.Debounce)
+		return
+	}
+	enqueue(e.ObjectNew, q)
+}
+
+func (deletionsFirst) Delete(_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	enqueue(e.Object, q)
+}
+
+func (deletionsFirst) Generic(_ context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	enqueue(e.Object, q)
+}
+
+func enqueue(obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	if obj == nil {
+		return
+	}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)}
+	if pq, ok := q.(priorityqueue.PriorityQueue[reconcile.Request]); ok && obj.GetDeletionTimestamp() != nil {
+		pq.AddWithOpts(priorityqueue.AddOpts{Priority: deletionPriority}, req)
+		return
+	}
+	q.Add(req)
+}
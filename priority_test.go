@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDeletingServiceHandledBeforeNewOne(t *testing.T) {
+	q := priorityqueue.New[reconcile.Request]("test")
+	defer q.ShutDown()
+	h := deletionsFirst{}
+	ctx := context.Background()
+
+	// the backlog already has new services waiting when a delete comes in.
+	for _, name := range []string{"new-a", "new-b"} {
+		h.Create(ctx, event.CreateEvent{Object: testService(name, "10.0.0.1")}, q)
+	}
+	deleting := testService("old", "10.0.0.9")
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	h.Update(ctx, event.UpdateEvent{ObjectOld: testService("old", "10.0.0.9"), ObjectNew: deleting}, q)
+
+	req, priority, _ := q.GetWithPriority()
+	if req.Name != "old" || priority != deletionPriority {
+		t.Errorf("first reconcile is %s at priority %d, want old at %d", req.Name, priority, deletionPriority)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// reverseName is the in-addr.arpa or ip6.arpa name a PTR record for ip lives at,
+// 10.0.0.1 becomes 1.0.0.10.in-addr.arpa and IPv6 addresses are reversed nibble by nibble.
+func reverseName(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP %q", ip)
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(parsed) - 1; i >= 0; i-- {
+		b.WriteByte(hex[parsed[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[parsed[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String(), nil
+}
+
+// reverseRecordName is reverseName relative to the zone. ok is false for addresses outside the zone,
+// e.g. IPv6 cluster IPs with only an in-addr.arpa zone configured.
+func (r *AzureDNSConfig) reverseRecordName(ip string) (name string, ok bool, err error) {
+	fqdn, err := reverseName(ip)
+	if err != nil {
+		return "", false, err
+	}
+	name, ok = strings.CutSuffix(fqdn, "."+r.ZoneName)
+	return name, ok, nil
+}
+
+// UpsertPTRRecords points the PTR record of every ip in the zone at target, an FQDN.
+// It is meant for a reverse zone, addresses outside it are skipped.
+func (r *AzureDNSConfig) UpsertPTRRecords(ctx context.Context, ips []string, target string) error {
+	for _, ip := range ips {
+		name, ok, err := r.reverseRecordName(ip)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		rs := dns.RecordSet{
+			Properties: &dns.RecordSetProperties{
+				TTL:        to.Int64Ptr(r.ttl(0)),
+				PtrRecords: []*dns.PtrRecord{{Ptrdname: to.StringPtr(normalizeTarget(target))}},
+			},
+		}
+		if _, err := r.writeRecordSet(ctx, dns.RecordTypePTR, name, rs); err != nil {
+			return fmt.Errorf("error writing PTR record for %s: %w", ip, err)
+		}
+	}
+	return nil
+}
+
+// DeletePTRRecords removes the PTR records of ips written by UpsertPTRRecords.
+func (r *AzureDNSConfig) DeletePTRRecords(ctx context.Context, ips []string) error {
+	for _, ip := range ips {
+		name, ok, err := r.reverseRecordName(ip)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, err := r.deleteRecordSet(ctx, dns.RecordTypePTR, name); err != nil {
+			return fmt.Errorf("error deleting PTR record for %s: %w", ip, err)
+		}
+	}
+	return nil
+}
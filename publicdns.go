@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/dns/armdns"
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Zone types for -zoneType.
+const (
+	zoneTypePrivate = "private"
+	zoneTypePublic  = "public"
+)
+
+func parseZoneType(v string) (string, error) {
+	if v != zoneTypePrivate && v != zoneTypePublic {
+		return "", fmt.Errorf("unknown zone type %q, must be %s or %s", v, zoneTypePrivate, zoneTypePublic)
+	}
+	return v, nil
+}
+
+// zonesAPI is the part of the azure zones client the controller uses.
+type zonesAPI interface {
+	Get(ctx context.Context, resourceGroupName, privateZoneName string, options *dns.PrivateZonesClientGetOptions) (dns.PrivateZonesClientGetResponse, error)
+}
+
+// recordTypeCAA is a record type only public zones have. The private DNS models have no CAA records,
+// the rest of the controller carries each one as a TXT record of its flags, tag and value.
+const recordTypeCAA = dns.RecordType(armdns.RecordTypeCAA)
+
+// publicRecordSets adapts the public DNS record sets client to recordSetsAPI so the rest of the
+// controller only speaks private DNS types. The record set models are the same apart from the
+// record types private zones don't have, CAA which is carried as TXT records and NS which is dropped.
+type publicRecordSets struct {
+	client *armdns.RecordSetsClient
+}
+
+// provisioningStateKey carries a *string for Get to report the record set's provisioningState in. Only public
+// record sets have one, the private DNS model it is converted to has nowhere to keep it.
+type provisioningStateKey struct{}
+
+// withProvisioningState has a Get through publicRecordSets set state to the record set's provisioningState.
+func withProvisioningState(ctx context.Context, state *string) context.Context {
+	return context.WithValue(ctx, provisioningStateKey{}, state)
+}
+
+func (c publicRecordSets) Get(ctx context.Context, resourceGroupName, zoneName string, recordType dns.RecordType, relativeRecordSetName string, _ *dns.RecordSetsClientGetOptions) (dns.RecordSetsClientGetResponse, error) {
+	resp, err := c.client.Get(ctx, resourceGroupName, zoneName, relativeRecordSetName, armdns.RecordType(recordType), nil)
+	if err != nil {
+		return dns.RecordSetsClientGetResponse{}, err
+	}
+	if state, ok := ctx.Value(provisioningStateKey{}).(*string); ok && resp.Properties != nil {
+		*state = to.String(resp.Properties.ProvisioningState)
+	}
+	return dns.RecordSetsClientGetResponse{RecordSet: fromPublicRecordSet(resp.RecordSet)}, nil
+}
+
+func (c publicRecordSets) CreateOrUpdate(ctx context.Context, resourceGroupName, zoneName string, recordType dns.RecordType, relativeRecordSetName string, parameters dns.RecordSet, options *dns.RecordSetsClientCreateOrUpdateOptions) (dns.RecordSetsClientCreateOrUpdateResponse, error) {
+	var opts armdns.RecordSetsClientCreateOrUpdateOptions
+	if options != nil {
+		opts.IfMatch, opts.IfNoneMatch = options.IfMatch, options.IfNoneMatch
+	}
+	resp, err := c.client.CreateOrUpdate(ctx, resourceGroupName, zoneName, relativeRecordSetName, armdns.RecordType(recordType), toPublicRecordSet(recordType, parameters), &opts)
+	if err != nil {
+		return dns.RecordSetsClientCreateOrUpdateResponse{}, err
+	}
+	return dns.RecordSetsClientCreateOrUpdateResponse{RecordSet: fromPublicRecordSet(resp.RecordSet)}, nil
+}
+
+func (c publicRecordSets) Delete(ctx context.Context, resourceGroupName, zoneName string, recordType dns.RecordType, relativeRecordSetName string, options *dns.RecordSetsClientDeleteOptions) (dns.RecordSetsClientDeleteResponse, error) {
+	var opts armdns.RecordSetsClientDeleteOptions
+	if options != nil {
+		opts.IfMatch = options.IfMatch
+	}
+	_, err := c.client.Delete(ctx, resourceGroupName, zoneName, relativeRecordSetName, armdns.RecordType(recordType), &opts)
+	return dns.RecordSetsClientDeleteResponse{}, err
+}
+
+func (c publicRecordSets) NewListPager(resourceGroupName, zoneName string, options *dns.RecordSetsClientListOptions) *runtime.Pager[dns.RecordSetsClientListResponse] {
+	var opts armdns.RecordSetsClientListByDNSZoneOptions
+	if options != nil {
+		opts.Recordsetnamesuffix, opts.Top = options.Recordsetnamesuffix, options.Top
+	}
+	pager := c.client.NewListByDNSZonePager(resourceGroupName, zoneName, &opts)
+	return runtime.NewPager(runtime.PagingHandler[dns.RecordSetsClientListResponse]{
+		More: func(dns.RecordSetsClientListResponse) bool { return pager.More() },
+		Fetcher: func(ctx context.Context, _ *dns.RecordSetsClientListResponse) (dns.RecordSetsClientListResponse, error) {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return dns.RecordSetsClientListResponse{}, err
+			}
+			resp := dns.RecordSetsClientListResponse{RecordSetListResult: dns.RecordSetListResult{NextLink: page.NextLink}}
+			for _, rs := range page.Value {
+				if rs != nil {
+					converted := fromPublicRecordSet(*rs)
+					resp.Value = append(resp.Value, &converted)
+				}
+			}
+			return resp, nil
+		},
+	})
+}
+
+// publicZones adapts the public DNS zones client to zonesAPI.
+type publicZones struct {
+	client *armdns.ZonesClient
+}
+
+func (c publicZones) Get(ctx context.Context, resourceGroupName, zoneName string, _ *dns.PrivateZonesClientGetOptions) (dns.PrivateZonesClientGetResponse, error) {
+	resp, err := c.client.Get(ctx, resourceGroupName, zoneName, nil)
+	if err != nil {
+		return dns.PrivateZonesClientGetResponse{}, err
+	}
+	return dns.PrivateZonesClientGetResponse{PrivateZone: dns.PrivateZone{
+		Etag:     resp.Etag,
+		ID:       resp.ID,
+		Location: resp.Location,
+		Name:     resp.Name,
+		Tags:     resp.Tags,
+		Type:     resp.Type,
+	}}, nil
+}
+
+// toPublicRecordSet converts rs, a record set of type rt, to the public DNS model.
+func toPublicRecordSet(rt dns.RecordType, rs dns.RecordSet) armdns.RecordSet {
+	out := armdns.RecordSet{Etag: rs.Etag, ID: rs.ID, Name: rs.Name, Type: rs.Type}
+	p := rs.Properties
+	if p == nil {
+		return out
+	}
+	out.Properties = &armdns.RecordSetProperties{TTL: p.TTL, Metadata: p.Metadata, Fqdn: p.Fqdn}
+	for _, a := range p.ARecords {
+		out.Properties.ARecords = append(out.Properties.ARecords, &armdns.ARecord{IPv4Address: a.IPv4Address})
+	}
+	for _, a := range p.AaaaRecords {
+		out.Properties.AaaaRecords = append(out.Properties.AaaaRecords, &armdns.AaaaRecord{IPv6Address: a.IPv6Address})
+	}
+	if p.CnameRecord != nil {
+		out.Properties.CnameRecord = &armdns.CnameRecord{Cname: p.CnameRecord.Cname}
+	}
+	for _, mx := range p.MxRecords {
+		out.Properties.MxRecords = append(out.Properties.MxRecords, &armdns.MxRecord{Exchange: mx.Exchange, Preference: mx.Preference})
+	}
+	for _, ptr := range p.PtrRecords {
+		out.Properties.PtrRecords = append(out.Properties.PtrRecords, &armdns.PtrRecord{Ptrdname: ptr.Ptrdname})
+	}
+	for _, srv := range p.SrvRecords {
+		out.Properties.SrvRecords = append(out.Properties.SrvRecords, &armdns.SrvRecord{Port: srv.Port, Priority: srv.Priority, Target: srv.Target, Weight: srv.Weight})
+	}
+	for _, txt := range p.TxtRecords {
+		if rt == recordTypeCAA && len(txt.Value) == 3 {
+			flags, _ := strconv.ParseInt(to.String(txt.Value[0]), 10, 32)
+			out.Properties.CaaRecords = append(out.Properties.CaaRecords, &armdns.CaaRecord{Flags: to.Int32Ptr(int32(flags)), Tag: txt.Value[1], Value: txt.Value[2]})
+			continue
+		}
+		out.Properties.TxtRecords = append(out.Properties.TxtRecords, &armdns.TxtRecord{Value: txt.Value})
+	}
+	if soa := p.SoaRecord; soa != nil {
+		out.Properties.SoaRecord = &armdns.SoaRecord{Email: soa.Email, ExpireTime: soa.ExpireTime, Host: soa.Host, MinimumTTL: soa.MinimumTTL, RefreshTime: soa.RefreshTime, RetryTime: soa.RetryTime, SerialNumber: soa.SerialNumber}
+	}
+	return out
+}
+
+func fromPublicRecordSet(rs armdns.RecordSet) dns.RecordSet {
+	out := dns.RecordSet{Etag: rs.Etag, ID: rs.ID, Name: rs.Name, Type: rs.Type}
+	p := rs.Properties
+	if p == nil {
+		return out
+	}
+	out.Properties = &dns.RecordSetProperties{TTL: p.TTL, Metadata: p.Metadata, Fqdn: p.Fqdn}
+	for _, a := range p.ARecords {
+		out.Properties.ARecords = append(out.Properties.ARecords, &dns.ARecord{IPv4Address: a.IPv4Address})
+	}
+	for _, a := range p.AaaaRecords {
+		out.Properties.AaaaRecords = append(out.Properties.AaaaRecords, &dns.AaaaRecord{IPv6Address: a.IPv6Address})
+	}
+	if p.CnameRecord != nil {
+		out.Properties.CnameRecord = &dns.CnameRecord{Cname: p.CnameRecord.Cname}
+	}
+	for _, mx := range p.MxRecords {
+		out.Properties.MxRecords = append(out.Properties.MxRecords, &dns.MxRecord{Exchange: mx.Exchange, Preference: mx.Preference})
+	}
+	for _, ptr := range p.PtrRecords {
+		out.Properties.PtrRecords = append(out.Properties.PtrRecords, &dns.PtrRecord{Ptrdname: ptr.Ptrdname})
+	}
+	for _, srv := range p.SrvRecords {
+		out.Properties.SrvRecords = append(out.Properties.SrvRecords, &dns.SrvRecord{Port: srv.Port, Priority: srv.Priority, Target: srv.Target, Weight: srv.Weight})
+	}
+	for _, txt := range p.TxtRecords {
+		out.Properties.TxtRecords = append(out.Properties.TxtRecords, &dns.TxtRecord{Value: txt.Value})
+	}
+	for _, caa := range p.CaaRecords {
+		flags := strconv.Itoa(int(to.Int32(caa.Flags)))
+		out.Properties.TxtRecords = append(out.Properties.TxtRecords, &dns.TxtRecord{Value: []*string{&flags, caa.Tag, caa.Value}})
+	}
+	if soa := p.SoaRecord; soa != nil {
+		out.Properties.SoaRecord = &dns.SoaRecord{Email: soa.Email, ExpireTime: soa.ExpireTime, Host: soa.Host, MinimumTTL: soa.MinimumTTL, RefreshTime: soa.RefreshTime, RetryTime: soa.RetryTime, SerialNumber: soa.SerialNumber}
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// recordCache remembers the record sets of a zone as last read or written, so a write azure already holds
+// and a delete of a record set that doesn't exist skip the Get they would otherwise make. Entries expire
+// after TTL in case something else changed the zone, and RecordCacheSync refreshes them all by listing it.
+type recordCache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[recordKey]cachedRecordSet
+	listed  time.Time // when the zone was last listed in full, record sets missing from that list don't exist
+}
+
+type recordKey struct {
+	rt   dns.RecordType
+	name string // lower case, azure names aren't case sensitive
+}
+
+type cachedRecordSet struct {
+	props *dns.RecordSetProperties // nil when there is no record set
+	etag  *string
+	at    time.Time // zero for a forgotten record set
+}
+
+func newRecordCache(ttl time.Duration) *recordCache {
+	return &recordCache{TTL: ttl, entries: map[recordKey]cachedRecordSet{}}
+}
+
+func cacheKey(rt dns.RecordType, name string) recordKey {
+	return recordKey{rt: rt, name: strings.ToLower(name)}
+}
+
+// get returns the rt record set at name, nil properties when there is none. ok is false when it isn't
+// known or is older than TTL. Safe to call on a nil cache, which knows nothing.
+func (c *recordCache) get(rt dns.RecordType, name string) (props *dns.RecordSetProperties, etag *string, ok bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[cacheKey(rt, name)]
+	if found {
+		if time.Since(e.at) > c.TTL {
+			return nil, nil, false
+		}
+		return e.props, e.etag, true
+	}
+	// not in the last full list, so it didn't exist then.
+	return nil, nil, time.Since(c.listed) <= c.TTL
+}
+
+// set records what azure holds for the rt record set at name, nil properties for none.
+func (c *recordCache) set(rt dns.RecordType, name string, props *dns.RecordSetProperties, etag *string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(rt, name)] = cachedRecordSet{props: props, etag: etag, at: time.Now()}
+}
+
+// forget drops the rt record set at name after a write that may or may not have landed, the next use reads it.
+func (c *recordCache) forget(rt dns.RecordType, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// kept as a stale entry rather than deleted, a missing one would read as not existing after a list.
+	c.entries[cacheKey(rt, name)] = cachedRecordSet{}
+}
+
+// replace swaps the entries for a full list of the zone started at start. Entries set since then are
+// newer than the list and kept.
+func (c *recordCache) replace(sets []dns.RecordSet, start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := map[recordKey]cachedRecordSet{}
+	for _, rs := range sets {
+		entries[cacheKey(recordTypeFromResourceType(*rs.Type), *rs.Name)] = cachedRecordSet{props: rs.Properties, etag: rs.Etag, at: start}
+	}
+	for k, e := range c.entries {
+		if e.at.After(start) {
+			entries[k] = e
+		}
+	}
+	c.entries = entries
+	c.listed = start
+}
+
+// cacheEntry is one cached record set in the debug dump.
+type cacheEntry struct {
+	Values  []string `json:"values"` // none for a record set known not to exist
+	Exists  bool     `json:"exists"`
+	Age     string   `json:"age"`
+	Expired bool     `json:"expired"`
+}
+
+// snapshot is every entry by type/name, forgotten ones left out. Safe to call on a nil cache.
+func (c *recordCache) snapshot() map[string]cacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]cacheEntry, len(c.entries))
+	for k, e := range c.entries {
+		if e.at.IsZero() {
+			continue
+		}
+		age := time.Since(e.at)
+		out[string(k.rt)+"/"+k.name] = cacheEntry{
+			Values:  recordSetValues(e.props),
+			Exists:  e.props != nil,
+			Age:     age.Round(time.Second).String(),
+			Expired: age > c.TTL,
+		}
+	}
+	return out
+}
+
+// WithRecordCache caches record sets for ttl, see recordCache. 0 turns the cache off.
+func WithRecordCache(ttl time.Duration) Option {
+	return func(r *AzureDNSConfig) {
+		if ttl > 0 {
+			r.cache = newRecordCache(ttl)
+		}
+	}
+}
+
+// readRecordSet is the rt record set at dnsName from the cache, else from azure. Its properties are nil when
+// there is none. cached tells a write conditional on the etag that a failed precondition may just mean a stale cache.
+func (r *AzureDNSConfig) readRecordSet(ctx context.Context, rt dns.RecordType, dnsName string) (current dns.RecordSet, cached bool, err error) {
+	if props, etag, ok := r.cache.get(rt, dnsName); ok {
+		return dns.RecordSet{Properties: props, Etag: etag}, true, nil
+	}
+	resp, err := r.DNSClient.Get(ctx, r.ResourceGroup, r.ZoneName, rt, dnsName, &dns.RecordSetsClientGetOptions{})
+	if isNotFound(err) {
+		r.cache.set(rt, dnsName, nil, nil)
+		return dns.RecordSet{}, false, nil
+	}
+	if err != nil {
+		return dns.RecordSet{}, false, err
+	}
+	if resp.Properties != nil {
+		r.cache.set(rt, dnsName, resp.Properties, resp.Etag)
+	}
+	return resp.RecordSet, false, nil
+}
+
+// SyncRecordCache lists the zone and replaces the cached record sets with what it holds.
+func (r *AzureDNSConfig) SyncRecordCache(ctx context.Context) error {
+	if r.cache == nil {
+		return nil
+	}
+	start := time.Now()
+	var sets []dns.RecordSet
+	pager := r.DNSClient.NewListPager(r.ResourceGroup, r.ZoneName, &dns.RecordSetsClientListOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing zone %s: %w", r.ZoneName, err)
+		}
+		for _, rs := range page.Value {
+			if rs != nil && rs.Name != nil && rs.Type != nil {
+				sets = append(sets, *rs)
+			}
+		}
+	}
+	r.cache.replace(sets, start)
+	debugf("Cached %d record sets of zone %s", len(sets), r.ZoneName)
+	return nil
+}
+
+// RecordCacheSync relists every zone on an interval, well inside the cache TTL so entries rarely expire.
+type RecordCacheSync struct {
+	zones    []*AzureDNSConfig
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable. It runs on the leader, the only replica writing.
+func (s *RecordCacheSync) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		for _, zone := range s.zones {
+			if err := zone.SyncRecordCache(ctx); err != nil {
+				log.Printf("Failed to sync the record cache, entries expire as usual: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
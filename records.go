@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// recordsAnnotation holds extra records to publish at a service's name, as a JSON list like
+// [{"type": "MX", "value": "10 mail.example.com", "ttl": 3600}].
+const recordsAnnotation = annotationPrefix + "records"
+
+// ExtraRecord is one entry of the dns.azure.com/records annotation.
+type ExtraRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl,omitempty"` // 0 uses the zone's
+}
+
+// extraRecordTypes are the types the records annotation may hold in any zone.
+var extraRecordTypes = []dns.RecordType{dns.RecordTypeMX}
+
+// publicExtraRecordTypes are the types it may also hold when the zones are public. Private zones can't hold CAA or NS records.
+var publicExtraRecordTypes = []dns.RecordType{recordTypeCAA}
+
+// extraRecordTypesFor returns the types the records annotation may hold in public or private zones.
+func extraRecordTypesFor(public bool) []dns.RecordType {
+	if public {
+		return slices.Concat(extraRecordTypes, publicExtraRecordTypes)
+	}
+	return extraRecordTypes
+}
+
+// parseExtraRecords parses and validates a records annotation for public or private zones.
+func parseExtraRecords(v string, public bool) ([]ExtraRecord, error) {
+	var records []ExtraRecord
+	if err := json.Unmarshal([]byte(v), &records); err != nil {
+		return nil, err
+	}
+	for i := range records {
+		rec := &records[i]
+		rec.Type = strings.ToUpper(rec.Type)
+		if rec.TTL < 0 {
+			return nil, fmt.Errorf("negative ttl %d", rec.TTL)
+		}
+		switch dns.RecordType(rec.Type) {
+		case dns.RecordTypeMX:
+			if _, err := parseMX(rec.Value); err != nil {
+				return nil, err
+			}
+		case recordTypeCAA:
+			if !public {
+				return nil, fmt.Errorf("%s records aren't supported in azure private zones", rec.Type)
+			}
+			if _, err := parseCAA(rec.Value); err != nil {
+				return nil, err
+			}
+		case "NS":
+			return nil, fmt.Errorf("%s records aren't supported, the zone's own name servers are managed by azure", rec.Type)
+		default:
+			return nil, fmt.Errorf("unsupported record type %q", rec.Type)
+		}
+	}
+	return records, nil
+}
+
+// parseMX parses an MX value, "<preference> <exchange>".
+func parseMX(v string) (*dns.MxRecord, error) {
+	pref, exchange, ok := strings.Cut(strings.TrimSpace(v), " ")
+	exchange = normalizeTarget(strings.TrimSpace(exchange))
+	if !ok || exchange == "" {
+		return nil, fmt.Errorf("MX value %q is not \"<preference> <exchange>\"", v)
+	}
+	p, err := strconv.ParseUint(pref, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("MX value %q has an invalid preference: %w", v, err)
+	}
+	return &dns.MxRecord{Preference: to.Int32Ptr(int32(p)), Exchange: to.StringPtr(exchange)}, nil
+}
+
+// parseCAA parses a CAA value, "<flags> <tag> <value>" with the value optionally quoted. The private DNS
+// models have no CAA records so it is returned as a TXT record of those three strings, see toPublicRecordSet.
+func parseCAA(v string) (*dns.TxtRecord, error) {
+	fields := strings.SplitN(strings.TrimSpace(v), " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("CAA value %q is not \"<flags> <tag> <value>\"", v)
+	}
+	if _, err := strconv.ParseUint(fields[0], 10, 8); err != nil {
+		return nil, fmt.Errorf("CAA value %q has invalid flags: %w", v, err)
+	}
+	tag := strings.ToLower(fields[1])
+	if tag == "" || strings.IndexFunc(tag, func(r rune) bool { return (r < 'a' || r > 'z') && (r < '0' || r > '9') }) >= 0 {
+		return nil, fmt.Errorf("CAA value %q has an invalid tag %q", v, fields[1])
+	}
+	value := strings.TrimSpace(fields[2])
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	return &dns.TxtRecord{Value: []*string{to.StringPtr(fields[0]), to.StringPtr(tag), to.StringPtr(value)}}, nil
+}
+
+// UpsertExtraRecords makes records the extra record sets at dnsName. It is authoritative,
+// each type the zone can hold that has no records is removed.
+func (r *AzureDNSConfig) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	dnsName, err := r.relativeName(dnsName)
+	if err != nil {
+		return err
+	}
+	for _, rt := range extraRecordTypesFor(r.Public) {
+		props := &dns.RecordSetProperties{}
+		var ttl int64
+		for _, rec := range records {
+			if dns.RecordType(rec.Type) != rt {
+				continue
+			}
+			// a record set has a single ttl, the longest asked for wins.
+			ttl = max(ttl, rec.TTL)
+			switch rt {
+			case recordTypeCAA:
+				caa, err := parseCAA(rec.Value)
+				if err != nil {
+					return err
+				}
+				props.TxtRecords = append(props.TxtRecords, caa)
+			default:
+				mx, err := parseMX(rec.Value)
+				if err != nil {
+					return err
+				}
+				props.MxRecords = append(props.MxRecords, mx)
+			}
+		}
+		if len(props.MxRecords) == 0 && len(props.TxtRecords) == 0 {
+			if _, err := r.deleteRecordSet(ctx, rt, dnsName); err != nil {
+				return fmt.Errorf("error deleting %s records: %w", rt, err)
+			}
+			continue
+		}
+		props.TTL = to.Int64Ptr(r.ttl(ttl))
+		if _, err := r.writeRecordSet(ctx, rt, dnsName, dns.RecordSet{Properties: props}); err != nil {
+			return fmt.Errorf("error upserting %s records: %w", rt, err)
+		}
+	}
+	return nil
+}
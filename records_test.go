@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCAARecordCreatedAndRemoved(t *testing.T) {
+	if _, err := parseExtraRecords(`[{"type": "caa", "value": "0 issue \"letsencrypt.org\""}]`, false); err == nil {
+		t.Error("CAA accepted for private zones")
+	}
+	extras, err := parseExtraRecords(`[{"type": "caa", "value": "0 issue \"letsencrypt.org\""}]`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, sets := newTestAzureDNSConfig(t, WithPublic(true))
+	ctx := context.Background()
+	if err := r.UpsertExtraRecords(ctx, "web.default.svc", extras); err != nil {
+		t.Fatal(err)
+	}
+	rs, ok := sets.sets[fakeKey(recordTypeCAA, "web.default.svc")]
+	if !ok {
+		t.Fatalf("no CAA record set, have %v", sets.calls)
+	}
+	caa := toPublicRecordSet(recordTypeCAA, rs).Properties.CaaRecords
+	if len(caa) != 1 || to.Int32(caa[0].Flags) != 0 || to.String(caa[0].Tag) != "issue" || to.String(caa[0].Value) != "letsencrypt.org" {
+		t.Errorf("public CAA records = %+v", caa)
+	}
+	if back := fromPublicRecordSet(toPublicRecordSet(recordTypeCAA, rs)); len(back.Properties.TxtRecords) != 1 || len(back.Properties.TxtRecords[0].Value) != 3 {
+		t.Errorf("CAA didn't round trip: %+v", back.Properties)
+	}
+
+	if err := r.UpsertExtraRecords(ctx, "web.default.svc", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(recordTypeCAA, "web.default.svc")]; ok {
+		t.Error("CAA record set left after the annotation was removed")
+	}
+}
+
+func TestReconcileCAAAnnotation(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	svc.Annotations = map[string]string{recordsAnnotation: `[{"type": "CAA", "value": "0 issue letsencrypt.org"}]`}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.PublicZones = true
+	reconcileService(t, r, svc)
+	if got := dns.extras["web.default.svc"]; len(got) != 1 || got[0].Type != "CAA" {
+		t.Fatalf("extra records = %v, want the CAA record", got)
+	}
+
+	var current corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &current); err != nil {
+		t.Fatal(err)
+	}
+	delete(current.Annotations, recordsAnnotation)
+	if err := r.Update(context.Background(), &current); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, svc)
+	if got, ok := dns.extras["web.default.svc"]; ok {
+		t.Errorf("extra records %v left after the annotation was removed", got)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Keys in the runtime configmap. These are the only hot reloadable settings,
+// every other flag needs a restart to change.
+const (
+	pauseConfigMapKey  = "paused"      // same as -paused
+	ttlConfigMapKey    = "ttl"         // overrides -ttl and -ttl-from-soa, 0 to clear
+	filterConfigMapKey = "filter-expr" // same as -filter-expr, empty manages every service
+)
+
+// RuntimeDefaults are the flag values used for keys missing from the runtime configmap.
+type RuntimeDefaults struct {
+	Paused     bool
+	TTL        int64
+	FilterExpr string
+}
+
+// RuntimeConfigReconciler applies the runtime configmap to the running controller.
+// A TTL or filter change re-reconciles every service so the new setting takes effect everywhere.
+type RuntimeConfigReconciler struct {
+	client.Reader
+	ConfigMap types.NamespacedName
+	Defaults  RuntimeDefaults
+
+	pause  *PausableDNS
+	ttl    *atomic.Int64
+	filter *atomic.Pointer[ServiceFilter]
+	resync chan<- event.GenericEvent
+
+	ttlApplied    int64
+	filterApplied string
+}
+
+func (r *RuntimeConfigReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	if req.NamespacedName != r.ConfigMap {
+		return reconcile.Result{}, nil
+	}
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, req.NamespacedName, &cm); err != nil && !apierrors.IsNotFound(err) {
+		return reconcile.Result{}, err
+	}
+
+	paused := r.Defaults.Paused
+	if v, ok := cm.Data[pauseConfigMapKey]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("Ignoring invalid %s=%q in configmap %s: %v", pauseConfigMapKey, v, r.ConfigMap, err)
+		} else {
+			paused = b
+		}
+	}
+
+	ttl := r.Defaults.TTL
+	if v, ok := cm.Data[ttlConfigMapKey]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Printf("Ignoring invalid %s=%q in configmap %s: %v", ttlConfigMapKey, v, r.ConfigMap, err)
+		} else {
+			ttl = n
+		}
+	}
+
+	filterExpr := r.Defaults.FilterExpr
+	if v, ok := cm.Data[filterConfigMapKey]; ok {
+		filterExpr = v
+	}
+
+	resync := false
+	if ttl != r.ttlApplied {
+		log.Printf("Runtime config: ttl %d -> %d", r.ttlApplied, ttl)
+		r.ttl.Store(ttl)
+		r.ttlApplied = ttl
+		resync = true
+	}
+	if filterExpr != r.filterApplied {
+		var filter *ServiceFilter
+		if filterExpr != "" {
+			f, err := NewServiceFilter(filterExpr)
+			if err != nil {
+				// keep the filter we have rather than suddenly managing everything.
+				log.Printf("Ignoring invalid %s=%q in configmap %s: %v", filterConfigMapKey, filterExpr, r.ConfigMap, err)
+				return reconcile.Result{}, r.pause.SetPaused(ctx, paused)
+			}
+			filter = f
+		}
+		log.Printf("Runtime config: filter-expr %q -> %q", r.filterApplied, filterExpr)
+		r.filter.Store(filter)
+		r.filterApplied = filterExpr
+		resync = true
+	}
+
+	if err := r.pause.SetPaused(ctx, paused); err != nil {
+		return reconcile.Result{}, err
+	}
+	if resync {
+		return reconcile.Result{}, r.resyncServices(ctx)
+	}
+	return reconcile.Result{}, nil
+}
+
+// resyncServices queues every service for reconciliation.
+func (r *RuntimeConfigReconciler) resyncServices(ctx context.Context) error {
+	var list corev1.ServiceList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		select {
+		case r.resync <- event.GenericEvent{Object: &list.Items[i]}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
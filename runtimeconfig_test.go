@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestRuntimeConfigTTLResyncsServices(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "runtime"},
+		Data:       map[string]string{ttlConfigMapKey: "45"},
+	}
+	web, db := testService("web", "10.0.0.1"), testService("db", "10.0.0.2")
+	resync := make(chan event.GenericEvent, 2)
+	var ttl atomic.Int64
+	rc := &RuntimeConfigReconciler{
+		Reader:    fake.NewClientBuilder().WithObjects(cm, web, db).Build(),
+		ConfigMap: types.NamespacedName{Namespace: "kube-system", Name: "runtime"},
+		Defaults:  RuntimeDefaults{TTL: 300},
+		pause:     NewPausableDNS(newFakeDNSClient(), false),
+		ttl:       &ttl,
+		filter:    &atomic.Pointer[ServiceFilter]{},
+		resync:    resync,
+	}
+	if _, err := rc.Reconcile(context.Background(), reconcile.Request{NamespacedName: rc.ConfigMap}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ttl.Load(); got != 45 {
+		t.Errorf("ttl override = %d, want 45 from the configmap", got)
+	}
+	var resynced []string
+	for len(resync) > 0 {
+		resynced = append(resynced, (<-resync).Object.GetName())
+	}
+	slices.Sort(resynced)
+	if want := []string{"db", "web"}; !slices.Equal(resynced, want) {
+		t.Errorf("resynced services %v, want %v", resynced, want)
+	}
+
+	// an unchanged configmap doesn't resync again.
+	if _, err := rc.Reconcile(context.Background(), reconcile.Request{NamespacedName: rc.ConfigMap}); err != nil {
+		t.Fatal(err)
+	}
+	if len(resync) > 0 {
+		t.Error("unchanged configmap resynced the services again")
+	}
+
+	// the hot reloaded ttl reaches the records the resync writes.
+	zone, sets := newTestAzureDNSConfig(t, WithTTLOverride(&ttl))
+	if _, err := zone.UpsertDNSRecords(context.Background(), "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := to.Int64(sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")].Properties.TTL); got != 45 {
+		t.Errorf("record TTL = %d, want 45", got)
+	}
+}
@@ -1,13 +1,34 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
 
 	// Core Kubernetes types
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 
 	// Kubebuilder/controller-runtime imports
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -17,65 +38,1151 @@ import (
 
 const finalizer = "dns.azure.com"
 
+// errReconcilePanic wraps a panic recovered while reconciling a service.
+var errReconcilePanic = errors.New("reconcile panicked")
+
 type dnsClient interface {
-	UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string) error
+	// UpsertDNSRecords makes ipList the A and AAAA records at dnsName. ttl 0 uses the zone's default.
+	// changed counts the record sets written or deleted, 0 when they already held ipList or the write was queued.
+	UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (changed int, err error)
 	DeleteDNSRecords(ctx context.Context, dnsName string) error
+	// BatchDeleteDNSRecords deletes the records for many names at once.
+	BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error
+	// RetainDNSRecords tombstones the records for a name instead of deleting them, they are never purged.
+	RetainDNSRecords(ctx context.Context, dnsName string) error
+	// UpsertExtraRecords makes records the dns.azure.com/records record sets at dnsName, nil removes them.
+	UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error
+	// UpsertPTRRecords points the reverse lookup of every ip at target, an FQDN. A no-op without a reverse zone.
+	UpsertPTRRecords(ctx context.Context, ips []string, target string) error
+	DeletePTRRecords(ctx context.Context, ips []string) error
+	// UpsertCNAMERecord makes target the CNAME at dnsName in place of its A and AAAA records, "" removes it.
+	UpsertCNAMERecord(ctx context.Context, dnsName, target string, ttl int64) error
 }
 
 type ServiceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	dns    dnsClient
+	index  *ServiceIndex                 // optional, nil when the services index is disabled
+	filter atomic.Pointer[ServiceFilter] // nil manages every service
+	zones  *ZoneRouter                   // optional, nil writes every service to the -zoneName zones
+
+	notifier *Notifier     // optional, nil when -notify-webhook isn't set
+	names    *NameRegistry // optional, nil trusts generated names to be unique
+	health   *Heartbeat    // optional, nil when -heartbeat-interval is 0
+	recorder record.EventRecorder
+	shard    Shard         // zero value reconciles every service
+	canary   *Canary       // optional, nil when -canary-selector isn't set
+	backoff  *AzureBackoff // optional, nil leaves azure errors to the controller's rate limiter
+	failures *EventLimiter // optional, nil emits a DNSUpsertFailed event for every failed reconcile
+	state    *ReconcilerState
+	// DeleteBatchThreshold is how many services in one namespace have to be deleting at once
+	// before their records are deleted as a batch. 0 disables batching.
+	DeleteBatchThreshold int
+	// PublishAPIServerService publishes default/kubernetes. Off by default so a bad record
+	// can't redirect in cluster clients away from the control plane.
+	PublishAPIServerService bool
+	// PublishExternalIPs publishes spec.externalIPs under <service>.<namespace>.external.
+	PublishExternalIPs bool
+	// DeleteProtectedNamespaces only tombstone records of deleted services, without ever purging them,
+	// unless the service was annotated dns.azure.com/allow-delete=true.
+	DeleteProtectedNamespaces map[string]bool
+	// SkipDeletes drops finalizers without deleting anything in azure, for identities that can't
+	// delete and zones cleaned up by something else.
+	SkipDeletes bool
+	// PublishMode picks the addresses LoadBalancer services publish, see serviceAddresses. Empty means external.
+	PublishMode string
+	// PublicZones allows the record types only public zones hold in the dns.azure.com/records annotation.
+	PublicZones bool
+	// PTRDomain is the zone PTR records for cluster IPs of services published to the -zoneName zones point
+	// into, the first of them. Services routed to another zone point into it. Empty when there is no -reverseZone.
+	PTRDomain string
+	// Zones are the zones every record is written to, only used to log FQDNs.
+	Zones []string
+	// MaxNamesPerService caps how many record names one service can publish, 0 for no limit.
+	MaxNamesPerService int
+	// StabilizationDelay is how old a service has to be before its records are first published.
+	StabilizationDelay time.Duration
+	// ResyncPeriod re-reconciles every published service this often, plus up to ResyncJitter, 0 disables.
+	ResyncPeriod time.Duration
+	ResyncJitter time.Duration
+	// IPv6Label, when set, moves AAAA records to <service>.<label>.<namespace>.svc, leaving only A records at the usual name.
+	IPv6Label string
+	// RecordSuffix follows <service>.<namespace> in record names, see -record-suffix. Empty leaves the two labels.
+	RecordSuffix string
+	// CriticalityTTLs maps dns.azure.com/criticality tiers to TTLs.
+	CriticalityTTLs map[string]int64
+	// Selector limits the services managed to those whose labels match, nil manages every service.
+	Selector labels.Selector
+}
+
+// isAPIServerService reports whether svc is the default/kubernetes service fronting the API server.
+func isAPIServerService(svc *corev1.Service) bool {
+	return svc.Namespace == metav1.NamespaceDefault && svc.Name == "kubernetes"
 }
 
 // Reconcile handles changes to Services or Pods
-func (r *ServiceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+	ctx = withRecordSource(ctx, "service", req.NamespacedName)
+	if !r.shard.owns(req.NamespacedName) {
+		return reconcile.Result{}, nil
+	}
+	defer func() {
+		result, err = r.backoffAzureErrors(req.NamespacedName, result, err)
+	}()
+
 	// Requeue interval if we want to re-check things periodically
 	var svc corev1.Service
-	err := r.Get(ctx, req.NamespacedName, &svc)
-	if err != nil {
-		return reconcile.Result{}, client.IgnoreNotFound(err)
+	if err := r.Get(ctx, req.NamespacedName, &svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			// normal after a delete, a stale event can still queue the service once its finalizer is gone.
+			goneServices.Inc()
+			debugf("Service %s is gone, nothing to do", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
 	}
 
-	// Not ding headless services yet.
+	ev := ReconcileEvent{Service: req.NamespacedName.String(), Result: resultSkipped}
+	defer func() {
+		// a service shaped in a way nothing here expects shouldn't take the controller down, it is retried
+		// with backoff like any other error in case whatever made it odd gets fixed.
+		if p := recover(); p != nil {
+			reconcilePanics.Inc()
+			log.Printf("Recovered from panic reconciling service %s: %v\n%s", req.NamespacedName, p, debug.Stack())
+			err = fmt.Errorf("%w: %v", errReconcilePanic, p)
+		}
+		if err != nil {
+			ev.Result = resultError
+			ev.Error = err.Error()
+			if r.failures.allow(req.NamespacedName, err.Error()) {
+				r.recorder.Event(&svc, corev1.EventTypeWarning, "DNSUpsertFailed", err.Error())
+			}
+		} else {
+			r.failures.reset(req.NamespacedName)
+		}
+		r.notifier.Notify(ev)
+		reconcileResults.WithLabelValues(string(ev.Result)).Inc()
+		r.state.reconciled(ev.Service, err)
+		if err == nil {
+			r.health.succeeded()
+		}
+	}()
+
+	// headless services are HeadlessReconciler's, with -publish-headless.
 	if svc.Spec.ClusterIP == "None" {
-		// maybe send namespacedname on a channel to endpoint reconciler?
-		log.Printf("Ignoring Headless service %s/%s", svc.Namespace, svc.Name)
+		debugf("Ignoring Headless service %s/%s", svc.Namespace, svc.Name)
 		return reconcile.Result{}, nil
 	}
 
-	dnsName := fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace)
+	// dnsName is empty when another service already owns the name, we must not touch its records then.
+	// It is also empty for an invalid hostname annotation, only the names published before are cleaned up.
+	dnsName, nameErr := r.recordName(&svc)
+	if nameErr != nil && !errors.Is(nameErr, errNameCollision) && !errors.Is(nameErr, errInvalidHostname) {
+		return reconcile.Result{}, nameErr
+	}
 	svc = *svc.DeepCopy()
+	// records are removed from the zone they were written to, which may not be where they'd go now.
+	publishedZone := svc.Annotations[publishedZoneAnnotation]
+	known, err := r.zones.Known(ctx, publishedZone)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	release := r.release
+	if !known {
+		// e.g. its DNSZone was deleted, nothing can be removed from a zone that isn't configured.
+		log.Printf("Zone %s of %s/%s is no longer configured, leaving its records there", publishedZone, svc.Namespace, svc.Name)
+		release = r.forget
+	} else {
+		ctx = withZone(ctx, publishedZone)
+	}
 	if svc.DeletionTimestamp != nil {
 		if !controllerutil.ContainsFinalizer(&svc, finalizer) {
 			return reconcile.Result{}, nil
 		}
 
+		if known && r.DeleteBatchThreshold > 0 && !r.DeleteProtectedNamespaces[svc.Namespace] && !r.SkipDeletes {
+			deleting, err := r.deletingServices(ctx, svc.Namespace)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			// a batch goes to one zone, services published elsewhere are deleted on their own.
+			deleting = slices.DeleteFunc(deleting, func(s corev1.Service) bool {
+				return s.Annotations[publishedZoneAnnotation] != publishedZone
+			})
+			if len(deleting) >= r.DeleteBatchThreshold {
+				ev.Result = resultDeleted
+				return reconcile.Result{}, r.batchDelete(ctx, deleting)
+			}
+		}
+
 		log.Printf("Deleting Service %s/%s ...\n", svc.Namespace, svc.Name)
 		//send a message to headless to cleanup or do headless ourselves?
-		if err := r.dns.DeleteDNSRecords(ctx, dnsName); err != nil {
+		ev.Result = resultDeleted
+		return reconcile.Result{}, release(ctx, &svc, dnsName)
+	}
+
+	if reason := r.excluded(&svc); reason != "" {
+		if controllerutil.ContainsFinalizer(&svc, finalizer) {
+			log.Printf("Service %s/%s %s, removing its records", svc.Namespace, svc.Name, reason)
+			ev.Result = resultDeleted
+			return reconcile.Result{}, release(ctx, &svc, dnsName)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if isAPIServerService(&svc) && !r.PublishAPIServerService {
+		if controllerutil.ContainsFinalizer(&svc, finalizer) {
+			log.Printf("Removing records for %s/%s, -publish-kubernetes-service is off", svc.Namespace, svc.Name)
+			ev.Result = resultDeleted
+			return reconcile.Result{}, release(ctx, &svc, dnsName)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if filter := r.filter.Load(); filter != nil {
+		match, err := r.matchesFilter(ctx, filter, &svc)
+		if err != nil {
 			return reconcile.Result{}, err
 		}
-		controllerutil.RemoveFinalizer(&svc, finalizer) //other options instead for finalizers. Perioidic relist and garbage collect
-		if err := r.Update(ctx, &svc); err != nil {
+		if !match {
+			if !controllerutil.ContainsFinalizer(&svc, finalizer) {
+				return reconcile.Result{}, nil
+			}
+			log.Printf("Service %s/%s no longer matches -filter-expr, removing its records", svc.Namespace, svc.Name)
+			ev.Result = resultDeleted
+			return reconcile.Result{}, release(ctx, &svc, dnsName)
+		}
+	}
+
+	if errors.Is(nameErr, errInvalidHostname) {
+		// nothing to retry until the annotation is fixed, which queues the service again.
+		r.recorder.Event(&svc, corev1.EventTypeWarning, "InvalidHostname", nameErr.Error())
+		log.Printf("Refusing to publish %s/%s: %v", svc.Namespace, svc.Name, nameErr)
+		return reconcile.Result{}, nil
+	}
+	if nameErr != nil {
+		// retried with backoff in case the other service goes away.
+		return reconcile.Result{}, nameErr
+	}
+	zone, err := r.zones.Zone(ctx, &svc)
+	if err != nil {
+		r.recorder.Event(&svc, corev1.EventTypeWarning, "InvalidZone", err.Error())
+		log.Printf("Refusing to publish %s/%s: %v", svc.Namespace, svc.Name, err)
+		return reconcile.Result{}, nil
+	}
+	if zone != publishedZone && known && controllerutil.ContainsFinalizer(&svc, finalizer) {
+		log.Printf("Service %s/%s moved from zone %q to %q, removing its records from the old zone", svc.Namespace, svc.Name, publishedZone, zone)
+		if err := r.release(ctx, &svc, dnsName); err != nil {
 			return reconcile.Result{}, err
 		}
 	}
+	ctx = withZone(ctx, zone)
 
-	log.Printf("Reconciling Service %s/%s ...\n", svc.Namespace, svc.Name)
-	// In many real setups, you might prefer <service>.<namespace>.svc.myzone.com or something
-	// fully matching your cluster’s DNS. For demonstration, we do a direct subdomain.
+	// services we haven't published yet wait out the stabilization delay, one deleted before then never gets records.
+	if !controllerutil.ContainsFinalizer(&svc, finalizer) && r.StabilizationDelay > 0 {
+		if wait := r.StabilizationDelay - time.Since(svc.CreationTimestamp.Time); wait > 0 {
+			log.Printf("Service %s/%s is new, publishing in %s", svc.Namespace, svc.Name, wait.Round(time.Second))
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+	}
 
-	controllerutil.AddFinalizer(&svc, finalizer) //other options instead for finalizers. Perioidic relist and garbage collect
-	if err := r.Update(ctx, &svc); err != nil {
+	log.Printf("Reconciling Service %s/%s ...\n", svc.Namespace, svc.Name)
+	//other options instead for finalizers. Perioidic relist and garbage collect
+	if err := r.updateFinalizer(ctx, &svc, controllerutil.AddFinalizer); err != nil {
 		return reconcile.Result{}, err
 	}
+	// like the finalizer the name and zone are recorded before writing, so records under a previous hostname are found later.
+	if zone != publishedZone {
+		if err := r.patchPublishedZone(ctx, &svc, zone); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	published := publishedNames(&svc)
+	if !slices.Contains(published, dnsName) {
+		if err := r.patchPublishedNames(ctx, &svc, append(published, dnsName)); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 
+	// hand built objects or newer API shapes are published as far as they make sense, the rest is skipped.
+	for _, problem := range serviceShapeProblems(&svc) {
+		log.Printf("Warning: unexpected service shape service=%s/%s problem=%q", svc.Namespace, svc.Name, problem)
+		r.recorder.Event(&svc, corev1.EventTypeWarning, "UnexpectedServiceShape", problem)
+	}
 	// Upsert A/AAAA record sets in Azure
-	if err := r.dns.UpsertDNSRecords(ctx, dnsName, svc.Spec.ClusterIPs); err != nil {
+	ips, cname, pending := serviceAddresses(&svc, r.PublishMode)
+	ttl := r.recordTTL(&svc)
+	records := map[string][]string{dnsName: ips}
+	if r.IPv6Label != "" {
+		// the v6 name is always upserted, an empty list removes AAAA records left from a dropped family.
+		v4, v6 := splitIPFamilies(ips)
+		records[dnsName] = v4
+		records[ipv6DNSName(dnsName, r.IPv6Label)] = v6
+	}
+	if r.PublishExternalIPs {
+		// always upserted, an empty list removes records left from externalIPs that were dropped.
+		records[externalDNSName(&svc)] = svc.Spec.ExternalIPs
+	}
+	r.limitNames(&svc, dnsName, records)
+	disabled := r.disabledRecordTypes(&svc)
+	if len(disabled) > 0 {
+		// upserts are authoritative so records of a type disabled after they were published are removed.
+		for name, values := range records {
+			records[name] = withoutDisabledFamilies(values, disabled)
+		}
+	}
+	for name, values := range records {
+		if name == dnsName && cname != "" && disabled["CNAME"] {
+			if err := r.dns.UpsertCNAMERecord(ctx, name, "", 0); err != nil {
+				return reconcile.Result{}, err
+			}
+			continue
+		}
+		if name == dnsName && cname != "" {
+			if ok, err := r.upsertCNAME(ctx, &svc, name, cname, ttl); !ok {
+				return reconcile.Result{}, err
+			}
+			log.Printf("Published %s for %s/%s as a CNAME to %s", name, svc.Namespace, svc.Name, cname)
+			continue
+		}
+		if ok, err := r.upsert(ctx, &svc, name, values, ttl); !ok {
+			return reconcile.Result{}, err
+		}
+	}
+	if err := r.publishExtraRecords(ctx, &svc, dnsName, disabled); err != nil {
 		return reconcile.Result{}, err
 	}
+	if r.PTRDomain != "" && disabled["PTR"] {
+		if err := r.dns.DeletePTRRecords(ctx, clusterIPs(&svc)); err != nil {
+			return reconcile.Result{}, err
+		}
+	} else if r.PTRDomain != "" {
+		if err := r.dns.UpsertPTRRecords(ctx, clusterIPs(&svc), ptrTarget(dnsName, cmp.Or(zone, r.PTRDomain))); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if len(published) > 0 && !slices.Equal(published, []string{dnsName}) {
+		if err := r.removeStaleNames(ctx, &svc, dnsName); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.patchPublishedNames(ctx, &svc, []string{dnsName}); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	r.index.Add(dnsName)
+	ev.Result = resultUpdated
+	ev.Records = records
+
+	described := r.describeRecords(records, zone)
+	log.Printf("Successfully updated DNS for %s Service %s/%s: %s", svc.Spec.Type, svc.Namespace, svc.Name, described)
+	r.recorder.Event(&svc, corev1.EventTypeNormal, "DNSRecordUpdated", "Published "+described)
+	if pending {
+		// the status update normally queues it too, this covers a missed or filtered event.
+		log.Printf("LoadBalancer Service %s/%s has no ingress yet, checking again in %s", svc.Namespace, svc.Name, loadBalancerPendingRequeue)
+		return reconcile.Result{RequeueAfter: loadBalancerPendingRequeue}, nil
+	}
+	return reconcile.Result{RequeueAfter: r.resyncAfter()}, nil
+}
 
-	log.Printf("Successfully updated DNS for headless Service %s/%s -> %v", svc.Namespace, svc.Name, svc.Spec.ClusterIPs)
-	return reconcile.Result{}, nil
+// EventLimiter keeps a service failing the same way on every retry from flooding its events.
+// The same message for a service is emitted at most once per Interval.
+type EventLimiter struct {
+	Interval time.Duration
+
+	mu   sync.Mutex
+	last map[types.NamespacedName]limitedEvent
+}
+
+type limitedEvent struct {
+	message string
+	time    time.Time
+}
+
+func NewEventLimiter(interval time.Duration) *EventLimiter {
+	return &EventLimiter{Interval: interval, last: map[types.NamespacedName]limitedEvent{}}
+}
+
+// allow reports whether message should be emitted for key, recording it if so.
+func (l *EventLimiter) allow(key types.NamespacedName, message string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[key]; ok && last.message == message && time.Since(last.time) < l.Interval {
+		return false
+	}
+	l.last[key] = limitedEvent{message: message, time: time.Now()}
+	return true
+}
+
+// reset forgets key once it reconciled cleanly, so its next failure is emitted straight away.
+func (l *EventLimiter) reset(key types.NamespacedName) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.last, key)
+}
+
+// backoffAzureErrors turns azure errors into a requeue with per service exponential backoff that honors
+// Retry-After. Errors retrying won't fix, like a bad request or forbidden, are requeued after the longest
+// delay instead of failing fast, they need the service or the identity's permissions fixed first.
+func (r *ServiceReconciler) backoffAzureErrors(key types.NamespacedName, result reconcile.Result, err error) (reconcile.Result, error) {
+	if r.backoff == nil {
+		return result, err
+	}
+	if err == nil {
+		r.backoff.reset(key)
+		return result, nil
+	}
+	var partial *PartialUpsertError
+	if errors.As(err, &partial) {
+		log.Printf("Records for %s are half updated, %v still to write", key, partial.Failed())
+	}
+	after, retryable, ok := retryHint(err)
+	if !ok {
+		return result, err
+	}
+	if !retryable {
+		log.Printf("Azure rejected the change for %s, retrying in %s: %v", key, r.backoff.Max, err)
+		return reconcile.Result{RequeueAfter: r.backoff.Max}, nil
+	}
+	delay := r.backoff.next(key, after)
+	log.Printf("Azure error for %s, retrying in %s: %v", key, delay, err)
+	return reconcile.Result{RequeueAfter: delay}, nil
+}
+
+// describeRecords lists the FQDN, record types and addresses of every record name, e.g.
+// "foo.default.svc.cluster.local A,AAAA [10.0.0.1 fd00::1]". A name without addresses has its records removed.
+// zone is the one zone they were written to, empty for all of Zones.
+func (r *ServiceReconciler) describeRecords(records map[string][]string, zone string) string {
+	zones := r.Zones
+	if zone != "" {
+		zones = []string{zone}
+	}
+	var out []string
+	for _, name := range slices.Sorted(maps.Keys(records)) {
+		ips := records[name]
+		var types []string
+		v4, v6 := splitIPFamilies(ips)
+		if len(v4) > 0 {
+			types = append(types, string(dns.RecordTypeA))
+		}
+		if len(v6) > 0 {
+			types = append(types, string(dns.RecordTypeAAAA))
+		}
+		if len(types) == 0 {
+			types = append(types, "none")
+		}
+		fqdns := []string{name}
+		if len(zones) > 0 {
+			fqdns = nil
+			for _, zone := range zones {
+				fqdns = append(fqdns, name+"."+zone)
+			}
+		}
+		out = append(out, fmt.Sprintf("%s %s %v", strings.Join(fqdns, ","), strings.Join(types, ","), ips))
+	}
+	return strings.Join(out, "; ")
+}
+
+// resyncAfter is when a published service is next reconciled to correct drift, 0 for never.
+// Each service gets its own random jitter so they don't all hit azure at the same time.
+func (r *ServiceReconciler) resyncAfter() time.Duration {
+	if r.ResyncPeriod <= 0 {
+		return 0
+	}
+	if r.ResyncJitter <= 0 {
+		return r.ResyncPeriod
+	}
+	return r.ResyncPeriod + rand.N(r.ResyncJitter)
+}
+
+// limitNames drops names from records beyond MaxNamesPerService. The service's own name is always kept,
+// then the rest in sorted order so the same names survive every reconcile.
+func (r *ServiceReconciler) limitNames(svc *corev1.Service, dnsName string, records map[string][]string) {
+	if r.MaxNamesPerService <= 0 || len(records) <= r.MaxNamesPerService {
+		return
+	}
+	var others []string
+	for name := range records {
+		if name != dnsName {
+			others = append(others, name)
+		}
+	}
+	slices.Sort(others)
+	dropped := others[r.MaxNamesPerService-1:]
+	for _, name := range dropped {
+		delete(records, name)
+	}
+	namesOverLimit.Add(float64(len(dropped)))
+	msg := fmt.Sprintf("service wants %d record names, over the limit of %d, not publishing %v", len(records)+len(dropped), r.MaxNamesPerService, dropped)
+	r.recorder.Event(svc, corev1.EventTypeWarning, "TooManyNames", msg)
+	log.Printf("Warning: %s/%s %s", svc.Namespace, svc.Name, msg)
+}
+
+// publishExtraRecords writes the records from svc's dns.azure.com/records annotation, removing them
+// once the annotation is gone. An invalid annotation is reported and leaves the records as they are.
+func (r *ServiceReconciler) publishExtraRecords(ctx context.Context, svc *corev1.Service, dnsName string, disabled map[string]bool) error {
+	var extras []ExtraRecord
+	if v, ok := svc.Annotations[recordsAnnotation]; ok {
+		var err error
+		extras, err = parseExtraRecords(v, r.PublicZones)
+		if err != nil {
+			msg := fmt.Sprintf("ignoring invalid %s: %v", recordsAnnotation, err)
+			r.recorder.Event(svc, corev1.EventTypeWarning, "InvalidRecords", msg)
+			log.Printf("Warning: %s/%s %s", svc.Namespace, svc.Name, msg)
+			return nil
+		}
+	}
+	// upserts are authoritative per type, so a disabled type's records are removed.
+	extras = slices.DeleteFunc(extras, func(e ExtraRecord) bool { return disabled[strings.ToUpper(e.Type)] })
+	return r.dns.UpsertExtraRecords(ctx, dnsName, extras)
+}
+
+// upsert publishes ips at name. A name outside -allowed-names, owned by another controller or at a
+// zone apex -apex-policy rejects is reported on svc and not retried, that won't help until the allowlist, the owner or the service changes.
+// Another owner's record set of a conflicting type at name is reported and retried.
+// ok is false when nothing was published.
+func (r *ServiceReconciler) upsert(ctx context.Context, svc *corev1.Service, name string, ips []string, ttl int64) (ok bool, err error) {
+	changed, err := r.dns.UpsertDNSRecords(ctx, name, ips, ttl)
+	if changed > 0 {
+		log.Printf("Changed %d record sets at %s for %s/%s", changed, name, svc.Namespace, svc.Name)
+	} else if err == nil {
+		debugf("Records at %s for %s/%s are unchanged", name, svc.Namespace, svc.Name)
+	}
+	return r.handleUpsert(svc, name, ips, err)
+}
+
+// upsertCNAME publishes a CNAME to target at name, see upsert.
+func (r *ServiceReconciler) upsertCNAME(ctx context.Context, svc *corev1.Service, name, target string, ttl int64) (ok bool, err error) {
+	return r.handleUpsert(svc, name, []string{target}, r.dns.UpsertCNAMERecord(ctx, name, target, ttl))
+}
+
+func (r *ServiceReconciler) handleUpsert(svc *corev1.Service, name string, values []string, err error) (ok bool, _ error) {
+	if errors.Is(err, errNameNotAllowed) {
+		r.recorder.Event(svc, corev1.EventTypeWarning, "NameNotAllowed", err.Error())
+		log.Printf("Refusing to publish %s/%s: %v", svc.Namespace, svc.Name, err)
+		return false, nil
+	}
+	if errors.Is(err, errConflictingRecord) {
+		// retried, the other owner may remove it when it moves on from the name.
+		r.recorder.Event(svc, corev1.EventTypeWarning, "ConflictingRecord", err.Error())
+		log.Printf("Can't publish %s/%s yet: %v", svc.Namespace, svc.Name, err)
+		return false, err
+	}
+	if errors.Is(err, errOwnedByOther) {
+		r.recorder.Event(svc, corev1.EventTypeWarning, "OwnedByOtherController", err.Error())
+		log.Printf("Refusing to publish %s/%s: %v", svc.Namespace, svc.Name, err)
+		return false, nil
+	}
+	if errors.Is(err, errApexName) {
+		r.recorder.Event(svc, corev1.EventTypeWarning, "ApexName", err.Error())
+		log.Printf("Refusing to publish %s/%s: %v", svc.Namespace, svc.Name, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.state.published(name, values)
+	return true, nil
+}
+
+// removeCNAME deletes a CNAME published for an ExternalName service or a LoadBalancer whose ingress was
+// a hostname. Other services never get one so no call is made for them.
+func (r *ServiceReconciler) removeCNAME(ctx context.Context, svc *corev1.Service, name string) error {
+	lb := svc.Spec.Type == corev1.ServiceTypeLoadBalancer && r.PublishMode != publishClusterIP
+	if !lb && svc.Spec.Type != corev1.ServiceTypeExternalName {
+		return nil
+	}
+	return r.dns.UpsertCNAMERecord(ctx, name, "", 0)
+}
+
+// release deletes a service's records and then drops our finalizer from it.
+// An empty dnsName means the service has no current name, only names it published before are deleted.
+// With SkipDeletes the records are left in azure and only the finalizer is dropped.
+func (r *ServiceReconciler) release(ctx context.Context, svc *corev1.Service, dnsName string) error {
+	if r.SkipDeletes {
+		if dnsName != "" || len(publishedNames(svc)) > 0 {
+			log.Printf("Not deleting records for %s/%s, -allow-delete is off", svc.Namespace, svc.Name)
+			r.recorder.Event(svc, corev1.EventTypeNormal, recordsNotDeletedReason, recordsNotDeletedMessage)
+		}
+		return r.forget(ctx, svc, dnsName)
+	}
+	if err := r.removeStaleNames(ctx, svc, dnsName); err != nil {
+		return err
+	}
+	if dnsName != "" {
+		if err := r.removeRecords(ctx, svc, dnsName); err != nil {
+			return err
+		}
+		if err := r.removeCNAME(ctx, svc, dnsName); err != nil {
+			return err
+		}
+		if err := r.dns.UpsertExtraRecords(ctx, dnsName, nil); err != nil {
+			return err
+		}
+		if r.PTRDomain != "" {
+			if err := r.dns.DeletePTRRecords(ctx, clusterIPs(svc)); err != nil {
+				return err
+			}
+		}
+		r.index.Remove(dnsName)
+		r.state.removed(dnsName)
+		r.names.release(client.ObjectKeyFromObject(svc))
+	}
+	if dnsName != "" && r.IPv6Label != "" {
+		v6Name := ipv6DNSName(dnsName, r.IPv6Label)
+		if err := r.removeRecords(ctx, svc, v6Name); err != nil {
+			return err
+		}
+		r.state.removed(v6Name)
+	}
+	if r.PublishExternalIPs {
+		extName := externalDNSName(svc)
+		if _, err := r.dns.UpsertDNSRecords(ctx, extName, nil, 0); err != nil {
+			return err
+		}
+		r.state.removed(extName)
+	}
+	return r.updateFinalizer(ctx, svc, controllerutil.RemoveFinalizer)
+}
+
+// The event for records left in azure when -allow-delete is off.
+const (
+	recordsNotDeletedReason  = "RecordsNotDeleted"
+	recordsNotDeletedMessage = "Records were left in azure for external cleanup, -allow-delete is off"
+)
+
+// forget drops a service's finalizer and what is tracked about its records without touching azure, for
+// records in a zone that is no longer configured or left for external cleanup by -allow-delete=false.
+func (r *ServiceReconciler) forget(ctx context.Context, svc *corev1.Service, dnsName string) error {
+	for _, name := range append(publishedNames(svc), dnsName) {
+		r.index.Remove(name)
+		r.state.removed(name)
+	}
+	r.names.release(client.ObjectKeyFromObject(svc))
+	return r.updateFinalizer(ctx, svc, controllerutil.RemoveFinalizer)
+}
+
+// removeStaleNames deletes the records of every name svc published before other than keep,
+// left behind when its dns.azure.com/hostname annotation changed.
+func (r *ServiceReconciler) removeStaleNames(ctx context.Context, svc *corev1.Service, keep string) error {
+	for _, name := range publishedNames(svc) {
+		if name == keep {
+			continue
+		}
+		log.Printf("Removing records for %s/%s under its previous name %s", svc.Namespace, svc.Name, name)
+		if err := r.removeRecords(ctx, svc, name); err != nil {
+			return err
+		}
+		if err := r.removeCNAME(ctx, svc, name); err != nil {
+			return err
+		}
+		if err := r.dns.UpsertExtraRecords(ctx, name, nil); err != nil {
+			return err
+		}
+		r.index.Remove(name)
+		r.state.removed(name)
+		if r.IPv6Label != "" {
+			v6Name := ipv6DNSName(name, r.IPv6Label)
+			if err := r.removeRecords(ctx, svc, v6Name); err != nil {
+				return err
+			}
+			r.state.removed(v6Name)
+		}
+	}
+	return nil
+}
+
+// patchPublishedZone records the zone svc's records are written to.
+func (r *ServiceReconciler) patchPublishedZone(ctx context.Context, svc *corev1.Service, zone string) error {
+	base := svc.DeepCopy()
+	if zone == "" {
+		delete(svc.Annotations, publishedZoneAnnotation)
+	} else {
+		if svc.Annotations == nil {
+			svc.Annotations = map[string]string{}
+		}
+		svc.Annotations[publishedZoneAnnotation] = zone
+	}
+	return r.Patch(ctx, svc, client.MergeFrom(base))
+}
+
+// patchPublishedNames records the names svc's records are published under.
+func (r *ServiceReconciler) patchPublishedNames(ctx context.Context, svc *corev1.Service, names []string) error {
+	base := svc.DeepCopy()
+	setPublishedNames(svc, names)
+	return r.Patch(ctx, svc, client.MergeFrom(base))
+}
+
+// allowDeleteAnnotation lets a service in a delete protected namespace have its records deleted outright.
+const allowDeleteAnnotation = annotationPrefix + "allow-delete"
+
+// removeRecords deletes the records at dnsName, or only retains them as tombstones for a
+// service in a delete protected namespace that hasn't opted in with dns.azure.com/allow-delete.
+func (r *ServiceReconciler) removeRecords(ctx context.Context, svc *corev1.Service, dnsName string) error {
+	return removeRecords(ctx, r.dns, r.DeleteProtectedNamespaces, svc, dnsName)
+}
+
+// removeRecords is ServiceReconciler.removeRecords for any reconciler of services, protected being
+// the -delete-protected-namespaces.
+func removeRecords(ctx context.Context, d dnsClient, protected map[string]bool, svc *corev1.Service, dnsName string) error {
+	if protected[svc.Namespace] && svc.Annotations[allowDeleteAnnotation] != "true" {
+		log.Printf("Namespace %s is delete protected, retaining tombstoned records for %s", svc.Namespace, dnsName)
+		return d.RetainDNSRecords(ctx, dnsName)
+	}
+	return d.DeleteDNSRecords(ctx, dnsName)
+}
+
+// updateFinalizer applies change (controllerutil.AddFinalizer or RemoveFinalizer) to svc and patches it,
+// re-reading svc and retrying on conflict. Nothing is sent when the finalizer is already as wanted, and it is
+// never added back to a service that started deleting in the meantime.
+func (r *ServiceReconciler) updateFinalizer(ctx context.Context, svc *corev1.Service, change func(client.Object, string) bool) error {
+	return updateFinalizer(ctx, r.Client, svc, change)
+}
+
+// updateFinalizer is ServiceReconciler.updateFinalizer for any object the controller puts its finalizer
+// on: services, AggregateRecords and HTTPRoutes.
+func updateFinalizer(ctx context.Context, c client.Client, obj client.Object, change func(client.Object, string) bool) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if !first {
+			finalizerConflicts.Inc()
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+		}
+		first = false
+		base := obj.DeepCopyObject().(client.Object)
+		if !change(obj, finalizer) {
+			return nil
+		}
+		if obj.GetDeletionTimestamp() != nil && controllerutil.ContainsFinalizer(obj, finalizer) {
+			return nil // only ever removed once deleting
+		}
+		// the optimistic lock keeps the merge patch from dropping finalizers others added since obj was read.
+		return c.Patch(ctx, obj, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
+	})
+}
+
+const excludeAnnotation = annotationPrefix + "exclude"
+
+// excluded says why svc is opted out of DNS, either by dns.azure.com/exclude=true or by no longer
+// matching -selector, empty when it is managed. Records published before are removed.
+func (r *ServiceReconciler) excluded(svc *corev1.Service) string {
+	if svc.Annotations[excludeAnnotation] == "true" {
+		return "is annotated " + excludeAnnotation + "=true"
+	}
+	if r.Selector != nil && !r.Selector.Matches(labels.Set(svc.Labels)) {
+		return "no longer matches -selector"
+	}
+	return ""
+}
+
+// optOut is why svc isn't managed, the exclude annotation, -selector or -filter-expr, empty when it is.
+func (r *ServiceReconciler) optOut(ctx context.Context, svc *corev1.Service) (string, error) {
+	if reason := r.excluded(svc); reason != "" {
+		return reason, nil
+	}
+	if filter := r.filter.Load(); filter != nil {
+		match, err := r.matchesFilter(ctx, filter, svc)
+		if err != nil || match {
+			return "", err
+		}
+		return "no longer matches -filter-expr", nil
+	}
+	return "", nil
+}
+
+// matchesFilter evaluates filter against svc and its namespace's labels.
+func (r *ServiceReconciler) matchesFilter(ctx context.Context, filter *ServiceFilter, svc *corev1.Service) (bool, error) {
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: svc.Namespace}, &ns); err != nil {
+		return false, err
+	}
+	return filter.Matches(svc, ns.Labels)
+}
+
+// deletingServices lists the services in namespace that are being deleted and still need their records removed.
+func (r *ServiceReconciler) deletingServices(ctx context.Context, namespace string) ([]corev1.Service, error) {
+	var list corev1.ServiceList
+	if err := r.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var deleting []corev1.Service
+	for _, svc := range list.Items {
+		if svc.DeletionTimestamp != nil && svc.Spec.ClusterIP != "None" && controllerutil.ContainsFinalizer(&svc, finalizer) &&
+			r.shard.owns(client.ObjectKeyFromObject(&svc)) {
+			deleting = append(deleting, svc)
+		}
+	}
+	return deleting, nil
+}
+
+// batchDelete removes the records of many deleting services with one batch call, then releases their finalizers.
+// Reconciles for the other services in the batch then find no finalizer and do nothing.
+func (r *ServiceReconciler) batchDelete(ctx context.Context, services []corev1.Service) error {
+	names := make([]string, len(services))
+	// every name of each service, its current one and any it published before, like release removes.
+	serviceNames := make([][]string, len(services))
+	var owned []string
+	for i := range services {
+		name, err := r.recordName(&services[i])
+		if err != nil && !errors.Is(err, errNameCollision) && !errors.Is(err, errInvalidHostname) {
+			return err
+		}
+		names[i] = name
+		if name != "" {
+			serviceNames[i] = append(serviceNames[i], name)
+		}
+		for _, prev := range publishedNames(&services[i]) {
+			if prev == name {
+				continue
+			}
+			serviceNames[i] = append(serviceNames[i], prev)
+			if r.IPv6Label != "" {
+				owned = append(owned, ipv6DNSName(prev, r.IPv6Label))
+			}
+		}
+		owned = append(owned, serviceNames[i]...)
+		if name != "" && r.IPv6Label != "" {
+			owned = append(owned, ipv6DNSName(name, r.IPv6Label))
+		}
+		if r.PublishExternalIPs {
+			owned = append(owned, externalDNSName(&services[i]))
+		}
+	}
+	log.Printf("Batch deleting records for %d services in namespace %s", len(services), services[0].Namespace)
+	if err := r.dns.BatchDeleteDNSRecords(ctx, owned); err != nil {
+		return err
+	}
+	for i := range services {
+		for _, name := range serviceNames[i] {
+			if err := r.removeCNAME(ctx, &services[i], name); err != nil {
+				return err
+			}
+			if err := r.dns.UpsertExtraRecords(ctx, name, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if r.PTRDomain != "" {
+		var ips []string
+		for i := range services {
+			if names[i] != "" {
+				ips = append(ips, clusterIPs(&services[i])...)
+			}
+		}
+		if err := r.dns.DeletePTRRecords(ctx, ips); err != nil {
+			return err
+		}
+	}
+	for i := range services {
+		svc := services[i].DeepCopy()
+		for _, name := range serviceNames[i] {
+			r.index.Remove(name)
+			r.state.removed(name)
+		}
+		if names[i] != "" {
+			r.names.release(client.ObjectKeyFromObject(svc))
+		}
+		if err := r.updateFinalizer(ctx, svc, controllerutil.RemoveFinalizer); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordName is the record name svc publishes, after collision handling when -name-collision is set.
+func (r *ServiceReconciler) recordName(svc *corev1.Service) (string, error) {
+	name, err := serviceRecordName(svc, r.RecordSuffix)
+	if err != nil {
+		return "", err
+	}
+	if r.names == nil {
+		return name, nil
+	}
+	return r.names.Claim(name, client.ObjectKeyFromObject(svc))
+}
+
+// serviceDNSName is the record name for a service, <service>.<namespace>.<suffix>. It is relative to the zone
+// unless suffix ends in the zone name, relativeName strips it then.
+func serviceDNSName(svc *corev1.Service, suffix string) string {
+	if suffix == "" {
+		return svc.Name + "." + svc.Namespace
+	}
+	return fmt.Sprintf("%s.%s.%s", svc.Name, svc.Namespace, suffix)
+}
+
+// hostnameAnnotation replaces a service's record name, e.g. api.svc or a flat name, relative to the zone.
+const hostnameAnnotation = annotationPrefix + "hostname"
+
+var errInvalidHostname = errors.New("invalid " + hostnameAnnotation + " annotation")
+
+// serviceRecordName is serviceDNSName unless svc overrides it with the hostname annotation.
+func serviceRecordName(svc *corev1.Service, suffix string) (string, error) {
+	v, ok := svc.Annotations[hostnameAnnotation]
+	if !ok {
+		return serviceDNSName(svc, suffix), nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(v), "."))
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("%w %q: %s", errInvalidHostname, v, strings.Join(errs, ", "))
+	}
+	if reservedRecordName(name) {
+		return "", fmt.Errorf("%w %q: the name is reserved for the controller's own records", errInvalidHostname, v)
+	}
+	return name, nil
+}
+
+// reservedRecordName reports whether name is one of the controller's own TXT records, dns-version,
+// controller-health or a services-index part, which no service may publish at. A name starting with
+// one is reserved too, it may be qualified with the zone.
+func reservedRecordName(name string) bool {
+	first, _, _ := strings.Cut(name, ".")
+	if first == versionRecordName || first == heartbeatRecordName || first == indexRecordName {
+		return true
+	}
+	part, ok := strings.CutPrefix(first, indexRecordName+"-")
+	_, err := strconv.Atoi(part)
+	return ok && err == nil
+}
+
+// externalDNSName is where a service's spec.externalIPs are published, kept apart from its cluster IPs.
+func externalDNSName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s.%s.external", svc.Name, svc.Namespace)
+}
+
+// ipv6DNSName inserts label after the first label of dnsName, foo.ns.svc becomes foo.v6.ns.svc.
+func ipv6DNSName(dnsName, label string) string {
+	first, rest, _ := strings.Cut(dnsName, ".")
+	return first + "." + label + "." + rest
+}
+
+// splitIPFamilies splits ips into IPv4 and IPv6 addresses. IPv4-mapped IPv6 addresses like ::ffff:10.0.0.1
+// are IPv4 and come back as 10.0.0.1. Anything that doesn't parse as an IP, e.g. with a port or zone, is dropped.
+func splitIPFamilies(ips []string) (v4, v6 []string) {
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil:
+			v4 = append(v4, ip.To4().String())
+		default:
+			v6 = append(v6, s)
+		}
+	}
+	return v4, v6
+}
+
+// disableAnnotationPrefix followed by a record type, e.g. dns.azure.com/disable-aaaa: "true",
+// stops a service publishing records of that type and removes those already published.
+const disableAnnotationPrefix = annotationPrefix + "disable-"
+
+// disabledRecordTypes returns the record types svc turned off with disable annotations. Types the
+// controller never writes, e.g. SRV, are reported on svc and left out.
+func (r *ServiceReconciler) disabledRecordTypes(svc *corev1.Service) map[string]bool {
+	disabled := map[string]bool{}
+	for k, v := range svc.Annotations {
+		rt, ok := strings.CutPrefix(k, disableAnnotationPrefix)
+		if !ok || v != "true" {
+			continue
+		}
+		rt = strings.ToUpper(rt)
+		if !disableableRecordType(rt) {
+			msg := fmt.Sprintf("ignoring %s, %s records aren't published", k, rt)
+			r.recorder.Event(svc, corev1.EventTypeWarning, "UnsupportedRecordType", msg)
+			log.Printf("Warning: %s/%s %s", svc.Namespace, svc.Name, msg)
+			continue
+		}
+		disabled[rt] = true
+	}
+	return disabled
+}
+
+// disableableRecordType reports whether the controller writes records of type rt for services.
+func disableableRecordType(rt string) bool {
+	switch rt {
+	case "A", "AAAA", "CNAME", "PTR":
+		return true
+	}
+	return slices.ContainsFunc(extraRecordTypesFor(true), func(t dns.RecordType) bool { return string(t) == rt })
+}
+
+// withoutDisabledFamilies drops the addresses whose record type, A or AAAA, is disabled.
+func withoutDisabledFamilies(ips []string, disabled map[string]bool) []string {
+	v4, v6 := splitIPFamilies(ips)
+	var kept []string
+	if !disabled["A"] {
+		kept = append(kept, v4...)
+	}
+	if !disabled["AAAA"] {
+		kept = append(kept, v6...)
+	}
+	return kept
+}
+
+// Publish modes for -publish-mode, which addresses of a LoadBalancer service are published.
+const (
+	publishClusterIP = "cluster-ip"
+	publishExternal  = "external"
+	publishBoth      = "both"
+)
+
+func parsePublishMode(v string) (string, error) {
+	switch v {
+	case publishClusterIP, publishExternal, publishBoth:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown publish mode %q, must be %s, %s or %s", v, publishClusterIP, publishExternal, publishBoth)
+}
+
+// loadBalancerPendingRequeue is how soon a LoadBalancer service without ingress is looked at again.
+const loadBalancerPendingRequeue = 30 * time.Second
+
+// serviceIPs returns the addresses to publish for svc with the default publish mode.
+func serviceIPs(svc *corev1.Service) []string {
+	ips, _, _ := serviceAddresses(svc, publishExternal)
+	return ips
+}
+
+// serviceAddresses returns the addresses to publish for svc.
+// LoadBalancer services publish the ingress IPs the load balancer has actually assigned, instead of or
+// alongside their cluster IPs depending on mode, so IPs withdrawn from status are dropped on the next reconcile.
+// A load balancer with only a hostname ingress (e.g. some cloud LBs) has nothing to put in an A record,
+// cname is that hostname when there are no addresses at all. pending is true while it has no ingress yet.
+// ExternalName services have no addresses and publish spec.externalName as a CNAME.
+// The dns.azure.com/target-ips annotation overrides all of that when it holds valid IPs.
+func serviceAddresses(svc *corev1.Service, mode string) (ips []string, cname string, pending bool) {
+	if v, ok := svc.Annotations[targetIPsAnnotation]; ok {
+		ips, err := parseTargetIPs(v)
+		if err == nil {
+			return ips, "", false
+		}
+		log.Printf("Warning: ignoring %s on %s/%s: %v", targetIPsAnnotation, svc.Namespace, svc.Name, err)
+	}
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return nil, svc.Spec.ExternalName, false
+	}
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer || mode == publishClusterIP {
+		return clusterIPs(svc), "", false
+	}
+	var hostnames []string
+	if mode == publishBoth {
+		ips = clusterIPs(svc)
+	}
+	usable := 0
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		switch {
+		case ingress.IP != "" && net.ParseIP(ingress.IP) != nil:
+			ips = append(ips, ingress.IP)
+		case ingress.Hostname != "":
+			hostnames = append(hostnames, ingress.Hostname)
+		default:
+			// reported by serviceShapeProblems.
+			continue
+		}
+		usable++
+	}
+	// a name holds a single CNAME, and none next to addresses.
+	if len(ips) == 0 && len(hostnames) > 0 {
+		if len(hostnames) > 1 {
+			log.Printf("Warning: %s/%s has several ingress hostnames, publishing a CNAME to %s", svc.Namespace, svc.Name, hostnames[0])
+		}
+		cname = hostnames[0]
+	}
+	return ips, cname, usable == 0
+}
+
+// serviceShapeProblems describes the parts of svc that can't be published as they are, e.g. an ingress
+// entry without an IP or hostname, an ingress IP that doesn't parse or an ipFamilies value that isn't known.
+func serviceShapeProblems(svc *corev1.Service) []string {
+	var problems []string
+	for i, ingress := range svc.Status.LoadBalancer.Ingress {
+		switch {
+		case ingress.IP == "" && ingress.Hostname == "":
+			problems = append(problems, fmt.Sprintf("loadBalancer ingress %d has neither an IP nor a hostname", i))
+		case ingress.IP != "" && net.ParseIP(ingress.IP) == nil:
+			problems = append(problems, fmt.Sprintf("loadBalancer ingress %d IP %q is not an IP address", i, ingress.IP))
+		}
+	}
+	for _, f := range svc.Spec.IPFamilies {
+		if f != corev1.IPv4Protocol && f != corev1.IPv6Protocol {
+			problems = append(problems, fmt.Sprintf("unknown ipFamily %q", f))
+		}
+	}
+	return problems
+}
+
+// ptrTarget is the FQDN a PTR record points at for dnsName published to zone. A name that already ends in
+// the zone, e.g. from a -record-suffix ending in it, is published as is and so isn't qualified again.
+func ptrTarget(dnsName, zone string) string {
+	name := strings.TrimSuffix(dnsName, ".")
+	if strings.EqualFold(name, zone) || strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zone)) {
+		return name
+	}
+	return name + "." + zone
+}
+
+// clusterIPs returns svc's valid cluster IPs. The families published come from the IPs themselves,
+// spec.ipFamilies is only checked and a mismatch logged in case of malformed or newer service shapes.
+func clusterIPs(svc *corev1.Service) []string {
+	var ips []string
+	families := map[corev1.IPFamily]bool{}
+	all := svc.Spec.ClusterIPs
+	if len(all) == 0 && svc.Spec.ClusterIP != "" {
+		// objects from before dual stack, or built by hand, may only set clusterIP.
+		all = []string{svc.Spec.ClusterIP}
+	}
+	for _, s := range all {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			log.Printf("Warning: skipping invalid clusterIP %q on %s/%s", s, svc.Namespace, svc.Name)
+			continue
+		}
+		family := corev1.IPv6Protocol
+		if ip.To4() != nil {
+			family = corev1.IPv4Protocol
+		}
+		if families[family] {
+			log.Printf("Warning: %s/%s has more than one %s clusterIP", svc.Namespace, svc.Name, family)
+		}
+		families[family] = true
+		ips = append(ips, s)
+	}
+	mismatch := len(svc.Spec.IPFamilies) > 0 && len(svc.Spec.IPFamilies) != len(families)
+	for _, f := range svc.Spec.IPFamilies {
+		mismatch = mismatch || !families[f]
+	}
+	if mismatch {
+		log.Printf("Warning: %s/%s clusterIPs %v don't match ipFamilies %v, publishing the clusterIPs", svc.Namespace, svc.Name, svc.Spec.ClusterIPs, svc.Spec.IPFamilies)
+	}
+	return ips
+}
+
+// targetIPsAnnotation is a comma separated list of IPs published instead of the service's own.
+const targetIPsAnnotation = annotationPrefix + "target-ips"
+
+// parseTargetIPs validates a target-ips annotation value.
+func parseTargetIPs(v string) ([]string, error) {
+	var ips []string
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address", s)
+		}
+		ips = append(ips, ip.String())
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no IP addresses")
+	}
+	return ips, nil
 }
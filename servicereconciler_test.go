@@ -0,0 +1,892 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeDNSClient is an in memory zone. It keeps the records each call leaves behind and every call made.
+type fakeDNSClient struct {
+	mu      sync.Mutex
+	records map[string][]string        // A and AAAA values by name
+	cnames  map[string]string          // by name
+	extras  map[string][]ExtraRecord   // by name
+	ptrs    map[string]string          // target by ip
+	txt     map[string][]string        // by name
+	ttls    map[string]int64           // ttl of the last A/AAAA upsert by name
+	zones   map[string]map[string]bool // names written by zone, from withZone
+	calls   []string
+	err     error // returned by every call when set
+}
+
+func newFakeDNSClient() *fakeDNSClient {
+	return &fakeDNSClient{
+		records: map[string][]string{},
+		cnames:  map[string]string{},
+		extras:  map[string][]ExtraRecord{},
+		ptrs:    map[string]string{},
+		txt:     map[string][]string{},
+		ttls:    map[string]int64{},
+		zones:   map[string]map[string]bool{},
+	}
+}
+
+func (f *fakeDNSClient) call(ctx context.Context, op, name string) error {
+	f.calls = append(f.calls, op+" "+name)
+	zone, _ := zoneFromContext(ctx)
+	if f.zones[zone] == nil {
+		f.zones[zone] = map[string]bool{}
+	}
+	f.zones[zone][name] = true
+	return f.err
+}
+
+func (f *fakeDNSClient) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, ttl int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "upsert", dnsName); err != nil {
+		return 0, err
+	}
+	changed := 0
+	if current, ok := f.records[dnsName]; ok != (len(ipList) > 0) || !slices.Equal(current, ipList) || f.ttls[dnsName] != ttl {
+		changed = 1
+	}
+	f.ttls[dnsName] = ttl
+	if len(ipList) == 0 {
+		delete(f.records, dnsName)
+		return changed, nil
+	}
+	f.records[dnsName] = slices.Clone(ipList)
+	return changed, nil
+}
+
+func (f *fakeDNSClient) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "delete", dnsName); err != nil {
+		return err
+	}
+	delete(f.records, dnsName)
+	return nil
+}
+
+func (f *fakeDNSClient) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, n := range dnsNames {
+		if err := f.call(ctx, "batch-delete", n); err != nil {
+			return err
+		}
+		delete(f.records, n)
+	}
+	return nil
+}
+
+func (f *fakeDNSClient) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call(ctx, "retain", dnsName)
+}
+
+func (f *fakeDNSClient) UpsertExtraRecords(ctx context.Context, dnsName string, records []ExtraRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "upsert-extra", dnsName); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		delete(f.extras, dnsName)
+		return nil
+	}
+	f.extras[dnsName] = slices.Clone(records)
+	return nil
+}
+
+func (f *fakeDNSClient) UpsertPTRRecords(ctx context.Context, ips []string, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ip := range ips {
+		if err := f.call(ctx, "upsert-ptr", ip); err != nil {
+			return err
+		}
+		f.ptrs[ip] = target
+	}
+	return nil
+}
+
+func (f *fakeDNSClient) DeletePTRRecords(ctx context.Context, ips []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ip := range ips {
+		if err := f.call(ctx, "delete-ptr", ip); err != nil {
+			return err
+		}
+		delete(f.ptrs, ip)
+	}
+	return nil
+}
+
+func (f *fakeDNSClient) UpsertCNAMERecord(ctx context.Context, dnsName, target string, _ int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "upsert-cname", dnsName); err != nil {
+		return err
+	}
+	if target == "" {
+		delete(f.cnames, dnsName)
+		return nil
+	}
+	f.cnames[dnsName] = target
+	delete(f.records, dnsName)
+	return nil
+}
+
+func (f *fakeDNSClient) UpsertTXTRecord(ctx context.Context, dnsName string, values []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "upsert-txt", dnsName); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		delete(f.txt, dnsName)
+		return nil
+	}
+	f.txt[dnsName] = slices.Clone(values)
+	return nil
+}
+
+// snapshot copies the address records, for comparing after a reconcile.
+func (f *fakeDNSClient) snapshot() map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.records)
+}
+
+func (f *fakeDNSClient) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+// newTestReconciler returns a ServiceReconciler over a fake cluster holding objs and a fake zone.
+func newTestReconciler(t *testing.T, objs ...client.Object) (*ServiceReconciler, *fakeDNSClient) {
+	t.Helper()
+	dns := newFakeDNSClient()
+	r := &ServiceReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(objs...).Build(),
+		dns:      dns,
+		recorder: record.NewFakeRecorder(100),
+		state:    NewReconcilerState(),
+	}
+	return r, dns
+}
+
+func testService(name string, clusterIPs ...string) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:       corev1.ServiceTypeClusterIP,
+			ClusterIPs: clusterIPs,
+		},
+	}
+	if len(clusterIPs) > 0 {
+		svc.Spec.ClusterIP = clusterIPs[0]
+	}
+	return svc
+}
+
+func reconcileService(t *testing.T, r *ServiceReconciler, svc *corev1.Service) reconcile.Result {
+	t.Helper()
+	res, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	return res
+}
+
+func TestReconcile(t *testing.T) {
+	deleting := testService("old", "10.0.0.9")
+	deleting.Finalizers = []string{finalizer}
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	setPublishedNames(deleting, []string{"old.default.svc"})
+
+	headless := testService("db", corev1.ClusterIPNone)
+
+	tests := []struct {
+		name         string
+		svc          *corev1.Service
+		ipv6Label    string
+		existing     map[string][]string
+		want         map[string][]string
+		wantFinal    bool // service still exists and carries the finalizer
+		wantGone     bool // service was deleted once the finalizer came off
+		wantNoWrites bool
+	}{
+		{
+			name:      "cluster IP service gets an A record and the finalizer",
+			svc:       testService("web", "10.0.0.1"),
+			want:      map[string][]string{"web.default.svc": {"10.0.0.1"}},
+			wantFinal: true,
+		},
+		{
+			name:     "deleting service has its records deleted and the finalizer removed",
+			svc:      deleting,
+			existing: map[string][]string{"old.default.svc": {"10.0.0.9"}},
+			want:     map[string][]string{},
+			wantGone: true,
+		},
+		{
+			name:         "headless service is skipped",
+			svc:          headless,
+			want:         map[string][]string{},
+			wantNoWrites: true,
+		},
+		{
+			name:      "dual stack service publishes both families at one name",
+			svc:       testService("dual", "10.0.0.2", "fd00::2"),
+			want:      map[string][]string{"dual.default.svc": {"10.0.0.2", "fd00::2"}},
+			wantFinal: true,
+		},
+		{
+			name:      "dual stack service with -ipv6-label splits the families",
+			svc:       testService("split", "fd00::3", "10.0.0.3"),
+			ipv6Label: "v6",
+			want: map[string][]string{
+				"split.default.svc":    {"10.0.0.3"},
+				"split.v6.default.svc": {"fd00::3"},
+			},
+			wantFinal: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, dns := newTestReconciler(t, tt.svc.DeepCopy())
+			r.IPv6Label = tt.ipv6Label
+			r.RecordSuffix = "svc"
+			maps.Copy(dns.records, tt.existing)
+
+			reconcileService(t, r, tt.svc)
+
+			got := dns.snapshot()
+			if !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if tt.wantNoWrites && dns.callCount() > 0 {
+				t.Errorf("expected no azure calls, got %v", dns.calls)
+			}
+			var svc corev1.Service
+			err := r.Get(context.Background(), client.ObjectKeyFromObject(tt.svc), &svc)
+			switch {
+			case tt.wantGone:
+				if err == nil {
+					t.Errorf("service still exists with finalizers %v", svc.Finalizers)
+				}
+			case err != nil:
+				t.Fatalf("Get: %v", err)
+			case controllerutil.ContainsFinalizer(&svc, finalizer) != tt.wantFinal:
+				t.Errorf("finalizers = %v, want finalizer %v", svc.Finalizers, tt.wantFinal)
+			}
+		})
+	}
+}
+
+func TestReconcileOddServiceShape(t *testing.T) {
+	svc := testService("odd", "10.0.0.1", "garbage")
+	svc.Annotations = nil
+	svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+	svc.Spec.IPFamilies = []corev1.IPFamily{"IPv9"}
+	svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{}, {IP: "not-an-ip"}, {IP: "10.0.0.5"}}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	panics := testutil.ToFloat64(reconcilePanics)
+
+	reconcileService(t, r, svc)
+
+	if got := testutil.ToFloat64(reconcilePanics) - panics; got != 0 {
+		t.Errorf("%v reconciles panicked", got)
+	}
+	want := map[string][]string{"odd.default.svc": {"10.0.0.5"}}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	var warned int
+	for events := r.recorder.(*record.FakeRecorder).Events; len(events) > 0; {
+		if strings.Contains(<-events, "UnexpectedServiceShape") {
+			warned++
+		}
+	}
+	if warned != 3 {
+		t.Errorf("got %d UnexpectedServiceShape events, want 3", warned)
+	}
+
+	// an ingress with nothing usable is still pending.
+	if _, _, pending := serviceAddresses(&corev1.Service{
+		Spec:   corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{}}}},
+	}, publishExternal); !pending {
+		t.Error("load balancer with only an empty ingress isn't pending")
+	}
+}
+
+func TestSplitIPFamilies(t *testing.T) {
+	v4, v6 := splitIPFamilies([]string{"10.0.0.1", "fd00::1", "::ffff:10.0.0.2", "not-an-ip", "10.0.0.3:80"})
+	if want := []string{"10.0.0.1", "10.0.0.2"}; !slices.Equal(v4, want) {
+		t.Errorf("v4 = %v, want %v", v4, want)
+	}
+	if want := []string{"fd00::1"}; !slices.Equal(v6, want) {
+		t.Errorf("v6 = %v, want %v", v6, want)
+	}
+}
+
+func TestReconcilePTRTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   string // dns.azure.com/zone annotation
+		suffix string
+		want   string
+	}{
+		{name: "default zone", suffix: "svc", want: "web.default.svc.cluster.example"},
+		{name: "annotated zone", zone: "other.example", suffix: "svc", want: "web.default.svc.other.example"},
+		{name: "suffix ending in the zone", suffix: "svc.cluster.example", want: "web.default.svc.cluster.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService("web", "10.0.0.1")
+			if tt.zone != "" {
+				svc.Annotations = map[string]string{zoneAnnotation: tt.zone}
+			}
+			r, dns := newTestReconciler(t, svc)
+			r.RecordSuffix = tt.suffix
+			r.PTRDomain = "cluster.example"
+			r.zones = &ZoneRouter{Zones: []string{"cluster.example", "other.example"}}
+
+			reconcileService(t, r, svc)
+
+			if got := dns.ptrs["10.0.0.1"]; got != tt.want {
+				t.Errorf("PTR target = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchDeleteRemovesEveryRecordType(t *testing.T) {
+	web := testService("web", "10.0.0.1")
+	// published under a previous hostname too.
+	setPublishedNames(web, []string{"old-web.default.svc", "web.default.svc"})
+	ext := externalNameService("ext", "example.com")
+	services := []corev1.Service{*web, *ext}
+	for i := range services {
+		services[i].Finalizers = []string{finalizer}
+		services[i].DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	}
+	r, dns := newTestReconciler(t, services[0].DeepCopy(), services[1].DeepCopy())
+	r.RecordSuffix = "svc"
+	dns.records["web.default.svc"] = []string{"10.0.0.1"}
+	dns.records["old-web.default.svc"] = []string{"10.0.0.1"}
+	dns.extras["web.default.svc"] = []ExtraRecord{{Type: "MX", Value: "10 mail.example.com"}}
+	dns.extras["old-web.default.svc"] = []ExtraRecord{{Type: "MX", Value: "10 mail.example.com"}}
+	dns.cnames["ext.default.svc"] = "example.com"
+
+	deleting, err := r.deletingServices(context.Background(), "default")
+	if err != nil || len(deleting) != 2 {
+		t.Fatalf("deletingServices = %d services, %v", len(deleting), err)
+	}
+	if err := r.batchDelete(context.Background(), deleting); err != nil {
+		t.Fatal(err)
+	}
+	if len(dns.records) > 0 || len(dns.extras) > 0 || len(dns.cnames) > 0 {
+		t.Errorf("left records %v, extra records %v, CNAMEs %v", dns.records, dns.extras, dns.cnames)
+	}
+}
+
+func TestReconcileDisabledRecordTypes(t *testing.T) {
+	const mx = `[{"type": "MX", "value": "10 mail.example.com"}]`
+	tests := []struct {
+		name       string
+		disable    string
+		svc        *corev1.Service
+		want       map[string][]string
+		wantCNAME  bool
+		wantPTR    bool
+		wantExtras bool
+		wantEvent  string
+	}{
+		{name: "nothing disabled", svc: testService("web", "10.0.0.1", "fd00::1"),
+			want: map[string][]string{"web.default.svc": {"10.0.0.1", "fd00::1"}}, wantPTR: true, wantExtras: true},
+		{name: "A", disable: "a", svc: testService("web", "10.0.0.1", "fd00::1"),
+			want: map[string][]string{"web.default.svc": {"fd00::1"}}, wantPTR: true, wantExtras: true},
+		{name: "AAAA", disable: "aaaa", svc: testService("web", "10.0.0.1", "fd00::1"),
+			want: map[string][]string{"web.default.svc": {"10.0.0.1"}}, wantPTR: true, wantExtras: true},
+		{name: "PTR", disable: "ptr", svc: testService("web", "10.0.0.1"),
+			want: map[string][]string{"web.default.svc": {"10.0.0.1"}}, wantExtras: true},
+		{name: "MX", disable: "mx", svc: testService("web", "10.0.0.1"),
+			want: map[string][]string{"web.default.svc": {"10.0.0.1"}}, wantPTR: true},
+		{name: "CNAME", disable: "cname", svc: externalNameService("ext", "example.com"),
+			want: map[string][]string{}, wantExtras: true},
+		{name: "CNAME kept", svc: externalNameService("ext", "example.com"),
+			want: map[string][]string{}, wantCNAME: true, wantExtras: true},
+		{name: "SRV isn't published so is reported", disable: "srv", svc: testService("web", "10.0.0.1"),
+			want: map[string][]string{"web.default.svc": {"10.0.0.1"}}, wantPTR: true, wantExtras: true, wantEvent: "UnsupportedRecordType"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := tt.svc.DeepCopy()
+			svc.Annotations = map[string]string{recordsAnnotation: mx}
+			if tt.disable != "" {
+				svc.Annotations[disableAnnotationPrefix+tt.disable] = "true"
+			}
+			r, dns := newTestReconciler(t, svc)
+			r.RecordSuffix = "svc"
+			r.PTRDomain = "cluster.example"
+			name := svc.Name + ".default.svc"
+			// published before the type was disabled.
+			dns.cnames[name] = "example.com"
+			dns.extras[name] = []ExtraRecord{{Type: "MX", Value: "10 mail.example.com"}}
+			for _, ip := range svc.Spec.ClusterIPs {
+				dns.ptrs[ip] = name + ".cluster.example"
+			}
+
+			reconcileService(t, r, svc)
+
+			if got := dns.snapshot(); !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if _, ok := dns.cnames[name]; ok != tt.wantCNAME && svc.Spec.Type == corev1.ServiceTypeExternalName {
+				t.Errorf("CNAME published = %v, want %v", ok, tt.wantCNAME)
+			}
+			if got := len(dns.ptrs) > 0; got != tt.wantPTR {
+				t.Errorf("PTR records %v, want published %v", dns.ptrs, tt.wantPTR)
+			}
+			if got := len(dns.extras[name]) > 0; got != tt.wantExtras {
+				t.Errorf("extra records %v, want published %v", dns.extras, tt.wantExtras)
+			}
+			events := r.recorder.(*record.FakeRecorder).Events
+			var gotEvent string
+			select {
+			case e := <-events:
+				gotEvent = e
+			default:
+			}
+			if tt.wantEvent != "" && !strings.Contains(gotEvent, tt.wantEvent) {
+				t.Errorf("event %q, want %s", gotEvent, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func externalNameService(name, target string) *corev1.Service {
+	svc := testService(name)
+	svc.Spec.Type = corev1.ServiceTypeExternalName
+	svc.Spec.ExternalName = target
+	return svc
+}
+
+func TestReconcileDropsWithdrawnLoadBalancerIP(t *testing.T) {
+	svc := testService("lb", "10.0.0.1")
+	svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+	svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "20.0.0.1"}, {IP: "20.0.0.2"}}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	reconcileService(t, r, svc)
+	if got, want := dns.snapshot()["lb.default.svc"], []string{"20.0.0.1", "20.0.0.2"}; !slices.Equal(got, want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+
+	var current corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &current); err != nil {
+		t.Fatal(err)
+	}
+	current.Status.LoadBalancer.Ingress = current.Status.LoadBalancer.Ingress[:1]
+	if err := r.Status().Update(context.Background(), &current); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, svc)
+	if got, want := dns.snapshot()["lb.default.svc"], []string{"20.0.0.1"}; !slices.Equal(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestNamespaceTeardownBatchesDeletes(t *testing.T) {
+	var objs []client.Object
+	for i := range 5 {
+		svc := testService("web"+strconv.Itoa(i), "10.0.0."+strconv.Itoa(i+1))
+		svc.Finalizers = []string{finalizer}
+		svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		setPublishedNames(svc, []string{svc.Name + ".default.svc"})
+		objs = append(objs, svc)
+	}
+	r, dns := newTestReconciler(t, objs...)
+	r.RecordSuffix = "svc"
+	r.DeleteBatchThreshold = 3
+	for _, obj := range objs {
+		dns.records[obj.GetName()+".default.svc"] = []string{"10.0.0.1"}
+	}
+
+	for _, obj := range objs {
+		reconcileService(t, r, obj.(*corev1.Service))
+	}
+	if len(dns.records) > 0 {
+		t.Errorf("records left after the teardown: %v", dns.records)
+	}
+	var batched int
+	for _, c := range dns.calls {
+		switch {
+		case strings.HasPrefix(c, "batch-delete "):
+			batched++
+		case strings.HasPrefix(c, "delete "):
+			t.Errorf("service deleted on its own: %s", c)
+		}
+	}
+	if batched != 5 {
+		t.Errorf("%d names batch deleted, want 5: %v", batched, dns.calls)
+	}
+
+	// the batch lists the zone once and only deletes the record sets that exist.
+	zone, sets := newTestAzureDNSConfig(t)
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.GetName()+".default.svc")
+		if _, err := zone.UpsertDNSRecords(context.Background(), obj.GetName()+".default.svc", []string{"10.0.0.1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sets.calls = nil
+	if err := zone.BatchDeleteDNSRecords(context.Background(), names); err != nil {
+		t.Fatal(err)
+	}
+	if len(sets.sets) > 0 || len(sets.calls) != 5 {
+		t.Errorf("batch delete left %v with calls %v, want 5 deletes", slices.Collect(maps.Keys(sets.sets)), sets.calls)
+	}
+}
+
+func TestAPIServerServiceExcludedByDefault(t *testing.T) {
+	for _, publish := range []bool{false, true} {
+		svc := testService("kubernetes", "10.0.0.1")
+		r, dns := newTestReconciler(t, svc)
+		r.RecordSuffix = "svc"
+		r.PublishAPIServerService = publish
+		reconcileService(t, r, svc)
+		if _, ok := dns.snapshot()["kubernetes.default.svc"]; ok != publish {
+			t.Errorf("with -publish-kubernetes-service=%v published = %v, calls %v", publish, ok, dns.calls)
+		}
+	}
+}
+
+func TestReconcilePublishesExternalIPs(t *testing.T) {
+	svc := testService("web", "10.0.0.1")
+	svc.Spec.ExternalIPs = []string{"20.0.0.1", "20.0.0.2"}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.PublishExternalIPs = true
+	reconcileService(t, r, svc)
+	want := map[string][]string{
+		"web.default.svc":      {"10.0.0.1"},
+		"web.default.external": {"20.0.0.1", "20.0.0.2"},
+	}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+
+	// removing the externalIPs removes their records.
+	var current corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &current); err != nil {
+		t.Fatal(err)
+	}
+	current.Spec.ExternalIPs = nil
+	if err := r.Update(context.Background(), &current); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, svc)
+	if _, ok := dns.snapshot()["web.default.external"]; ok {
+		t.Errorf("external records left after the externalIPs were removed: %v", dns.snapshot())
+	}
+}
+
+func TestReconcileTargetIPsAnnotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		want     []string
+		wantWarn bool
+	}{
+		{name: "override", value: "192.0.2.10, 2001:db8::10", want: []string{"192.0.2.10", "2001:db8::10"}},
+		{name: "invalid falls back to the cluster IP", value: "192.0.2.10,not-an-ip", want: []string{"10.0.0.1"}, wantWarn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			log.SetOutput(&out)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+			svc := testService("web", "10.0.0.1")
+			svc.Annotations = map[string]string{targetIPsAnnotation: tt.value}
+			r, dns := newTestReconciler(t, svc)
+			r.RecordSuffix = "svc"
+			reconcileService(t, r, svc)
+			if got := dns.snapshot()["web.default.svc"]; !slices.Equal(got, tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if warned := strings.Contains(out.String(), "Warning: ignoring "+targetIPsAnnotation); warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v: %s", warned, tt.wantWarn, out.String())
+			}
+		})
+	}
+}
+
+func TestReservedHostnamesRefused(t *testing.T) {
+	for _, hostname := range []string{heartbeatRecordName, versionRecordName, indexRecordName, indexRecordName + "-2", heartbeatRecordName + ".cluster.local"} {
+		svc := testService("web", "10.0.0.1")
+		svc.Annotations = map[string]string{hostnameAnnotation: hostname}
+		if name, err := serviceRecordName(svc, "svc"); !errors.Is(err, errInvalidHostname) {
+			t.Errorf("hostname %s gave %q, %v, want errInvalidHostname", hostname, name, err)
+		}
+	}
+	svc := testService("web", "10.0.0.1")
+	svc.Annotations = map[string]string{hostnameAnnotation: indexRecordName + "-api"}
+	if _, err := serviceRecordName(svc, "svc"); err != nil {
+		t.Errorf("hostname %s-api refused: %v", indexRecordName, err)
+	}
+}
+
+func TestResyncJitterSpreadsServices(t *testing.T) {
+	const period, jitter = 10 * time.Minute, 5 * time.Minute
+	var objs []client.Object
+	for i := range 50 {
+		objs = append(objs, testService("web"+strconv.Itoa(i), "10.0.0.1"))
+	}
+	r, _ := newTestReconciler(t, objs...)
+	r.RecordSuffix = "svc"
+	r.ResyncPeriod, r.ResyncJitter = period, jitter
+
+	lo, hi := time.Duration(1<<62), time.Duration(0)
+	distinct := map[time.Duration]bool{}
+	for _, obj := range objs {
+		after := reconcileService(t, r, obj.(*corev1.Service)).RequeueAfter
+		if after < period || after >= period+jitter {
+			t.Fatalf("%s resyncs after %s, want within [%s, %s)", obj.GetName(), after, period, period+jitter)
+		}
+		lo, hi = min(lo, after), max(hi, after)
+		distinct[after] = true
+	}
+	if len(distinct) < len(objs)/2 {
+		t.Errorf("%d services share %d resync times, want them spread out", len(objs), len(distinct))
+	}
+	if hi-lo < jitter/2 {
+		t.Errorf("resyncs span %s, want most of the %s window", hi-lo, jitter)
+	}
+
+	r.ResyncJitter = 0
+	if after := reconcileService(t, r, objs[0].(*corev1.Service)).RequeueAfter; after != period {
+		t.Errorf("resync without jitter after %s, want %s", after, period)
+	}
+}
+
+func TestServiceDeletedWithinStabilizationDelayNeverWritten(t *testing.T) {
+	svc := testService("ci-job", "10.0.0.1")
+	svc.CreationTimestamp = metav1.Now()
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.StabilizationDelay = time.Minute
+
+	res := reconcileService(t, r, svc)
+	if res.RequeueAfter <= 0 || res.RequeueAfter > time.Minute {
+		t.Errorf("new service requeued after %s, want within the %s delay", res.RequeueAfter, r.StabilizationDelay)
+	}
+	var got corev1.Service
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &got); err != nil {
+		t.Fatal(err)
+	}
+	if controllerutil.ContainsFinalizer(&got, finalizer) {
+		t.Error("finalizer added before the stabilization delay passed")
+	}
+	if err := r.Delete(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	reconcileService(t, r, svc)
+	if len(dns.calls) > 0 {
+		t.Errorf("azure calls %v for a service deleted within the stabilization delay", dns.calls)
+	}
+}
+
+func TestMaxNamesPerServiceLimitsNames(t *testing.T) {
+	svc := testService("web", "10.0.0.1", "fd00::1")
+	svc.Spec.ExternalIPs = []string{"20.0.0.1"}
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	r.IPv6Label = "v6"
+	r.PublishExternalIPs = true
+	r.MaxNamesPerService = 2
+	over := testutil.ToFloat64(namesOverLimit)
+
+	reconcileService(t, r, svc)
+	// the service's own name is always kept, then the others in sorted order.
+	want := map[string][]string{"web.default.svc": {"10.0.0.1"}, "web.default.external": {"20.0.0.1"}}
+	if got := dns.snapshot(); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	if slices.Contains(dns.calls, "upsert web.v6.default.svc") {
+		t.Error("name over the limit was written")
+	}
+	if got := testutil.ToFloat64(namesOverLimit) - over; got != 1 {
+		t.Errorf("%v names counted over the limit, want 1", got)
+	}
+	var warned bool
+	for events := r.recorder.(*record.FakeRecorder).Events; len(events) > 0; {
+		if strings.Contains(<-events, "TooManyNames") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("no TooManyNames event")
+	}
+}
+
+func TestReconcileGoneServiceQuiet(t *testing.T) {
+	svc := testService("old", "10.0.0.9")
+	svc.Finalizers = []string{finalizer}
+	svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	setPublishedNames(svc, []string{"old.default.svc"})
+	r, dns := newTestReconciler(t, svc)
+	r.RecordSuffix = "svc"
+	reconcileService(t, r, svc)
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &corev1.Service{}); err == nil {
+		t.Fatal("service still exists after its finalizer came off")
+	}
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	gone := testutil.ToFloat64(goneServices)
+	calls := dns.callCount()
+
+	// a stale event queues the service again.
+	reconcileService(t, r, svc)
+	if out.Len() > 0 {
+		t.Errorf("gone service logged %q without -v", out.String())
+	}
+	verbose = true
+	t.Cleanup(func() { verbose = false })
+	reconcileService(t, r, svc)
+	if !strings.Contains(out.String(), "Service default/old is gone, nothing to do") {
+		t.Errorf("log = %q, want the gone service at debug level", out.String())
+	}
+	if got := testutil.ToFloat64(goneServices) - gone; got != 2 {
+		t.Errorf("%v gone reconciles counted, want 2", got)
+	}
+	if dns.callCount() != calls {
+		t.Errorf("azure calls %v for a gone service", dns.calls[calls:])
+	}
+}
+
+func TestSkipDeletesFinalizesWithoutAzureDelete(t *testing.T) {
+	plain := testService("old", "10.0.0.9")
+	setPublishedNames(plain, []string{"old.default.svc"})
+	// no current name, what it published before is still left alone.
+	invalid := testService("renamed", "10.0.0.8")
+	setPublishedNames(invalid, []string{"renamed.default.svc"})
+	invalid.Annotations[hostnameAnnotation] = "not_a_hostname"
+	for _, svc := range []*corev1.Service{plain, invalid} {
+		svc.Finalizers = []string{finalizer}
+		svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		r, dns := newTestReconciler(t, svc)
+		r.RecordSuffix = "svc"
+		r.SkipDeletes = true
+		r.DeleteBatchThreshold = 1
+		name := publishedNames(svc)[0]
+		dns.records[name] = []string{svc.Spec.ClusterIP}
+
+		reconcileService(t, r, svc)
+		if len(dns.calls) > 0 {
+			t.Errorf("%s: azure calls %v with -allow-delete=false", svc.Name, dns.calls)
+		}
+		if got := dns.records[name]; !slices.Equal(got, []string{svc.Spec.ClusterIP}) {
+			t.Errorf("%s: records = %v, want them left for external cleanup", svc.Name, got)
+		}
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &corev1.Service{}); err == nil {
+			t.Errorf("%s still exists, its finalizer wasn't removed", svc.Name)
+		}
+		if !recordedEvent(r.recorder, recordsNotDeletedReason) {
+			t.Errorf("%s: no RecordsNotDeleted event", svc.Name)
+		}
+	}
+}
+
+// recordedEvent reports whether a FakeRecorder got an event with reason, draining the events it holds.
+func recordedEvent(recorder record.EventRecorder, reason string) bool {
+	found := false
+	for events := recorder.(*record.FakeRecorder).Events; len(events) > 0; {
+		if strings.Contains(<-events, " "+reason+" ") {
+			found = true
+		}
+	}
+	return found
+}
+
+func TestSkipDeletesHeadlessFinalizesWithoutAzureDelete(t *testing.T) {
+	svc := testService("db", corev1.ClusterIPNone)
+	svc.Finalizers = []string{finalizer}
+	svc.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	setPublishedHostnames(svc, []string{"db.default.svc", "db-0.db.default.svc"})
+	r, dns := newTestHeadlessReconciler(t, svc)
+	r.SkipDeletes = true
+	dns.records["db.default.svc"] = []string{"10.0.1.1"}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(svc)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(dns.calls) > 0 {
+		t.Errorf("azure calls %v with -allow-delete=false", dns.calls)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(svc), &corev1.Service{}); err == nil {
+		t.Error("headless service still exists, its finalizer wasn't removed")
+	}
+	if !recordedEvent(r.recorder, recordsNotDeletedReason) {
+		t.Error("no RecordsNotDeleted event")
+	}
+}
+
+func TestSkipDeletesAggregateRecordFinalizesWithoutAzureDelete(t *testing.T) {
+	agg := &AggregateRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", Finalizers: []string{finalizer}, DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+		Spec:       AggregateRecordSpec{Name: "api.global"},
+	}
+	setPublishedNames(agg, []string{"api.global"})
+	dns := newFakeDNSClient()
+	recorder := record.NewFakeRecorder(10)
+	r := &AggregateRecordReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(agg).Build(),
+		dns:         dns,
+		recorder:    recorder,
+		SkipDeletes: true,
+	}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(agg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(dns.calls) > 0 {
+		t.Errorf("azure calls %v with -allow-delete=false", dns.calls)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(agg), &AggregateRecord{}); err == nil {
+		t.Error("AggregateRecord still exists, its finalizer wasn't removed")
+	}
+	if !recordedEvent(recorder, recordsNotDeletedReason) {
+		t.Error("no RecordsNotDeleted event")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Shadow comparison results.
+const (
+	shadowMatch    = "match"     // external-dns owns the name and publishes the same values
+	shadowDiffer   = "differ"    // external-dns owns the name but publishes other values
+	shadowMissing  = "missing"   // no external-dns owned record for the name
+	shadowNotOwned = "not-owned" // records exist but external-dns doesn't own them
+	shadowExtra    = "extra"     // external-dns publishes a name this controller would delete
+)
+
+var shadowResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_dns_shadow_comparisons_total",
+	Help: "Desired records compared against external-dns in -shadow-external-dns mode, by zone and result.",
+}, []string{"zone", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(shadowResults)
+}
+
+// ShadowDNSConfig never writes to azure. Each change the controller would make is instead
+// compared with what external-dns currently publishes in the zone and the difference is logged
+// and counted, so parity can be checked before migrating off external-dns.
+type ShadowDNSConfig struct {
+	*AzureDNSConfig
+	Owner string // external-dns --txt-owner-id to compare against, empty accepts any owner
+}
+
+// UpsertDNSRecords never changes anything, it only reports how ipList compares.
+func (s *ShadowDNSConfig) UpsertDNSRecords(ctx context.Context, dnsName string, ipList []string, _ int64) (int, error) {
+	name, err := s.relativeName(dnsName)
+	if err != nil {
+		return 0, err
+	}
+	owned, err := s.ownedByExternalDNS(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	current, err := s.addressValues(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	want := slices.Clone(ipList)
+	slices.Sort(want)
+
+	result := shadowMatch
+	switch {
+	case !owned && len(current) > 0:
+		result = shadowNotOwned
+	case !owned:
+		result = shadowMissing
+	case !slices.Equal(want, current):
+		result = shadowDiffer
+	}
+	s.report(name, result, want, current)
+	return 0, nil
+}
+
+func (s *ShadowDNSConfig) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	name, err := s.relativeName(dnsName)
+	if err != nil {
+		return err
+	}
+	owned, err := s.ownedByExternalDNS(ctx, name)
+	if err != nil {
+		return err
+	}
+	if owned {
+		current, err := s.addressValues(ctx, name)
+		if err != nil {
+			return err
+		}
+		s.report(name, shadowExtra, nil, current)
+	}
+	return nil
+}
+
+// RetainDNSRecords compares like a delete, external-dns has no equivalent of a retained tombstone.
+func (s *ShadowDNSConfig) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return s.DeleteDNSRecords(ctx, dnsName)
+}
+
+func (s *ShadowDNSConfig) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	for _, n := range dnsNames {
+		if err := s.DeleteDNSRecords(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpsertExtraRecords drops extra records, only addresses are compared with external-dns.
+func (s *ShadowDNSConfig) UpsertExtraRecords(_ context.Context, _ string, _ []ExtraRecord) error {
+	return nil
+}
+
+// UpsertCNAMERecord drops CNAME records, only addresses are compared with external-dns.
+func (s *ShadowDNSConfig) UpsertCNAMERecord(_ context.Context, _, _ string, _ int64) error {
+	return nil
+}
+
+// UpsertPTRRecords drops PTR records, external-dns doesn't publish them.
+func (s *ShadowDNSConfig) UpsertPTRRecords(_ context.Context, _ []string, _ string) error {
+	return nil
+}
+
+func (s *ShadowDNSConfig) DeletePTRRecords(_ context.Context, _ []string) error {
+	return nil
+}
+
+// UpsertTXTRecord drops the controller's own TXT records, external-dns has nothing to compare them with.
+func (s *ShadowDNSConfig) UpsertTXTRecord(_ context.Context, _ string, _ []string) error {
+	return nil
+}
+
+func (s *ShadowDNSConfig) report(name, result string, want, current []string) {
+	shadowResults.WithLabelValues(s.ZoneName, result).Inc()
+	if result != shadowMatch {
+		log.Printf("Shadow %s: %s.%s want %v, external-dns has %v", result, name, s.ZoneName, want, current)
+	}
+}
+
+// addressValues returns the sorted A and AAAA values currently at name.
+func (s *ShadowDNSConfig) addressValues(ctx context.Context, name string) ([]string, error) {
+	var values []string
+	for _, rt := range []dns.RecordType{dns.RecordTypeA, dns.RecordTypeAAAA} {
+		resp, err := s.DNSClient.Get(ctx, s.ResourceGroup, s.ZoneName, rt, name, &dns.RecordSetsClientGetOptions{})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s records: %w", rt, err)
+		}
+		if resp.Properties != nil {
+			values = append(values, recordSetValues(resp.Properties)...)
+		}
+	}
+	slices.Sort(values)
+	return values, nil
+}
+
+// ownedByExternalDNS looks for an external-dns ownership TXT record for name,
+// in either the current "a-<name>"/"aaaa-<name>" layout or the older bare "<name>" one.
+func (s *ShadowDNSConfig) ownedByExternalDNS(ctx context.Context, name string) (bool, error) {
+	for _, txtName := range []string{"a-" + name, "aaaa-" + name, name} {
+		resp, err := s.DNSClient.Get(ctx, s.ResourceGroup, s.ZoneName, dns.RecordTypeTXT, txtName, &dns.RecordSetsClientGetOptions{})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("error reading TXT %s: %w", txtName, err)
+		}
+		if resp.Properties == nil {
+			continue
+		}
+		for _, txt := range resp.Properties.TxtRecords {
+			for _, v := range txt.Value {
+				if s.isOwnershipRecord(to.String(v)) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// isOwnershipRecord parses an external-dns registry value such as
+// "heritage=external-dns,external-dns/owner=default,external-dns/resource=service/ns/name".
+func (s *ShadowDNSConfig) isOwnershipRecord(value string) bool {
+	labels := map[string]string{}
+	for _, kv := range strings.Split(strings.Trim(value, `"`), ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		labels[k] = v
+	}
+	if labels["heritage"] != "external-dns" {
+		return false
+	}
+	return s.Owner == "" || labels["external-dns/owner"] == s.Owner
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShadowReportsDiffAgainstExternalDNS(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	zone, sets := newTestAzureDNSConfig(t)
+	address := func(name string, ips ...string) {
+		var records []*dns.ARecord
+		for _, ip := range ips {
+			records = append(records, &dns.ARecord{IPv4Address: to.StringPtr(ip)})
+		}
+		sets.sets[fakeKey(dns.RecordTypeA, name)] = dns.RecordSet{Properties: &dns.RecordSetProperties{TTL: to.Int64Ptr(300), ARecords: records}}
+	}
+	owner := func(txtName, owner string) {
+		v := "heritage=external-dns,external-dns/owner=" + owner + ",external-dns/resource=service/default/x"
+		sets.sets[fakeKey(dns.RecordTypeTXT, txtName)] = dns.RecordSet{Properties: &dns.RecordSetProperties{
+			TTL: to.Int64Ptr(300), TxtRecords: []*dns.TxtRecord{{Value: []*string{to.StringPtr(v)}}},
+		}}
+	}
+	address("web.default.svc", "10.0.0.1")
+	owner("a-web.default.svc", "default")
+	address("db.default.svc", "10.0.0.9")
+	owner("db.default.svc", "default") // the older registry layout
+	address("hand.default.svc", "10.0.0.3")
+	address("other.default.svc", "10.0.0.4")
+	owner("a-other.default.svc", "someone-else")
+	address("old.default.svc", "10.0.0.5")
+	owner("a-old.default.svc", "default")
+	shadow := &ShadowDNSConfig{AzureDNSConfig: zone, Owner: "default"}
+
+	results := map[string]float64{}
+	for _, r := range []string{shadowMatch, shadowDiffer, shadowMissing, shadowNotOwned, shadowExtra} {
+		results[r] = testutil.ToFloat64(shadowResults.WithLabelValues("example.internal", r))
+	}
+	ctx := context.Background()
+	for name, ips := range map[string][]string{
+		"web.default.svc":   {"10.0.0.1"},
+		"db.default.svc":    {"10.0.0.2"},
+		"hand.default.svc":  {"10.0.0.3"},
+		"other.default.svc": {"10.0.0.4"},
+		"new.default.svc":   {"10.0.0.6"},
+	} {
+		if _, err := shadow.UpsertDNSRecords(ctx, name, ips, 0); err != nil {
+			t.Fatalf("upsert %s: %v", name, err)
+		}
+	}
+	if err := shadow.DeleteDNSRecords(ctx, "old.default.svc"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{
+		shadowMatch:    1, // web
+		shadowDiffer:   1, // db
+		shadowMissing:  1, // new
+		shadowNotOwned: 2, // hand has no registry record, other's belongs to another owner
+		shadowExtra:    1, // old
+	}
+	for r, n := range want {
+		if got := testutil.ToFloat64(shadowResults.WithLabelValues("example.internal", r)) - results[r]; got != n {
+			t.Errorf("%s comparisons = %v, want %v", r, got, n)
+		}
+	}
+	for _, line := range []string{
+		"Shadow differ: db.default.svc.example.internal want [10.0.0.2], external-dns has [10.0.0.9]",
+		"Shadow missing: new.default.svc.example.internal want [10.0.0.6], external-dns has []",
+		"Shadow extra: old.default.svc.example.internal want [], external-dns has [10.0.0.5]",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("log = %q, want it to contain %q", out.String(), line)
+		}
+	}
+	if strings.Contains(out.String(), "web.default.svc") {
+		t.Error("a matching name was logged as a difference")
+	}
+	for _, c := range sets.calls {
+		if !strings.HasPrefix(c, "get ") {
+			t.Errorf("shadow mode called %s, it must only read", c)
+		}
+	}
+}
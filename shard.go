@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Shard is the slice of services one replica reconciles when work is split across replicas.
+// A service belongs to the shard its namespace/name hashes to, so every replica agrees on the
+// owner without coordinating. The zero value owns every service.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// owns reports whether the service at key belongs to this shard.
+func (s Shard) owns(key types.NamespacedName) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.String()))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index
+}
+
+// validate checks s is a shard of at least one, with 0 <= Index < Count when there are several.
+func (s Shard) validate() error {
+	if s.Count < 1 {
+		return fmt.Errorf("-shard-count %d must be at least 1", s.Count)
+	}
+	if s.Count > 1 && (s.Index < 0 || s.Index >= s.Count) {
+		return fmt.Errorf("-shard-index %d must be from 0 to %d for -shard-count %d", s.Index, s.Count-1, s.Count)
+	}
+	return nil
+}
+
+// shardIndexFromHostname takes the index from a StatefulSet pod name like azure-k8s-dns-2.
+func shardIndexFromHostname() (int, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	i := strings.LastIndex(host, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("hostname %q has no StatefulSet ordinal", host)
+	}
+	index, err := strconv.Atoi(host[i+1:])
+	if err != nil {
+		return 0, fmt.Errorf("hostname %q has no StatefulSet ordinal", host)
+	}
+	return index, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestShardIsStable pins the shard of a few services, replicas of different versions must agree on them.
+func TestShardIsStable(t *testing.T) {
+	want := map[types.NamespacedName]int{
+		{Namespace: "default", Name: "web"}:          0,
+		{Namespace: "default", Name: "db"}:           1,
+		{Namespace: "kube-system", Name: "kube-dns"}: 0,
+		{Namespace: "prod", Name: "api"}:             0,
+	}
+	for key, index := range want {
+		for i := range 3 {
+			if got := (Shard{Index: i, Count: 3}).owns(key); got != (i == index) {
+				t.Errorf("shard %d of 3 owns %s = %v, want shard %d to", i, key, got, index)
+			}
+		}
+	}
+}
+
+func TestShardOwnsEachServiceOnce(t *testing.T) {
+	for n := range 100 {
+		key := types.NamespacedName{Namespace: "ns", Name: fmt.Sprintf("svc-%d", n)}
+		owners := 0
+		for i := range 4 {
+			if (Shard{Index: i, Count: 4}).owns(key) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("%s is owned by %d shards", key, owners)
+		}
+	}
+}
+
+func TestShardValidate(t *testing.T) {
+	tests := []struct {
+		shard Shard
+		ok    bool
+	}{
+		{Shard{Index: -1, Count: 1}, true},
+		{Shard{Index: 0, Count: 3}, true},
+		{Shard{Index: 2, Count: 3}, true},
+		{Shard{Index: 3, Count: 3}, false},
+		{Shard{Index: -2, Count: 3}, false},
+		{Shard{Index: 0, Count: 0}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.shard.validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v.validate() = %v, want ok %v", tt.shard, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// azureWrites counts azure record set writes and deletes for the summary log, the azure call metrics keep
+// the full detail. Skipped writes, e.g. of unchanged record sets or while paused, aren't counted.
+var azureWrites atomic.Int64
+
+// errorCategory buckets a reconcile error for the summary log.
+func errorCategory(err error) string {
+	var respErr *azcore.ResponseError
+	switch {
+	case errors.Is(err, errNotLeader):
+		return "not-leader"
+	case errors.Is(err, errNameCollision):
+		return "name-collision"
+	case errors.Is(err, errWriteNotConfirmed):
+		return "unconfirmed-write"
+	case errors.Is(err, errEmptyResponse):
+		return "empty-response"
+	case errors.Is(err, errReconcilePanic):
+		return "panic"
+	case errors.Is(err, errAzureTimeout):
+		return "azure-timeout"
+	case errors.As(err, &respErr):
+		return "azure"
+	case apierrors.IsConflict(err):
+		return "kubernetes-conflict"
+	default:
+		return "other"
+	}
+}
+
+// Summary logs what the controller did over each interval, a health view that needs no Prometheus.
+type Summary struct {
+	state    *ReconcilerState
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (s *Summary) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			published, reconciles, errs := s.state.takeCounts()
+			log.Printf("Summary for the last %s: %d records published, %d reconciles, %d azure writes, errors %v",
+				s.Interval, published, reconciles, azureWrites.Swap(0), errs)
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, followers report too.
+func (s *Summary) NeedLeaderElection() bool {
+	return false
+}
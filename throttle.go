@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var effectiveQPS = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "azure_dns_effective_qps",
+	Help: "Current azure request rate limit, lowered while azure is throttling.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(effectiveQPS)
+}
+
+// How the adaptive limit moves: halve on every 429, add a tenth of the configured rate back
+// after each run of recoverAfter successful requests, never going below minQPS.
+const (
+	recoverAfter = 20
+	minQPS       = 0.5
+)
+
+// aimdLimiter adjusts a rate limiter additive increase, multiplicative decrease style
+// from the status codes azure returns. The limiter's starting limit is the ceiling.
+type aimdLimiter struct {
+	limiter *rate.Limiter
+	max     rate.Limit
+
+	mu        sync.Mutex
+	successes int
+}
+
+func newAIMDLimiter(limiter *rate.Limiter) *aimdLimiter {
+	effectiveQPS.Set(float64(limiter.Limit()))
+	return &aimdLimiter{limiter: limiter, max: limiter.Limit()}
+}
+
+func (a *aimdLimiter) observe(status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	current := a.limiter.Limit()
+	if status == http.StatusTooManyRequests {
+		a.successes = 0
+		next := max(current/2, minQPS)
+		if next != current {
+			log.Printf("Azure is throttling, lowering request rate %.2f -> %.2f qps", current, next)
+			a.set(next)
+		}
+		return
+	}
+	if status >= 300 || current >= a.max {
+		return
+	}
+	a.successes++
+	if a.successes < recoverAfter {
+		return
+	}
+	a.successes = 0
+	a.set(min(current+a.max/10, a.max))
+}
+
+func (a *aimdLimiter) set(limit rate.Limit) {
+	a.limiter.SetLimit(limit)
+	effectiveQPS.Set(float64(limit))
+}
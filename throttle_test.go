@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+// statusTransport answers every request with status.
+type statusTransport struct {
+	status int
+}
+
+func (s *statusTransport) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: s.status, Body: http.NoBody, Header: http.Header{}, Request: req}, nil
+}
+
+func TestAdaptiveRateLimit(t *testing.T) {
+	// a burst big enough that the test never waits on the limiter.
+	limiter := rate.NewLimiter(1000, 1000)
+	transport := &statusTransport{}
+	pipeline := runtime.NewPipeline("test", "v0", runtime.PipelineOptions{
+		PerRetry: []policy.Policy{rateLimitPolicy{limiter: limiter, adaptive: newAIMDLimiter(limiter)}},
+	}, &policy.ClientOptions{Transport: transport, Retry: policy.RetryOptions{MaxRetries: -1}})
+	send := func(status int) {
+		t.Helper()
+		transport.status = status
+		req, err := runtime.NewRequest(context.Background(), http.MethodGet, "https://management.azure.com/zone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pipeline.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want rate.Limit) {
+		t.Helper()
+		if got := limiter.Limit(); got != want {
+			t.Errorf("limit = %v, want %v", got, want)
+		}
+		if got := testutil.ToFloat64(effectiveQPS); got != float64(want) {
+			t.Errorf("effective qps metric = %v, want %v", got, want)
+		}
+	}
+
+	for _, want := range []rate.Limit{500, 250, 125} {
+		send(http.StatusTooManyRequests)
+		check(want)
+	}
+	for range recoverAfter - 1 {
+		send(http.StatusOK)
+	}
+	check(125)
+	// every run of recoverAfter successes adds back a tenth of the ceiling, up to the ceiling.
+	for _, want := range []rate.Limit{225, 325, 425, 525, 625, 725, 825, 925, 1000, 1000} {
+		for range recoverAfter {
+			send(http.StatusOK)
+		}
+		check(want)
+	}
+	send(http.StatusTooManyRequests)
+	check(500)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// tombstoneMetadataKey marks a record set as soft deleted. The value is the RFC3339 time it was tombstoned.
+const tombstoneMetadataKey = "tombstoned"
+
+// retainedMetadataKey marks a tombstone the purger must leave alone, see RetainDNSRecords.
+const retainedMetadataKey = "retained"
+
+// tombstoneTTL is short so resolvers stop caching a soft deleted record quickly.
+const tombstoneTTL = 5
+
+// SoftDeleteDNSConfig tombstones records instead of deleting them.
+// Tombstoned record sets are purged by a TombstonePurger once retention has elapsed.
+// Upserting the name again replaces the record set and so clears the tombstone.
+type SoftDeleteDNSConfig struct {
+	*AzureDNSConfig
+}
+
+// DeleteDNSRecords tombstones the A and AAAA record sets for dnsName.
+func (r *SoftDeleteDNSConfig) DeleteDNSRecords(ctx context.Context, dnsName string) error {
+	return r.tombstone(ctx, dnsName, false)
+}
+
+// RetainDNSRecords tombstones the A and AAAA record sets for dnsName and marks them so
+// TombstonePurger never purges them. They stay until removed by hand or the name is upserted again.
+func (r *AzureDNSConfig) RetainDNSRecords(ctx context.Context, dnsName string) error {
+	return r.tombstone(ctx, dnsName, true)
+}
+
+func (r *AzureDNSConfig) tombstone(ctx context.Context, dnsName string, retain bool) error {
+	dnsName, err := r.addressName(dnsName)
+	if neverWritten(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, rt := range []dns.RecordType{dns.RecordTypeA, dns.RecordTypeAAAA} {
+		resp, err := r.DNSClient.Get(ctx, r.ResourceGroup, r.ZoneName, rt, dnsName, &dns.RecordSetsClientGetOptions{})
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("error reading %s records: %w", rt, err)
+		}
+		rs := resp.RecordSet
+		if rs.Properties == nil {
+			continue
+		}
+		if rs.Properties.Metadata == nil {
+			rs.Properties.Metadata = map[string]*string{}
+		}
+		_, tombstoned := rs.Properties.Metadata[tombstoneMetadataKey]
+		_, retained := rs.Properties.Metadata[retainedMetadataKey]
+		if tombstoned && (retained || !retain) {
+			continue
+		}
+		if !tombstoned {
+			rs.Properties.Metadata[tombstoneMetadataKey] = to.StringPtr(now)
+		}
+		if retain {
+			rs.Properties.Metadata[retainedMetadataKey] = to.StringPtr("true")
+		}
+		rs.Properties.TTL = to.Int64Ptr(tombstoneTTL)
+		if _, err := r.writeRecordSet(ctx, rt, dnsName, rs); err != nil {
+			return fmt.Errorf("error tombstoning %s records: %w", rt, err)
+		}
+	}
+	return nil
+}
+
+// BatchDeleteDNSRecords tombstones the records of every name in dnsNames.
+func (r *SoftDeleteDNSConfig) BatchDeleteDNSRecords(ctx context.Context, dnsNames []string) error {
+	for _, n := range dnsNames {
+		if err := r.DeleteDNSRecords(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TombstonePurger periodically hard deletes record sets tombstoned longer than Retention ago.
+type TombstonePurger struct {
+	dns       *AzureDNSConfig
+	Retention time.Duration
+	Interval  time.Duration
+	Paused    func() bool // optional, purging is skipped while it returns true
+}
+
+// Start implements manager.Runnable.
+func (p *TombstonePurger) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		if p.Paused == nil || !p.Paused() {
+			if err := p.Purge(ctx, time.Now()); err != nil {
+				log.Printf("Failed to purge tombstoned records: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes every tombstoned record set whose tombstone is older than Retention as of now.
+func (p *TombstonePurger) Purge(ctx context.Context, now time.Time) error {
+	pager := p.dns.DNSClient.NewListPager(p.dns.ResourceGroup, p.dns.ZoneName, &dns.RecordSetsClientListOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, rs := range page.Value {
+			if rs.Name == nil || rs.Type == nil || rs.Properties == nil {
+				continue
+			}
+			stamp, ok := rs.Properties.Metadata[tombstoneMetadataKey]
+			if !ok || stamp == nil {
+				continue
+			}
+			if _, retained := rs.Properties.Metadata[retainedMetadataKey]; retained {
+				continue
+			}
+			tombstoned, err := time.Parse(time.RFC3339, *stamp)
+			if err != nil {
+				log.Printf("Ignoring bad tombstone %q on %s: %v", *stamp, *rs.Name, err)
+				continue
+			}
+			if now.Sub(tombstoned) < p.Retention {
+				continue
+			}
+			rt := recordTypeFromResourceType(*rs.Type)
+			log.Printf("Purging tombstoned %s record %s", rt, *rs.Name)
+			if _, err := p.dns.deleteRecordSet(ctx, rt, *rs.Name); err != nil {
+				return fmt.Errorf("error purging %s records for %s: %w", rt, *rs.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// recordTypeFromResourceType turns "Microsoft.Network/privateDnsZones/A" into dns.RecordTypeA.
+func recordTypeFromResourceType(t string) dns.RecordType {
+	return dns.RecordType(t[strings.LastIndex(t, "/")+1:])
+}
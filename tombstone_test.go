@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSoftDeleteTombstonesThenPurges(t *testing.T) {
+	r, sets := newTestAzureDNSConfig(t)
+	soft := &SoftDeleteDNSConfig{AzureDNSConfig: r}
+	ctx := context.Background()
+	if _, err := soft.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := soft.DeleteDNSRecords(ctx, "web.default.svc"); err != nil {
+		t.Fatal(err)
+	}
+	rs, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]
+	if !ok {
+		t.Fatal("record set deleted instead of tombstoned")
+	}
+	if rs.Properties.Metadata[tombstoneMetadataKey] == nil || to.Int64(rs.Properties.TTL) != tombstoneTTL {
+		t.Errorf("record set not tombstoned: %+v", rs.Properties)
+	}
+
+	p := &TombstonePurger{dns: r, Retention: time.Hour}
+	if err := p.Purge(ctx, time.Now().Add(30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; !ok {
+		t.Fatal("tombstone purged before the retention elapsed")
+	}
+	if err := p.Purge(ctx, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; ok {
+		t.Error("tombstone kept after the retention elapsed")
+	}
+}
+
+func TestDeleteProtectedNamespaceTombstones(t *testing.T) {
+	zone, sets := newTestAzureDNSConfig(t)
+	web := testService("web", "10.0.0.1")
+	optedIn := testService("tmp", "10.0.0.2")
+	optedIn.Annotations = map[string]string{allowDeleteAnnotation: "true"}
+	r, _ := newTestReconciler(t, web, optedIn)
+	r.RecordSuffix = "svc"
+	r.dns = zone
+	r.DeleteProtectedNamespaces = map[string]bool{"default": true}
+	ctx := context.Background()
+	for _, svc := range []*corev1.Service{web, optedIn} {
+		reconcileService(t, r, svc)
+		if err := r.Get(ctx, client.ObjectKeyFromObject(svc), svc); err != nil {
+			t.Fatal(err)
+		}
+		// the finalizer holds the service until its records are dealt with.
+		if err := r.Delete(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+		reconcileService(t, r, svc)
+	}
+
+	rs, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]
+	if !ok {
+		t.Fatal("protected namespace's records purged on service deletion")
+	}
+	if rs.Properties.Metadata[tombstoneMetadataKey] == nil || rs.Properties.Metadata[retainedMetadataKey] == nil {
+		t.Errorf("records not retained as a tombstone: %+v", rs.Properties.Metadata)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "tmp.default.svc")]; ok {
+		t.Error("records kept for a service that opted in to deletion")
+	}
+	if err := (&TombstonePurger{dns: zone, Retention: time.Hour}).Purge(ctx, time.Now().Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")]; !ok {
+		t.Error("retained tombstone purged")
+	}
+
+	// headless services are published by their own reconciler, which retains them the same way.
+	db := testService("db", corev1.ClusterIPNone)
+	hr, _ := newTestHeadlessReconciler(t, db, testEndpointSlice("db", "db-a", zonedEndpoint("", "10.0.1.1")))
+	hr.dns = zone
+	hr.DeleteProtectedNamespaces = r.DeleteProtectedNamespaces
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+	if _, err := hr.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := hr.Get(ctx, req.NamespacedName, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := hr.Delete(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hr.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	rs, ok = sets.sets[fakeKey(dns.RecordTypeA, "db.default.svc")]
+	if !ok {
+		t.Fatal("protected namespace's headless records purged on service deletion")
+	}
+	if rs.Properties.Metadata[tombstoneMetadataKey] == nil || rs.Properties.Metadata[retainedMetadataKey] == nil {
+		t.Errorf("headless records not retained as a tombstone: %+v", rs.Properties.Metadata)
+	}
+	if err := hr.Get(ctx, req.NamespacedName, db); err == nil {
+		t.Error("headless service still exists, its finalizer wasn't removed")
+	}
+}
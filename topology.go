@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// topologyName is the record name for the topology zone of ep, <zone>.<base> where base is the service's
+// own record name, e.g. eastus-1.web.default.svc. Endpoints without a zone, or with one that isn't a valid
+// DNS label, have none, they are still covered by the service wide record.
+func topologyName(service types.NamespacedName, base string, ep discoveryv1.Endpoint) (string, bool) {
+	if ep.Zone == nil || *ep.Zone == "" {
+		return "", false
+	}
+	zone := strings.ToLower(*ep.Zone)
+	if errs := validation.IsDNS1123Label(zone); len(errs) > 0 {
+		debugf("Not publishing topology zone %q of %s, it isn't a DNS label: %s", *ep.Zone, service, strings.Join(errs, ", "))
+		return "", false
+	}
+	return zone + "." + base, true
+}
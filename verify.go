@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	initialSyncTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "azure_dns_initial_sync_services",
+		Help: "Services the -verify-on-start sweep has to check.",
+	})
+	initialSyncDone = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "azure_dns_initial_sync_services_done",
+		Help: "Services the -verify-on-start sweep has checked so far.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(initialSyncTotal, initialSyncDone)
+}
+
+// InitialSync queues every service for the service controller once at startup so Azure matches the
+// cluster before the controller reports ready. Upserts are authoritative so any drift is written.
+// It runs on the leader, the only replica reconciling, and only the leader waits for it to be ready.
+type InitialSync struct {
+	client.Reader
+	// Sorted queues services in namespace/name order so logs are reproducible between runs.
+	Sorted bool
+	resync chan<- event.GenericEvent
+	// elected is closed once this replica leads, see manager.Elected.
+	elected <-chan struct{}
+
+	mu      sync.Mutex
+	pending map[types.NamespacedName]bool // nil until the services are listed
+	failed  int
+	done    atomic.Bool
+}
+
+// Start implements manager.Runnable.
+func (s *InitialSync) Start(ctx context.Context) error {
+	var list corev1.ServiceList
+	if err := s.List(ctx, &list); err != nil {
+		return fmt.Errorf("initial sync: listing services: %w", err)
+	}
+	if s.Sorted {
+		slices.SortFunc(list.Items, func(a, b corev1.Service) int {
+			return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+		})
+	}
+	initialSyncTotal.Set(float64(len(list.Items)))
+	log.Printf("Initial sync: verifying %d services", len(list.Items))
+
+	s.mu.Lock()
+	s.pending = map[types.NamespacedName]bool{}
+	for i := range list.Items {
+		s.pending[client.ObjectKeyFromObject(&list.Items[i])] = true
+	}
+	s.finishIfDone()
+	s.mu.Unlock()
+
+	for i := range list.Items {
+		select {
+		case s.resync <- event.GenericEvent{Object: &list.Items[i]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// Track wraps the service reconciler so the sweep finishes once every service it queued has been reconciled.
+func (s *InitialSync) Track(r reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		res, err := r.Reconcile(ctx, req)
+		s.reconciled(req.NamespacedName, err)
+		return res, err
+	})
+}
+
+func (s *InitialSync) reconciled(key types.NamespacedName, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending[key] {
+		return
+	}
+	delete(s.pending, key)
+	if err != nil {
+		// the controller retries these, they don't hold up readiness.
+		s.failed++
+		log.Printf("Initial sync: %s: %v", key, err)
+	}
+	initialSyncDone.Inc()
+	s.finishIfDone()
+}
+
+// finishIfDone marks the sweep done once nothing is pending. s.mu must be held.
+func (s *InitialSync) finishIfDone() {
+	if s.pending == nil || len(s.pending) > 0 || s.done.Load() {
+		return
+	}
+	if s.failed > 0 {
+		log.Printf("Initial sync finished with %d errors", s.failed)
+	} else {
+		log.Printf("Initial sync finished")
+	}
+	s.done.Store(true)
+}
+
+// ReadyCheck is a healthz.Checker that fails on the leader until the sweep has finished.
+// Followers don't reconcile so they have nothing to wait for.
+func (s *InitialSync) ReadyCheck(_ *http.Request) error {
+	select {
+	case <-s.elected:
+	default:
+		return nil
+	}
+	if !s.done.Load() {
+		return errors.New("initial sync in progress")
+	}
+	return nil
+}
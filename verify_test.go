@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reversedLister lists services backwards, the fake client already lists them sorted.
+type reversedLister struct {
+	client.Reader
+}
+
+func (r reversedLister) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := r.Reader.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	if services, ok := list.(*corev1.ServiceList); ok {
+		slices.Reverse(services.Items)
+	}
+	return nil
+}
+
+func TestInitialSyncQueuesServicesAndGatesLeaderReadiness(t *testing.T) {
+	var objs []client.Object
+	// neither namespace nor name order alone is namespace/name order.
+	for _, key := range []string{"kube-system/a", "default/z", "default/b", "apps/m", "default/c"} {
+		ns, name, _ := strings.Cut(key, "/")
+		svc := testService(name, "10.0.0.1")
+		svc.Namespace = ns
+		objs = append(objs, svc)
+	}
+	want := []string{"apps/m", "default/b", "default/c", "default/z", "kube-system/a"}
+	c := reversedLister{fake.NewClientBuilder().WithScheme(schemeSetup()).WithObjects(objs...).Build()}
+	resync := make(chan event.GenericEvent, len(objs))
+	elected := make(chan struct{})
+	s := &InitialSync{Reader: c, Sorted: true, resync: resync, elected: elected}
+
+	if err := s.ReadyCheck(nil); err != nil {
+		t.Fatalf("follower not ready: %v", err)
+	}
+	close(elected)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReadyCheck(nil); err == nil {
+		t.Fatal("leader ready before anything was reconciled")
+	}
+
+	var queued []string
+	r := s.Track(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+		return reconcile.Result{}, nil
+	}))
+	for range len(objs) {
+		e := <-resync
+		key := client.ObjectKeyFromObject(e.Object)
+		queued = append(queued, key.String())
+		if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(queued, want) {
+		t.Errorf("queued %v, want %v", queued, want)
+	}
+	if err := s.ReadyCheck(nil); err != nil {
+		t.Errorf("not ready after the sweep: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// Tags on the azure private zone that set policy for the records the controller writes into it.
+const (
+	zoneTTLTag         = "dns.azure.com/ttl"          // default TTL for the zone
+	zoneRecordTypesTag = "dns.azure.com/record-types" // comma separated types the controller may write, e.g. "A,AAAA"
+)
+
+// ZonePolicy is the policy read from a zone's tags. Zero values mean the zone sets no policy.
+type ZonePolicy struct {
+	TTL          int64
+	AllowedTypes map[dns.RecordType]bool // nil allows every type
+}
+
+// allows reports whether the policy lets rt be written.
+func (p *ZonePolicy) allows(rt dns.RecordType) bool {
+	return p == nil || p.AllowedTypes == nil || p.AllowedTypes[rt]
+}
+
+// zonePolicyFromTags parses the policy tags. Invalid values are logged and ignored.
+func zonePolicyFromTags(zone string, tags map[string]*string) *ZonePolicy {
+	p := &ZonePolicy{}
+	if v := tags[zoneTTLTag]; v != nil {
+		ttl, err := strconv.ParseInt(*v, 10, 64)
+		if err != nil || ttl <= 0 {
+			log.Printf("Ignoring invalid %s=%q on zone %s", zoneTTLTag, *v, zone)
+		} else {
+			p.TTL = ttl
+		}
+	}
+	if v := tags[zoneRecordTypesTag]; v != nil {
+		p.AllowedTypes = map[dns.RecordType]bool{}
+		for _, t := range strings.Split(*v, ",") {
+			if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+				p.AllowedTypes[dns.RecordType(t)] = true
+			}
+		}
+	}
+	return p
+}
+
+// LoadZonePolicy reads the zone's tags and installs them as its policy.
+func (r *AzureDNSConfig) LoadZonePolicy(ctx context.Context) error {
+	if r.ZonesClient == nil {
+		return fmt.Errorf("no zones client configured")
+	}
+	resp, err := r.ZonesClient.Get(ctx, r.ResourceGroup, r.ZoneName, &dns.PrivateZonesClientGetOptions{})
+	if err != nil {
+		return fmt.Errorf("error reading zone %s: %w", r.ZoneName, err)
+	}
+	if resp.ID == nil {
+		// no tags is a valid policy, a zone without even an id is not.
+		return fmt.Errorf("%w: reading zone %s", errEmptyResponse, r.ZoneName)
+	}
+	r.policy.Store(zonePolicyFromTags(r.ZoneName, resp.Tags))
+	return nil
+}
+
+// ZonePolicyRefresher re-reads every zone's policy on an interval so tag changes are picked up.
+type ZonePolicyRefresher struct {
+	zones    []*AzureDNSConfig
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (z *ZonePolicyRefresher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(z.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, zone := range z.zones {
+				if err := zone.LoadZonePolicy(ctx); err != nil {
+					log.Printf("Failed to refresh zone policy, keeping the previous one: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica needs current policy.
+func (z *ZonePolicyRefresher) NeedLeaderElection() bool {
+	return false
+}
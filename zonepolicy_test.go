@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	dns "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// fakeZones returns a zone with tags.
+type fakeZones struct {
+	tags map[string]*string
+}
+
+func (f fakeZones) Get(_ context.Context, _, zone string, _ *dns.PrivateZonesClientGetOptions) (dns.PrivateZonesClientGetResponse, error) {
+	return dns.PrivateZonesClientGetResponse{PrivateZone: dns.PrivateZone{ID: to.StringPtr("/zones/" + zone), Tags: f.tags}}, nil
+}
+
+func TestZonePolicyAppliedUnlessServiceOverrides(t *testing.T) {
+	zones := fakeZones{tags: map[string]*string{zoneTTLTag: to.StringPtr("120"), zoneRecordTypesTag: to.StringPtr("A")}}
+	r, sets := newTestAzureDNSConfig(t, WithZonesClient(zones))
+	ctx := context.Background()
+	if err := r.LoadZonePolicy(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.UpsertDNSRecords(ctx, "web.default.svc", []string{"10.0.0.1", "fd00::1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := to.Int64(sets.sets[fakeKey(dns.RecordTypeA, "web.default.svc")].Properties.TTL); got != 120 {
+		t.Errorf("TTL = %d, want the zone's 120", got)
+	}
+	if _, ok := sets.sets[fakeKey(dns.RecordTypeAAAA, "web.default.svc")]; ok {
+		t.Error("AAAA record written to a zone whose policy only allows A")
+	}
+
+	// a ttl annotation on the service is more specific than the zone's.
+	if _, err := r.UpsertDNSRecords(ctx, "db.default.svc", []string{"10.0.0.2"}, 30); err != nil {
+		t.Fatal(err)
+	}
+	if got := to.Int64(sets.sets[fakeKey(dns.RecordTypeA, "db.default.svc")].Properties.TTL); got != 30 {
+		t.Errorf("TTL = %d, want the service's 30", got)
+	}
+}
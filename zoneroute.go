@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// zoneAnnotation picks the one zone a service's records go to, overriding -zone namespace mappings.
+const zoneAnnotation = annotationPrefix + "zone"
+
+// publishedZoneAnnotation is the zone a service's records were last written to, empty for the -zoneName zones.
+const publishedZoneAnnotation = annotationPrefix + "published-zone"
+
+var errUnknownZone = errors.New("zone isn't configured")
+
+// errUnroutedWrite is a write whose context was never given a zone with withZone. They aren't sent
+// to the -zoneName zones by default so a record routed elsewhere can't be written or deleted there by mistake.
+var errUnroutedWrite = errors.New("write isn't routed to a zone")
+
+type zoneContextKey struct{}
+
+// withZone routes the writes made with ctx to zone, see ZoneFanout. Empty routes them to the -zoneName zones.
+// Every write to a ZoneFanout must be routed.
+func withZone(ctx context.Context, zone string) context.Context {
+	return context.WithValue(ctx, zoneContextKey{}, zone)
+}
+
+// zoneFromContext is the zone set by withZone, ok is false if there is none.
+func zoneFromContext(ctx context.Context) (zone string, ok bool) {
+	zone, ok = ctx.Value(zoneContextKey{}).(string)
+	return zone, ok
+}
+
+// zoneMappings is the repeated -zone namespace=zoneName flag.
+type zoneMappings map[string]string
+
+func (m zoneMappings) String() string {
+	var out []string
+	for _, ns := range slices.Sorted(maps.Keys(m)) {
+		out = append(out, ns+"="+m[ns])
+	}
+	return strings.Join(out, ",")
+}
+
+func (m zoneMappings) Set(v string) error {
+	ns, zone, ok := strings.Cut(v, "=")
+	ns, zone = strings.TrimSpace(ns), strings.TrimSpace(zone)
+	if !ok || ns == "" || zone == "" {
+		return fmt.Errorf("%q isn't namespace=zoneName", v)
+	}
+	if prev, ok := m[ns]; ok && prev != zone {
+		return fmt.Errorf("namespace %s is already mapped to zone %s", ns, prev)
+	}
+	m[ns] = zone
+	return nil
+}
+
+// ZoneRouter picks the zone a service's records are written to.
+type ZoneRouter struct {
+	Namespaces map[string]string // namespace to zone, from -zone
+	Zones      []string          // every configured zone, the dns.azure.com/zone annotation must name one
+	DNSZones   client.Reader     // optional, nil ignores DNSZone resources
+}
+
+// Zone is svc's dns.azure.com/zone annotation, else the zone its namespace is mapped to by -zone or
+// a DNSZone. Empty means the -zoneName zones.
+func (z *ZoneRouter) Zone(ctx context.Context, svc *corev1.Service) (string, error) {
+	if z == nil {
+		return "", nil
+	}
+	var dnsZoneList []DNSZone
+	if z.DNSZones != nil {
+		var err error
+		if dnsZoneList, err = dnsZones(ctx, z.DNSZones); err != nil {
+			return "", err
+		}
+	}
+	if zone, ok := svc.Annotations[zoneAnnotation]; ok {
+		zone = strings.TrimSuffix(strings.TrimSpace(zone), ".")
+		if known := z.known(dnsZoneList); !slices.Contains(known, zone) {
+			return "", fmt.Errorf("%w: %s=%q, must be one of %v", errUnknownZone, zoneAnnotation, zone, known)
+		}
+		return zone, nil
+	}
+	if zone, ok := z.Namespaces[svc.Namespace]; ok || len(dnsZoneList) == 0 {
+		return zone, nil
+	}
+	var ns corev1.Namespace
+	if err := z.DNSZones.Get(ctx, client.ObjectKey{Name: svc.Namespace}, &ns); err != nil {
+		return "", err
+	}
+	return dnsZoneFor(dnsZoneList, ns.Labels)
+}
+
+// Known reports whether zone is still configured, by flags or a DNSZone. Empty, the -zoneName zones, always is.
+func (z *ZoneRouter) Known(ctx context.Context, zone string) (bool, error) {
+	if zone == "" || z == nil || slices.Contains(z.Zones, zone) {
+		return true, nil
+	}
+	if z.DNSZones == nil {
+		return false, nil
+	}
+	dnsZoneList, err := dnsZones(ctx, z.DNSZones)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(z.known(dnsZoneList), zone), nil
+}
+
+// known is every configured zone, the flag ones followed by those of dnsZoneList.
+func (z *ZoneRouter) known(dnsZoneList []DNSZone) []string {
+	known := slices.Clone(z.Zones)
+	for _, dz := range dnsZoneList {
+		known = append(known, dz.Spec.ZoneName)
+	}
+	return known
+}